@@ -0,0 +1,189 @@
+package dbops
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// -------------------- AGGREGATES --------------------
+
+// an aggregate function over a column of an Rtable, computed per group of rows by Rtable.Aggregate
+type Aggregate struct {
+	Func     agg_func
+	Cname    string //column name ("" -> every row, only for Agg_count)
+	Distinct bool   //whether only distinct values are aggregated (not with Cname "")
+
+	As string //name of the result, by which Having and Order refer to it ("" -> e.g. "SUM(col)" or "COUNT(*)"), should differ from every column name
+}
+
+type agg_func string //constants begin with "Agg_"; sql aggregate functions, NULL values are left out of all of them
+const (
+	Agg_count agg_func = "COUNT" //number of values (of rows, without Cname)
+	Agg_sum   agg_func = "SUM"   //sum of the values (NULL if there are none)
+	Agg_avg   agg_func = "AVG"   //average of the values, as a float (NULL if there are none)
+	Agg_min   agg_func = "MIN"   //least value
+	Agg_max   agg_func = "MAX"   //greatest value
+)
+
+// returns the name of the result of <agg>
+func (agg Aggregate) name() string {
+	if agg.As != "" {
+		return agg.As
+	}
+	if agg.Cname == "" {
+		return string(agg.Func) + "(*)"
+	}
+	return string(agg.Func) + "(" + agg.Cname + ")"
+}
+
+// returns <agg> as a result column of a SELECT statement, e.g. `SUM("col") AS "SUM(col)"`
+func (agg Aggregate) selCol() string {
+	arg := "*"
+	if agg.Cname != "" {
+		arg = "\"" + agg.Cname + "\""
+		if agg.Distinct {
+			arg = "DISTINCT " + arg
+		}
+	}
+	return string(agg.Func) + "(" + arg + ") AS \"" + agg.name() + "\""
+}
+
+/*
+tries to return one row per group of rows of <rt> (on-disk) having the same values in the columns <groupBy>, made of these values followed by <aggs> computed over the group
+  - without <groupBy>, all rows are one group (so there is one row, even if no row is selected)
+  - <condarr> specifies conditions which must be true for a row to be aggregated ("deleted" rows never are, see DeleteData)
+  - <having> specifies conditions which must be true for a group to be returned, naming columns of <groupBy> or results of <aggs> (see Aggregate.As)
+  - <ordarr> specifies the order of the groups, by the same names
+  - a column of <aggs> or <groupBy> which <rt> does not have -> ErrIsNotPresent, an Aggregate without a valid Func (or with Distinct, but no Cname) -> ErrBadData
+*/
+func (rt *Rtable) Aggregate(aggs []Aggregate, groupBy []string, condarr []Condition, having []Condition, ordarr []Order) (data [][]any, err error) {
+	return rt.AggregateContext(context.Background(), aggs, groupBy, condarr, having, ordarr)
+}
+
+// same as Aggregate, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) AggregateContext(ctx context.Context, aggs []Aggregate, groupBy []string, condarr []Condition, having []Condition, ordarr []Order) (data [][]any, err error) {
+	if !rt.valid() {
+		return [][]any{}, ErrInvalidTable
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, true, false)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer rt.parent.unlock(true, false)
+
+	return rt.aggregate(ctx, rt.parent.db, aggs, groupBy, condarr, having, ordarr)
+}
+
+// same as Aggregate, but on <rt>'s in-memory version
+func (rt *Rtable) AggregateMem(aggs []Aggregate, groupBy []string, condarr []Condition, having []Condition, ordarr []Order) (data [][]any, err error) {
+	return rt.AggregateMemContext(context.Background(), aggs, groupBy, condarr, having, ordarr)
+}
+
+// same as AggregateMem, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) AggregateMemContext(ctx context.Context, aggs []Aggregate, groupBy []string, condarr []Condition, having []Condition, ordarr []Order) (data [][]any, err error) {
+	if !rt.valid() {
+		return [][]any{}, ErrInvalidTable
+	}
+	if rt.parent.mem == nil {
+		return [][]any{}, ErrNoMem
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, false, true)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer rt.parent.unlock(false, true)
+
+	return rt.aggregate(ctx, rt.parent.mem, aggs, groupBy, condarr, having, ordarr)
+}
+
+// without locking, tries to return the statement (and its substitutions) for Aggregate(<aggs>, <groupBy>, <condarr>, <having>, <ordarr>) on <rt> (<qual> -> as "main"."<rt>")
+func (rt *Rtable) aggStatement(qual bool, aggs []Aggregate, groupBy []string, condarr []Condition, having []Condition, ordarr []Order) (statement string, subs []any, err error) {
+	if len(aggs)+len(groupBy) == 0 {
+		return "", nil, ErrBadData
+	}
+
+	cnames := make(stringset, len(rt.cols))
+	for _, c := range rt.cols[rt.ddint:] {
+		cnames[c.name] = empty{}
+	}
+
+	selcols := make([]string, 0, len(groupBy)+len(aggs))
+	for _, cname := range groupBy {
+		if !cnames.has(cname) {
+			return "", nil, ErrIsNotPresent
+		}
+		selcols = append(selcols, "\""+cname+"\"")
+	}
+	for _, agg := range aggs {
+		switch agg.Func {
+		case Agg_count, Agg_sum, Agg_avg, Agg_min, Agg_max:
+		default:
+			return "", nil, ErrBadData
+		}
+		if agg.Cname == "" {
+			if (agg.Func != Agg_count) || agg.Distinct {
+				return "", nil, ErrBadData
+			}
+		} else if !cnames.has(agg.Cname) { //a missing column would be taken as a string
+			return "", nil, ErrIsNotPresent
+		}
+		selcols = append(selcols, agg.selCol())
+	}
+
+	if rt.dd {
+		condarr = append(condarr[:len(condarr):len(condarr)], orgDdColIs0)
+	} //do not include "deleted" rows
+	where, subs, err := clausify_condition_array(condarr)
+	if err != nil {
+		return "", nil, err
+	}
+
+	from := "\"" + rt.name + "\""
+	if qual {
+		from = "\"main\"." + from
+	}
+	statement = "SELECT " + strings.Join(selcols, ", ") + " FROM " + from + where
+	if len(groupBy) != 0 {
+		statement += " GROUP BY " + quoteList(groupBy)
+	}
+	if len(having) != 0 {
+		hclause, hsubs, err := clausify_conditions(having)
+		if err != nil {
+			return "", nil, err
+		}
+		statement += " HAVING " + hclause
+		subs = append(subs, hsubs...)
+	}
+	return statement + clausify_order_array(ordarr) + ";", subs, nil
+}
+
+// without locking, does what Aggregate does, on <db>
+func (rt *Rtable) aggregate(ctx context.Context, db sqlx.QueryerContext, aggs []Aggregate, groupBy []string, condarr []Condition, having []Condition, ordarr []Order) (data [][]any, err error) {
+	statement, subs, err := rt.aggStatement(true, aggs, groupBy, condarr, having, ordarr)
+	if err != nil {
+		return [][]any{}, err
+	}
+
+	rows, err := db.QueryxContext(ctx, statement, subs...)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row_vals, err := rows.SliceScan()
+		if err != nil {
+			return data, err
+		}
+		data = append(data, row_vals)
+	}
+	return data, rows.Err()
+}
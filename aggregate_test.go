@@ -0,0 +1,81 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests aggregates with and without groups, conditions on rows and groups, and that "deleted" rows are left out on disk and in memory
+func TestAggregate(t *testing.T) {
+
+	//init
+	var tts = []dbops.Table{{Name: "sales", Dd: true, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true},
+		{Name: "region", Ext: "TEXT", Pk: false}, {Name: "amount", Ext: "INTEGER", Pk: false}}}}
+
+	src, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "agg.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+
+	tbl := src.GetRtable("sales")
+	err = tbl.InsertData(dbops.Conf_abort, []any{1, "n", 10, 2, "n", 20, 3, "s", 5, 4, "s", nil, 5, "e", 7})
+	if err == nil {
+		err = tbl.DeleteData([]dbops.Condition{{Cname: "id", Op: dbops.Op_eq, Val: 5}})
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	expect := func(data [][]any, err error, expected [][]any) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if !reflect.DeepEqual(data, expected) {
+			t.Fatalf("expected %v, got %v", expected, data)
+		}
+	}
+
+	//grouped
+	all := []dbops.Aggregate{{Func: dbops.Agg_count}, {Func: dbops.Agg_sum, Cname: "amount", As: "total"}, {Func: dbops.Agg_avg, Cname: "amount"},
+		{Func: dbops.Agg_min, Cname: "amount"}, {Func: dbops.Agg_max, Cname: "amount"}}
+	data, err := tbl.Aggregate(all, []string{"region"}, []dbops.Condition{}, []dbops.Condition{}, []dbops.Order{{Cname: "region", Dir: true}})
+	expect(data, err, [][]any{{"n", int64(2), int64(30), 15.0, int64(10), int64(20)}, {"s", int64(2), int64(5), 5.0, int64(5), int64(5)}})
+
+	//conditions on rows, and on groups by the names of results
+	data, err = tbl.Aggregate(all[:2], []string{"region"}, []dbops.Condition{{Cname: "id", Op: dbops.Op_neq, Val: 1}},
+		[]dbops.Condition{{Cname: "total", Op: dbops.Op_eqmore, Val: 5}}, []dbops.Order{{Cname: "total", Dir: false}})
+	expect(data, err, [][]any{{"n", int64(1), int64(20)}, {"s", int64(2), int64(5)}})
+	data, err = tbl.Aggregate(all[:1], []string{"region"}, []dbops.Condition{}, []dbops.Condition{{Cname: "COUNT(*)", Op: dbops.Op_eq, Val: 2}, {Lrel: true, Cname: "region", Op: dbops.Op_eq, Val: "s"}}, []dbops.Order{})
+	expect(data, err, [][]any{{"s", int64(2)}})
+
+	//ungrouped, NULL values are not counted
+	data, err = tbl.Aggregate([]dbops.Aggregate{{Func: dbops.Agg_count}, {Func: dbops.Agg_count, Cname: "amount"}, {Func: dbops.Agg_count, Cname: "region", Distinct: true}},
+		nil, []dbops.Condition{}, nil, nil)
+	expect(data, err, [][]any{{int64(4), int64(3), int64(2)}})
+
+	//invalid
+	_, err = tbl.Aggregate([]dbops.Aggregate{{Func: dbops.Agg_sum, Cname: "nope"}}, nil, nil, nil, nil)
+	if err != dbops.ErrIsNotPresent {
+		t.Fatalf("expected ErrIsNotPresent, got %v", err)
+	}
+	_, err = tbl.Aggregate([]dbops.Aggregate{{Func: dbops.Agg_sum}}, nil, nil, nil, nil)
+	if err != dbops.ErrBadData {
+		t.Fatalf("expected ErrBadData, got %v", err)
+	}
+
+	//in memory
+	err = src.CreateMem()
+	if err == nil {
+		err = tbl.LoadIntoMem(0, -1, dbops.Conf_abort, []dbops.Condition{})
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	data, err = tbl.AggregateMem(all[1:2], []string{"region"}, nil, nil, []dbops.Order{{Cname: "region", Dir: true}})
+	expect(data, err, [][]any{{"n", int64(30)}, {"s", int64(5)}})
+}
@@ -0,0 +1,406 @@
+package dbops
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrChecksumMismatch error = errors.New("ErrChecksumMismatch (dbops) - The contents of a data source do not match the supplied checksum")
+
+// -------------------- CHECKSUMS --------------------
+
+// the name of the algorithm written into (and expected in) checksum manifests
+const ChecksumAlgorithm = "sha256/dbops-v2"
+
+// a serialisable record of the checksums of a data source, as returned by DataSrc.Manifest
+type ChecksumManifest struct {
+	Algorithm string            `json:"algorithm"`
+	Digest    string            `json:"digest"` //checksum of the whole data source
+	Tables    map[string]string `json:"tables"` //table name -> checksum of that table
+}
+
+// writes <s> into <h>, prefixed with its length (so that concatenations cannot collide)
+func hashString(h hash.Hash, s string) {
+	var lenbuf [8]byte
+	binary.BigEndian.PutUint64(lenbuf[:], uint64(len(s)))
+	h.Write(lenbuf[:])
+	h.Write([]byte(s))
+}
+
+// writes a type-tagged representation of <v> (as returned by the database) into <h>
+func hashValue(h hash.Hash, v any) {
+	var numbuf [8]byte
+	switch v := v.(type) {
+	case nil:
+		h.Write([]byte{'n'})
+	case int64:
+		h.Write([]byte{'i'})
+		binary.BigEndian.PutUint64(numbuf[:], uint64(v))
+		h.Write(numbuf[:])
+	case float64:
+		h.Write([]byte{'f'})
+		binary.BigEndian.PutUint64(numbuf[:], math.Float64bits(v))
+		h.Write(numbuf[:])
+	case bool:
+		h.Write([]byte{'i'})
+		if v {
+			binary.BigEndian.PutUint64(numbuf[:], 1)
+		}
+		h.Write(numbuf[:])
+	case string:
+		h.Write([]byte{'s'})
+		hashString(h, v)
+	case []byte:
+		h.Write([]byte{'b'})
+		hashString(h, string(v))
+	case time.Time:
+		h.Write([]byte{'t'})
+		hashString(h, v.UTC().Format(time.RFC3339Nano))
+	default:
+		h.Write([]byte{'?'})
+		hashString(h, csvField(v))
+	}
+}
+
+/*
+without locking, tries to return the checksum of <rt>'s schema and all of its rows (except "deleted" ones) on <db>
+  - column definitions are hashed normalized (see ColDef.Equal), and the dd column is left out, so copies differing only in these match
+*/
+func (rt *Rtable) checksum(ctx context.Context, db sqlx.QueryerContext) (sum []byte, err error) {
+	h := sha256.New()
+
+	hashString(h, rt.name)
+	cols := rt.cols[rt.ddint:]
+	selcols := make([]string, len(cols))
+	orderby := make([]string, 0, len(cols))
+	for i, c := range cols {
+		hashString(h, c.name)
+		hashString(h, normExt(c.ext))
+		selcols[i] = "\"" + c.name + "\""
+		if c.pk {
+			h.Write([]byte{1})
+			orderby = append(orderby, selcols[i])
+		} else {
+			h.Write([]byte{0})
+		}
+	}
+	for i, c := range cols { //primary key first, then the rest, so that the row order is always the same
+		if !c.pk {
+			orderby = append(orderby, selcols[i])
+		}
+	}
+
+	where := ""
+	if rt.dd {
+		where = " WHERE \"" + orgDdCol.name + "\" == 0"
+	}
+	rows, err := db.QueryxContext(ctx, "SELECT "+strings.Join(selcols, ", ")+" FROM \"main\".\""+rt.name+"\""+where+" ORDER BY "+strings.Join(orderby, ", ")+";")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row_vals, err := rows.SliceScan()
+		if err != nil {
+			return nil, err
+		}
+
+		h.Write([]byte{'r'})
+		for _, v := range row_vals {
+			hashValue(h, v)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// without locking, tries to return the checksums of all tables of <src> on <db> (by name), and the checksum of all of them together
+func (src *DataSrc) checksums(ctx context.Context, db sqlx.QueryerContext) (tables map[string]string, digest string, err error) {
+	tables = make(map[string]string, len(src.rtables))
+	names := make([]string, len(src.rtables))
+
+	for i, rt := range src.rtables {
+		sum, err := rt.checksum(ctx, db)
+		if err != nil {
+			return nil, "", err
+		}
+		tables[rt.name] = hex.EncodeToString(sum)
+		names[i] = rt.name
+	}
+
+	slices.Sort(names) //the order of tables in <src> does not matter
+	h := sha256.New()
+	for _, name := range names {
+		hashString(h, name)
+		hashString(h, tables[name])
+	}
+
+	return tables, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// tries to return a hex encoded checksum of <rt>'s schema and all of its rows (except "deleted" ones) on-disk
+func (rt *Rtable) Checksum() (string, error) {
+	return rt.ChecksumContext(context.Background())
+}
+
+// same as Checksum, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) ChecksumContext(ctx context.Context) (sum string, err error) {
+	if !rt.valid() {
+		return "", ErrInvalidTable
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, true, false)
+	if err != nil {
+		return "", err
+	}
+	defer rt.parent.unlock(true, false)
+
+	bsum, err := rt.checksum(ctx, rt.parent.db)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bsum), nil
+}
+
+// tries to return a hex encoded checksum of <rt>'s schema and all of its rows (except "deleted" ones) in-memory
+func (rt *Rtable) ChecksumMem() (string, error) {
+	return rt.ChecksumMemContext(context.Background())
+}
+
+// same as ChecksumMem, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) ChecksumMemContext(ctx context.Context) (sum string, err error) {
+	if !rt.valid() {
+		return "", ErrInvalidTable
+	}
+	if rt.parent.mem == nil {
+		return "", ErrNoMem
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, false, true)
+	if err != nil {
+		return "", err
+	}
+	defer rt.parent.unlock(false, true)
+
+	bsum, err := rt.checksum(ctx, rt.parent.mem)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bsum), nil
+}
+
+// tries to return a hex encoded checksum of all tables of <src> on-disk (does not depend on the order of tables)
+func (src *DataSrc) Checksum() (string, error) {
+	return src.ChecksumContext(context.Background())
+}
+
+// same as Checksum, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) ChecksumContext(ctx context.Context) (digest string, err error) {
+	if src == nil {
+		return "", ErrNilSource
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = src.lock(ctx, true, false)
+	if err != nil {
+		return "", err
+	}
+	defer src.unlock(true, false)
+
+	_, digest, err = src.checksums(ctx, src.db)
+	return digest, err
+}
+
+// tries to return a hex encoded checksum of all tables of <src> in-memory (does not depend on the order of tables)
+func (src *DataSrc) ChecksumMem() (string, error) {
+	return src.ChecksumMemContext(context.Background())
+}
+
+// same as ChecksumMem, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) ChecksumMemContext(ctx context.Context) (digest string, err error) {
+	if src == nil {
+		return "", ErrNilSource
+	}
+	if src.mem == nil {
+		return "", ErrNoMem
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = src.lock(ctx, false, true)
+	if err != nil {
+		return "", err
+	}
+	defer src.unlock(false, true)
+
+	_, digest, err = src.checksums(ctx, src.mem)
+	return digest, err
+}
+
+// tries to return the names of all tables of <src> whose in-memory contents differ from the on-disk ones (empty -> in sync)
+func (src *DataSrc) CompareMem() (mismatched []string, err error) {
+	return src.CompareMemContext(context.Background())
+}
+
+// same as CompareMem, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) CompareMemContext(ctx context.Context) (mismatched []string, err error) {
+	if src == nil {
+		return []string{}, ErrNilSource
+	}
+	if src.mem == nil {
+		return []string{}, ErrNoMem
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = src.lock(ctx, true, true)
+	if err != nil {
+		return []string{}, err
+	}
+	defer src.unlock(true, true)
+
+	var dtables, mtables map[string]string
+	var derr, merr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); dtables, _, derr = src.checksums(ctx, src.db) }()
+	go func() { defer wg.Done(); mtables, _, merr = src.checksums(ctx, src.mem) }()
+	wg.Wait()
+	if derr != nil {
+		return []string{}, derr
+	}
+	if merr != nil {
+		return []string{}, merr
+	}
+
+	mismatched = []string{}
+	for _, rt := range src.rtables {
+		if dtables[rt.name] != mtables[rt.name] {
+			mismatched = append(mismatched, rt.name)
+		}
+	}
+	return mismatched, nil
+}
+
+// tries to return a manifest of the checksums of all tables of <src> on-disk
+func (src *DataSrc) Manifest() (ChecksumManifest, error) {
+	return src.ManifestContext(context.Background())
+}
+
+// same as Manifest, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) ManifestContext(ctx context.Context) (m ChecksumManifest, err error) {
+	if src == nil {
+		return m, ErrNilSource
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = src.lock(ctx, true, false)
+	if err != nil {
+		return m, err
+	}
+	defer src.unlock(true, false)
+
+	tables, digest, err := src.checksums(ctx, src.db)
+	if err != nil {
+		return m, err
+	}
+	return ChecksumManifest{Algorithm: ChecksumAlgorithm, Digest: digest, Tables: tables}, nil
+}
+
+// tries to write a manifest of the checksums of all tables of <src> on-disk into the file at <path> (as json)
+func (src *DataSrc) WriteManifest(path string) error {
+	return src.WriteManifestContext(context.Background(), path)
+}
+
+// same as WriteManifest, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) WriteManifestContext(ctx context.Context, path string) error {
+	m, err := src.ManifestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0600)
+}
+
+// tries to read a manifest written by DataSrc.WriteManifest from the file at <path>
+func ReadManifest(path string) (m ChecksumManifest, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return m, err
+	}
+	if m.Algorithm != ChecksumAlgorithm {
+		return m, ErrBadData
+	}
+	return m, nil
+}
+
+/*
+tries to check <src> (on-disk) against <m>
+  - returns the names of all tables which differ, are missing from <src> or are missing from <m>
+  - any difference -> ErrChecksumMismatch
+*/
+func (src *DataSrc) VerifyManifest(m ChecksumManifest) (mismatched []string, err error) {
+	return src.VerifyManifestContext(context.Background(), m)
+}
+
+// same as VerifyManifest, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) VerifyManifestContext(ctx context.Context, m ChecksumManifest) (mismatched []string, err error) {
+	if m.Algorithm != ChecksumAlgorithm {
+		return []string{}, ErrBadData
+	}
+
+	cur, err := src.ManifestContext(ctx)
+	if err != nil {
+		return []string{}, err
+	}
+
+	mismatched = []string{}
+	for name, sum := range cur.Tables {
+		if m.Tables[name] != sum {
+			mismatched = append(mismatched, name)
+		}
+	}
+	for name := range m.Tables {
+		if _, ok := cur.Tables[name]; !ok {
+			mismatched = append(mismatched, name)
+		}
+	}
+	slices.Sort(mismatched)
+
+	if (len(mismatched) != 0) || (cur.Digest != m.Digest) {
+		return mismatched, ErrChecksumMismatch
+	}
+	return mismatched, nil
+}
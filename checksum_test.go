@@ -0,0 +1,122 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that checksums are deterministic, match between copies, and detect changes
+func TestChecksum(t *testing.T) {
+
+	//init
+	var dir = t.TempDir()
+	var tts = []dbops.Table{{Name: "sum a", Dd: true, Cols: []dbops.Col{{Name: "a a", Ext: "INTEGER", Pk: true},
+		{Name: "b b", Ext: "TEXT", Pk: false}}},
+		{Name: "sum b", Dd: false, Cols: []dbops.Col{{Name: "x", Ext: "BLOB", Pk: false}}}}
+
+	src, err := dbops.CreateSrc(filepath.Join(dir, "sum.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+
+	//the second source has its tables in a different order, and gets rows inserted in a different order
+	slices.Reverse(tts)
+	dest, err := dbops.CreateSrc(filepath.Join(dir, "sum2.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer dest.Disconnect()
+
+	err = src.GetRtable("sum a").InsertData(dbops.Conf_abort, []any{1, "a", 2, nil, 3, "c"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = src.GetRtable("sum b").InsertData(dbops.Conf_abort, []any{[]byte{0, 1}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	err = dest.FetchAllFrom(src, dbops.Conf_abort, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	sum, err := src.Checksum()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	dsum, err := dest.Checksum()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if sum != dsum {
+		t.Fatalf("checksums of copied sources differ")
+	}
+
+	//a copy without the dd column, its definitions spelled differently, matches as well
+	plain, err := dbops.CreateSrc(filepath.Join(dir, "sum3.db"), []dbops.Table{{Name: "sum a", Cols: []dbops.Col{{Name: "a a", Ext: "integer", Pk: true},
+		{Name: "b b", Ext: "text", Pk: false}}}, {Name: "sum b", Cols: []dbops.Col{{Name: "x", Ext: "blob", Pk: false}}}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer plain.Disconnect()
+	err = plain.FetchAllFrom(src, dbops.Conf_abort, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	psum, err := plain.Checksum()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if sum != psum {
+		t.Fatalf("checksums of sources differing only in their dd column and spelling differ")
+	}
+
+	//write a manifest, then verify the copy against it
+	mpath := filepath.Join(dir, "sum.json")
+	err = src.WriteManifest(mpath)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	m, err := dbops.ReadManifest(mpath)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, err = dest.VerifyManifest(m)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//load everything into memory, which must then have the same checksum
+	err = src.CreateMem()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, name := range src.GetTableNames() {
+		err = src.GetRtable(name).LoadIntoMem(0, -1, dbops.Conf_abort, []dbops.Condition{})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	mismatched, err := src.CompareMem()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(mismatched) != 0 {
+		t.Fatalf("disk and memory checksums differ for %v", mismatched)
+	}
+
+	//any change must be detected
+	err = dest.GetRtable("sum a").DeleteData([]dbops.Condition{{Cname: "a a", Op: dbops.Op_eq, Val: 2}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	mismatched, err = dest.VerifyManifest(m)
+	if (err != dbops.ErrChecksumMismatch) || !slices.Equal(mismatched, []string{"sum a"}) {
+		t.Fatalf("expected mismatch in sum a, got %v (%v)", mismatched, err)
+	}
+}
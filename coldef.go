@@ -0,0 +1,543 @@
+package dbops
+
+import (
+	"strconv"
+	"strings"
+)
+
+// -------------------- COLUMN DEFINITIONS --------------------
+
+/*
+a structured Col.Ext, rendered by Ext and parsed back by ParseColDef
+  - two definitions are compared by what SQLite makes of them (see Equal), e.g. "INT NOT NULL" equals "integer not null"
+  - expressions (Default, Check, Generated) are sql, written into the table's definition as they are
+*/
+type ColDef struct {
+	Type string //declared type, e.g. "INTEGER" or "VARCHAR(20)" ("" -> none, the column accepts anything), only its affinity matters to SQLite (see Affinity)
+
+	NotNull bool   //whether NULL is refused
+	Default string //value of the column in rows inserted without it, as an sql expression ("" -> NULL), e.g. "0", "'text'" or "datetime('now')"
+	Unique  bool   //whether no two rows may have the same value
+	Check   string //condition every row must fulfil, as an sql expression ("" -> none)
+	Collate string //name of the collation comparing values of the column ("" -> BINARY)
+
+	Generated string //expression the value of the column is computed from, as sql ("" -> not generated, the column is written as any other)
+	Stored    bool   //whether a generated column is stored in its row when written, instead of being computed when read
+}
+
+type col_affinity string //constants begin with "Aff_"; how SQLite stores values of a column (see https://www.sqlite.org/datatype3.html)
+const (
+	Aff_integer col_affinity = "INTEGER" //declared type contains "INT"
+	Aff_text    col_affinity = "TEXT"    //declared type contains "CHAR", "CLOB" or "TEXT"
+	Aff_blob    col_affinity = "BLOB"    //declared type contains "BLOB", or there is none
+	Aff_real    col_affinity = "REAL"    //declared type contains "REAL", "FLOA" or "DOUB"
+	Aff_numeric col_affinity = "NUMERIC" //any other declared type
+)
+
+// returns the affinity SQLite gives a column of <def>
+func (def ColDef) Affinity() col_affinity {
+	t := strings.ToUpper(def.Type)
+	switch {
+	case strings.Contains(t, "INT"):
+		return Aff_integer
+	case strings.Contains(t, "CHAR") || strings.Contains(t, "CLOB") || strings.Contains(t, "TEXT"):
+		return Aff_text
+	case strings.Contains(t, "BLOB") || (strings.TrimSpace(t) == ""):
+		return Aff_blob
+	case strings.Contains(t, "REAL") || strings.Contains(t, "FLOA") || strings.Contains(t, "DOUB"):
+		return Aff_real
+	}
+	return Aff_numeric
+}
+
+// returns <def> as a Col.Ext, e.g. `TEXT NOT NULL DEFAULT 'none' COLLATE NOCASE`
+func (def ColDef) Ext() string {
+	var parts []string
+	if def.Type != "" {
+		parts = append(parts, def.Type)
+	}
+	if def.NotNull {
+		parts = append(parts, "NOT NULL")
+	}
+	if def.Default != "" {
+		if toks, _ := sqlTokens(def.Default); isLiteral(toks) {
+			parts = append(parts, "DEFAULT "+def.Default)
+		} else {
+			parts = append(parts, "DEFAULT ("+def.Default+")")
+		}
+	}
+	if def.Unique {
+		parts = append(parts, "UNIQUE")
+	}
+	if def.Check != "" {
+		parts = append(parts, "CHECK ("+def.Check+")")
+	}
+	if def.Collate != "" {
+		parts = append(parts, "COLLATE "+def.Collate)
+	}
+	if def.Generated != "" {
+		if def.Stored {
+			parts = append(parts, "GENERATED ALWAYS AS ("+def.Generated+") STORED")
+		} else {
+			parts = append(parts, "GENERATED ALWAYS AS ("+def.Generated+") VIRTUAL")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+/*
+returns whether <def> and <def2> define the same column for SQLite
+  - types are compared by their affinity, collations and keywords case-insensitively, expressions without redundant brackets and whitespace
+*/
+func (def ColDef) Equal(def2 ColDef) bool {
+	return def.norm() == def2.norm()
+}
+
+// returns <def> as a string which is the same for every definition Equal to it
+func (def ColDef) norm() string {
+	collate := "BINARY"
+	if def.Collate != "" {
+		collate = strings.ToUpper(def.Collate)
+	}
+	dflt := normExpr(def.Default)
+	if dflt == "NULL" {
+		dflt = ""
+	}
+	generated := normExpr(def.Generated)
+	if (generated != "") && def.Stored {
+		generated += " STORED"
+	}
+
+	return strings.Join([]string{string(def.Affinity()), strconv.FormatBool(def.NotNull), strconv.FormatBool(def.Unique),
+		dflt, normExpr(def.Check), collate, generated}, "\x00")
+}
+
+// tries to parse the Ext of <c> (see ParseColDef)
+func (c Col) Def() (ColDef, error) {
+	return ParseColDef(c.Ext)
+}
+
+/*
+tries to parse <ext> (a Col.Ext, or what follows the name of a column in CREATE TABLE) into a ColDef, not a column definition -> ErrBadData
+  - conflict clauses (ON CONFLICT ...) and constraint names are left out, as is everything ColDef cannot hold (PRIMARY KEY, REFERENCES ...)
+*/
+func ParseColDef(ext string) (ColDef, error) {
+	def, _, err := parseColDef(ext)
+	return def, err
+}
+
+// does what ParseColDef does, also returning whether <ext> holds something a ColDef cannot (PRIMARY KEY, REFERENCES ...)
+func parseColDef(ext string) (def ColDef, extra bool, err error) {
+	toks, ok := sqlTokens(ext)
+	if !ok {
+		return ColDef{}, false, ErrBadData
+	}
+	i := 0
+
+	is := func(words ...string) bool { //whether the tokens from i on are <words>
+		if i+len(words) > len(toks) {
+			return false
+		}
+		for j, w := range words {
+			if !strings.EqualFold(toks[i+j].text, w) {
+				return false
+			}
+		}
+		return true
+	}
+	group := func() (inner string, ok bool) { //consumes a bracketed group starting at i, returning what is inside it
+		if !is("(") {
+			return "", false
+		}
+		close := closingBracket(toks, i)
+		if close == -1 {
+			return "", false
+		}
+		inner = strings.TrimSpace(ext[toks[i].end:toks[close].start])
+		i = close + 1
+		return inner, true
+	}
+	conflict := func() bool { //consumes an optional conflict clause
+		if is("ON", "CONFLICT") {
+			i += 3
+			return i <= len(toks)
+		}
+		return true
+	}
+
+	//type name, until the first constraint
+	for ; (i < len(toks)) && isWord(toks[i].text) && !constraintWords.has(strings.ToUpper(toks[i].text)); i++ {
+	}
+	if (i != 0) && is("(") {
+		if _, ok := group(); !ok {
+			return ColDef{}, false, ErrBadData
+		}
+	}
+	if i != 0 {
+		def.Type = ext[toks[0].start:toks[i-1].end]
+	}
+
+	for i < len(toks) {
+		switch {
+		case is("CONSTRAINT"):
+			i += 2
+
+		case is("PRIMARY", "KEY"):
+			extra = true
+			i += 2
+			if is("ASC") || is("DESC") {
+				i++
+			}
+			ok = conflict()
+			if is("AUTOINCREMENT") {
+				i++
+			}
+
+		case is("NOT", "NULL"):
+			def.NotNull = true
+			i += 2
+			ok = conflict()
+
+		case is("NULL"):
+			i++
+			ok = conflict()
+
+		case is("UNIQUE"):
+			def.Unique = true
+			i++
+			ok = conflict()
+
+		case is("CHECK"):
+			i++
+			def.Check, ok = group()
+
+		case is("DEFAULT"):
+			i++
+			switch {
+			case is("("):
+				def.Default, ok = group()
+			case (is("+") || is("-")) && (i+1 < len(toks)):
+				def.Default = ext[toks[i].start:toks[i+1].end]
+				i += 2
+			case i < len(toks):
+				def.Default = toks[i].text
+				i++
+			default:
+				ok = false
+			}
+
+		case is("COLLATE"):
+			i++
+			if i < len(toks) {
+				def.Collate = toks[i].text
+				i++
+			} else {
+				ok = false
+			}
+
+		case is("GENERATED", "ALWAYS", "AS") || is("AS"):
+			if is("GENERATED") {
+				i += 2
+			}
+			i++
+			def.Generated, ok = group()
+			if is("STORED") {
+				def.Stored = true
+				i++
+			} else if is("VIRTUAL") {
+				i++
+			}
+
+		case is("REFERENCES"):
+			extra = true
+			i += 2 //and the table name
+			if is("(") {
+				if _, ok = group(); !ok {
+					break
+				}
+			}
+			for more := true; more && (i < len(toks)); {
+				switch {
+				case is("ON"):
+					i += 2
+					switch {
+					case is("SET", "NULL"), is("SET", "DEFAULT"), is("NO", "ACTION"):
+						i += 2
+					default:
+						i++
+					}
+				case is("MATCH"):
+					i += 2
+				case is("NOT", "DEFERRABLE"):
+					i++
+				case is("DEFERRABLE"):
+					i++
+					if is("INITIALLY") {
+						i += 2
+					}
+				default:
+					more = false
+				}
+			}
+
+		default:
+			ok = false
+		}
+
+		if !ok || (i > len(toks)) {
+			return ColDef{}, false, ErrBadData
+		}
+	}
+	return def, extra, nil
+}
+
+// upper-case words which begin a column constraint
+var constraintWords = stringset{"CONSTRAINT": {}, "PRIMARY": {}, "NOT": {}, "NULL": {}, "UNIQUE": {}, "CHECK": {}, "DEFAULT": {}, "COLLATE": {}, "REFERENCES": {}, "GENERATED": {}, "AS": {}}
+
+// returns whether <c> and <c2> are equal, their Ext compared by what SQLite makes of it (see ColDef.Equal)
+func (c Col) equal(c2 Col) bool {
+	return (c.Name == c2.Name) && (c.Pk == c2.Pk) && extEqual(c.Ext, c2.Ext)
+}
+
+// returns whether <c> and <c2> are equal, their ext compared by what SQLite makes of it (see ColDef.Equal)
+func rcolEqual(c rcol, c2 rcol) bool {
+	return (c.name == c2.name) && (c.pk == c2.pk) && extEqual(c.ext, c2.ext)
+}
+
+// returns whether the column definitions <ext> and <ext2> are equal (see ColDef.Equal), or equal strings if either cannot be parsed
+func extEqual(ext string, ext2 string) bool {
+	if ext == ext2 {
+		return true
+	}
+
+	def, extra, err := parseColDef(ext)
+	def2, extra2, err2 := parseColDef(ext2)
+	if (err != nil) || (err2 != nil) || extra || extra2 {
+		return false
+	}
+	return def.Equal(def2)
+}
+
+// returns the column definition <ext> normalized (see ColDef.Equal), or <ext> as it is if it cannot be parsed
+func normExt(ext string) string {
+	def, extra, err := parseColDef(ext)
+	if (err != nil) || extra {
+		return ext
+	}
+	return def.norm()
+}
+
+// an sql token, <text> being s[start:end] of the string it is from
+type sqlToken struct {
+	text  string
+	start int
+	end   int
+}
+
+/*
+splits <s> into sql tokens: words (and numbers), quoted names, strings and blobs, and single other characters
+  - whitespace and comments are left out
+  - an unterminated quote or comment -> !ok
+*/
+func sqlTokens(s string) (toks []sqlToken, ok bool) {
+	wordByte := func(b byte) bool {
+		return (b == '_') || (b == '$') || (b >= 0x80) || ((b >= '0') && (b <= '9')) || ((b|0x20 >= 'a') && (b|0x20 <= 'z'))
+	}
+
+	for i := 0; i < len(s); {
+		start := i
+		switch b := s[i]; {
+		case (b == ' ') || (b == '\t') || (b == '\n') || (b == '\r') || (b == '\f'):
+			i++
+			continue
+
+		case strings.HasPrefix(s[i:], "--"):
+			end := strings.IndexByte(s[i:], '\n')
+			if end == -1 {
+				return toks, true
+			}
+			i += end + 1
+			continue
+
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end == -1 {
+				return nil, false
+			}
+			i += end + 4
+			continue
+
+		case (b == '"') || (b == '\'') || (b == '`') || (b == '['):
+			end := quoteEnd(s, i)
+			if end == -1 {
+				return nil, false
+			}
+			i = end
+
+		case wordByte(b):
+			for (i < len(s)) && (wordByte(s[i]) || ((s[i] == '.') && (s[start] >= '0') && (s[start] <= '9'))) {
+				i++
+			}
+			if (i-start == 1) && ((b == 'x') || (b == 'X')) && (i < len(s)) && (s[i] == '\'') { //a blob
+				end := quoteEnd(s, i)
+				if end == -1 {
+					return nil, false
+				}
+				i = end
+			}
+
+		default:
+			i++
+		}
+		toks = append(toks, sqlToken{text: s[start:i], start: start, end: i})
+	}
+	return toks, true
+}
+
+// returns the index after the quote beginning at s[start] (doubled quote characters do not end it), unterminated -> -1
+func quoteEnd(s string, start int) int {
+	q := s[start]
+	if q == '[' {
+		q = ']'
+	}
+
+	for i := start + 1; i < len(s); i++ {
+		if s[i] != q {
+			continue
+		}
+		if (q != ']') && (i+1 < len(s)) && (s[i+1] == q) {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return -1
+}
+
+// returns whether <text> (a token) is a word
+func isWord(text string) bool {
+	switch text[0] {
+	case '"', '\'', '`', '[', '(', ')', ',', ';', '+', '-', '*', '/', '%', '<', '>', '=', '!', '|', '&', '~', '.', '?', ':', '@':
+		return false
+	}
+	return true
+}
+
+// returns the index of the token closing the bracket toks[open], none -> -1
+func closingBracket(toks []sqlToken, open int) int {
+	depth := 0
+	for i := open; i < len(toks); i++ {
+		switch toks[i].text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// returns whether <toks> are a literal value or a signed number (which need no brackets after DEFAULT)
+func isLiteral(toks []sqlToken) bool {
+	switch len(toks) {
+	case 1:
+		return toks[0].text[0] != '('
+	case 2:
+		return ((toks[0].text == "+") || (toks[0].text == "-")) && (toks[1].text[0] >= '0') && (toks[1].text[0] <= '9')
+	}
+	return false
+}
+
+// returns <expr> normalized for comparing it (upper-case words and names, single spaces between tokens, without enclosing brackets)
+func normExpr(expr string) string {
+	toks, ok := sqlTokens(expr)
+	if !ok {
+		return expr
+	}
+	for (len(toks) > 1) && (toks[0].text == "(") && (closingBracket(toks, 0) == len(toks)-1) {
+		toks = toks[1 : len(toks)-1]
+	}
+
+	texts := make([]string, len(toks))
+	for i, tok := range toks {
+		texts[i] = tok.text
+		switch tok.text[0] {
+		case '"', '`', '[': //names are case-insensitive, and need no quotes unless they are more than a word
+			name := unquoteName(tok.text)
+			if wtoks, _ := sqlTokens(name); (len(wtoks) == 1) && (wtoks[0].text == name) && isWord(name) {
+				texts[i] = strings.ToUpper(name)
+			} else {
+				texts[i] = "\"" + strings.ToUpper(strings.ReplaceAll(name, "\"", "\"\"")) + "\""
+			}
+		default:
+			if isWord(tok.text) {
+				texts[i] = strings.ToUpper(tok.text)
+			}
+		}
+	}
+	return strings.Join(texts, " ")
+}
+
+// returns <name> (a token) without its quotes
+func unquoteName(name string) string {
+	switch name[0] {
+	case '[':
+		return name[1 : len(name)-1]
+	case '"', '\'', '`':
+		q := name[:1]
+		return strings.ReplaceAll(name[1:len(name)-1], q+q, q)
+	}
+	return name
+}
+
+// returns what follows the name of every column in <statement> (a CREATE TABLE statement), by the names of the columns
+func colDefTexts(statement string) map[string]string {
+	defs := make(map[string]string)
+	toks, ok := sqlTokens(statement)
+	if !ok {
+		return defs
+	}
+
+	open := -1
+	for i, tok := range toks {
+		if tok.text == "(" {
+			open = i
+			break
+		}
+	}
+	if open == -1 {
+		return defs
+	}
+	close := closingBracket(toks, open)
+	if close == -1 {
+		return defs
+	}
+
+	for i := open + 1; i < close; {
+		end, depth := i, 0 //the end of this column (or table constraint)
+		for ; end < close; end++ {
+			if toks[end].text == "(" {
+				depth++
+			} else if toks[end].text == ")" {
+				depth--
+			} else if (toks[end].text == ",") && (depth == 0) {
+				break
+			}
+		}
+
+		switch strings.ToUpper(toks[i].text) {
+		case "CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN":
+		default:
+			text := ""
+			if i+1 < end {
+				text = statement[toks[i+1].start:toks[end-1].end]
+			}
+			defs[unquoteName(toks[i].text)] = text
+		}
+		i = end + 1
+	}
+	return defs
+}
@@ -0,0 +1,117 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that column definitions are parsed, rendered and compared by what they mean, and round-trip through a database
+func TestColDef(t *testing.T) {
+
+	//parsing
+	parsed := map[string]dbops.ColDef{
+		"VARCHAR(20) NOT NULL DEFAULT 'x' COLLATE NOCASE":                                         {Type: "VARCHAR(20)", NotNull: true, Default: "'x'", Collate: "NOCASE"},
+		"unsigned big int CONSTRAINT positive CHECK (n > 0) UNIQUE ON CONFLICT IGNORE DEFAULT -5": {Type: "unsigned big int", Unique: true, Check: "n > 0", Default: "-5"},
+		"REAL GENERATED ALWAYS AS (a * 2) STORED":                                                 {Type: "REAL", Generated: "a * 2", Stored: true},
+		"TEXT AS (upper(\"b\")) VIRTUAL":                                                          {Type: "TEXT", Generated: "upper(\"b\")"},
+		"DATETIME DEFAULT (datetime('now')) NULL":                                                 {Type: "DATETIME", Default: "datetime('now')"},
+		"": {},
+	}
+	for ext, expected := range parsed {
+		def, err := dbops.ParseColDef(ext)
+		if err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		if !reflect.DeepEqual(def, expected) {
+			t.Fatalf("%s: expected %#v, got %#v", ext, expected, def)
+		}
+
+		again, err := dbops.ParseColDef(def.Ext())
+		if err != nil || !reflect.DeepEqual(again, expected) {
+			t.Fatalf("%s did not survive rendering as %s (%#v, %v)", ext, def.Ext(), again, err)
+		}
+	}
+	for _, ext := range []string{"TEXT CHECK (n > 0", "INTEGER NOT", "INTEGER UNIQUE FOO", "TEXT DEFAULT 'x"} {
+		_, err := dbops.ParseColDef(ext)
+		if err != dbops.ErrBadData {
+			t.Fatalf("%s: expected ErrBadData, got %v", ext, err)
+		}
+	}
+
+	//comparing
+	same := [][2]string{{"INT not null", "INTEGER NOT NULL"}, {"TEXT CHECK((n>0))", "TEXT CHECK (n > 0)"}, {"TEXT COLLATE binary", "TEXT"},
+		{"VARCHAR(3) DEFAULT NULL", "CLOB"}, {"BLOB", ""}}
+	for _, pair := range same {
+		a, _ := dbops.ParseColDef(pair[0])
+		b, _ := dbops.ParseColDef(pair[1])
+		if !a.Equal(b) {
+			t.Fatalf("%s and %s should be equal", pair[0], pair[1])
+		}
+	}
+	different := [][2]string{{"TEXT DEFAULT ''", "TEXT"}, {"INTEGER", "REAL"}, {"TEXT", "TEXT UNIQUE"}, {"TEXT COLLATE NOCASE", "TEXT"},
+		{"INTEGER AS (a) STORED", "INTEGER AS (a)"}, {"TEXT CHECK (\"a\" > 0)", "TEXT CHECK ('a' > 0)"}}
+	for _, pair := range different {
+		a, _ := dbops.ParseColDef(pair[0])
+		b, _ := dbops.ParseColDef(pair[1])
+		if a.Equal(b) {
+			t.Fatalf("%s and %s should differ", pair[0], pair[1])
+		}
+	}
+
+	//round trip through a database, as written
+	path := filepath.Join(t.TempDir(), "coldef.db")
+	tts := []dbops.Table{{Name: "defs", Dd: true, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true},
+		{Name: "name", Ext: dbops.ColDef{Type: "TEXT", NotNull: true, Default: "''", Collate: "NOCASE", Check: "length(\"name\") < 20"}.Ext(), Pk: false},
+		{Name: "n", Ext: "INT DEFAULT (1 + 2) UNIQUE", Pk: false},
+		{Name: "twice", Ext: dbops.ColDef{Type: "INTEGER", Generated: "\"n\" * 2"}.Ext(), Pk: false}}}}
+
+	_, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "bad.db"), []dbops.Table{{Name: "bad", Cols: []dbops.Col{{Name: "id", Ext: "INTEGER PRIMARY KEY", Pk: false}}}})
+	if err != dbops.ErrInvalidTable {
+		t.Fatalf("expected ErrInvalidTable for a primary key in Ext, got %v", err)
+	}
+
+	src, err := dbops.CreateSrc(path, tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	disk, _ := src.Release()
+	_, err = disk.Exec("CREATE TABLE \"raw\"(id INTEGER PRIMARY KEY AUTOINCREMENT, [n] INT NOT NULL DEFAULT (1+2), `g` AS (n*2), p REFERENCES raw(id) ON DELETE CASCADE, CHECK (n > 0));")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = src.Reclaim(true, true)
+	if err == nil {
+		err = src.Disconnect()
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	src, err = dbops.ConnectSrc(path, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+
+	raw := dbops.Table{Name: "raw", Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true}, {Name: "n", Ext: "INT NOT NULL DEFAULT (1+2)", Pk: false},
+		{Name: "g", Ext: "AS (n*2)", Pk: false}, {Name: "p", Ext: "", Pk: false}},
+		ForeignKeys: []dbops.ForeignKey{{Cols: []string{"p"}, RefTable: "raw", RefCols: []string{"id"}, OnDelete: dbops.Fk_cascade}}}
+	err = checkTables(src, append(tts, raw))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//compared by what they mean
+	tts[0].Cols[1].Ext = "text default '' check (length(name)<20) not null collate nocase"
+	tts[0].Cols[2].Ext = "INTEGER UNIQUE DEFAULT (1+2)"
+	if !src.HasTable(tts[0]) {
+		t.Fatalf("a table written differently was not recognized")
+	}
+	tts[0].Cols[2].Ext = "INTEGER UNIQUE DEFAULT 3"
+	if src.HasTable(tts[0]) {
+		t.Fatalf("a table with a different default was recognized")
+	}
+}
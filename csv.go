@@ -0,0 +1,343 @@
+package dbops
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// -------------------- CSV EXPORT/IMPORT --------------------
+
+// the format times are written to csv in (the same format go-sqlite3 stores them in)
+const csvTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+const (
+	csvNull = "\\N" //the field NULL is written as (an empty field is an empty string)
+	csvBlob = "\\x" //what a blob is written as, followed by its bytes in hex
+)
+
+/*
+converts a value returned by the database into a csv field
+  - nil -> csvNull, a blob -> csvBlob and its hex, a string beginning with a backslash gets another one in front (so it cannot be taken for either)
+*/
+func csvField(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return csvNull
+	case string:
+		if strings.HasPrefix(v, "\\") {
+			return "\\" + v
+		}
+		return v
+	case []byte:
+		return csvBlob + hex.EncodeToString(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return v.Format(csvTimeFormat)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// tries to convert a csv field (as written by csvField) into the value to insert
+func csvValue(field string) (any, error) {
+	switch {
+	case field == csvNull:
+		return nil, nil
+	case strings.HasPrefix(field, csvBlob):
+		b, err := hex.DecodeString(field[len(csvBlob):])
+		if err != nil {
+			return nil, ErrBadData
+		}
+		return b, nil
+	case strings.HasPrefix(field, "\\\\"):
+		return field[1:], nil
+	}
+	return field, nil
+}
+
+// returns the filename a table of name <tablename> is exported to/imported from
+func csvFilename(tablename string) (string, error) {
+	if strings.ContainsAny(tablename, "/\\") {
+		return "", ErrBadData
+	}
+	return tablename + ".csv", nil
+}
+
+/*
+tries to write rows of <rt> (on-disk) into <w> as csv, with a header made of the column names
+  - <index>, <count>, <condarr> and <ordarr> select rows the same way as in GetData
+  - if <withDd> is true and <rt> uses deltaDelete, the dd column (and the "deleted" rows) are also written
+  - NULL values are written as \N, blobs as \x followed by their bytes in hex, and text beginning with a backslash with another one in front
+*/
+func (rt *Rtable) ExportCSV(w io.Writer, withDd bool, index int, count int, condarr []Condition, ordarr []Order) (err error) {
+	return rt.ExportCSVContext(context.Background(), w, withDd, index, count, condarr, ordarr)
+}
+
+// same as ExportCSV, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) ExportCSVContext(ctx context.Context, w io.Writer, withDd bool, index int, count int, condarr []Condition, ordarr []Order) (err error) {
+	if !rt.valid() {
+		return ErrInvalidTable
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, true, false)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.unlock(true, false)
+
+	return rt.exportCSV(ctx, w, withDd, index, count, condarr, ordarr)
+}
+
+// without locking, does what ExportCSV does
+func (rt *Rtable) exportCSV(ctx context.Context, w io.Writer, withDd bool, index int, count int, condarr []Condition, ordarr []Order) error {
+	cols := rt.cols[rt.ddint:]
+	if withDd {
+		cols = rt.cols
+	}
+
+	data, err := rt.get(ctx, rt.parent.db, index, count, condarr, ordarr, withDd)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = c.name
+	}
+	err = cw.Write(header)
+	if err != nil {
+		return err
+	}
+
+	record := make([]string, len(cols))
+	for _, row := range data {
+		for i, v := range row {
+			record[i] = csvField(v)
+		}
+
+		err = cw.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+/*
+tries to read csv (as written by ExportCSV) from <r>, then insert (or <cbh>) its rows into <rt> (on-disk)
+  - the header has to consist of exactly the column names of <rt> (in any order), optionally with the dd column
+  - \N fields are inserted as NULL, \x fields as blobs (see ExportCSV), empty fields as empty strings
+*/
+func (rt *Rtable) ImportCSV(r io.Reader, cbh conflict_behaviour) (err error) {
+	return rt.ImportCSVContext(context.Background(), r, cbh)
+}
+
+// same as ImportCSV, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) ImportCSVContext(ctx context.Context, r io.Reader, cbh conflict_behaviour) (err error) {
+	if !rt.valid() {
+		return ErrInvalidTable
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, true, false)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.unlock(true, false)
+
+	return rt.importCSV(ctx, r, cbh)
+}
+
+// without locking, does what ImportCSV does
+func (rt *Rtable) importCSV(ctx context.Context, r io.Reader, cbh conflict_behaviour) error {
+	cr := csv.NewReader(r)
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	cols := rt.cols[rt.ddint:]
+	if rt.dd && (len(header) == len(rt.cols)) {
+		cols = rt.cols
+	}
+	if len(header) != len(cols) {
+		return ErrDiffStructure
+	}
+
+	//map each csv field to the position of its column in <cols>
+	colidx := make(map[string]int, len(cols))
+	for i, c := range cols {
+		colidx[c.name] = i
+	}
+	fieldpos := make([]int, len(header))
+	seen := make(stringset, len(header))
+	for i, h := range header {
+		pos, ok := colidx[h]
+		if !ok || seen.has(h) {
+			return ErrDiffStructure
+		}
+		seen[h] = empty{}
+		fieldpos[i] = pos
+	}
+
+	var data []any
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		row := make([]any, len(cols))
+		for i, field := range record {
+			row[fieldpos[i]], err = csvValue(field)
+			if err != nil {
+				return err
+			}
+		}
+		data = append(data, row...)
+	}
+
+	return rt.insert(ctx, rt.parent.db, cbh, cols, data)
+}
+
+/*
+tries to export every table of <src> (on-disk) into its own file in <dirpath>, named "<table name>.csv"
+  - <withDd> has the same meaning as in Rtable.ExportCSV
+  - existing files will be overwritten
+*/
+func (src *DataSrc) ExportCSV(dirpath string, withDd bool) (err error) {
+	return src.ExportCSVContext(context.Background(), dirpath, withDd)
+}
+
+// same as ExportCSV, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) ExportCSVContext(ctx context.Context, dirpath string, withDd bool) (err error) {
+	if src == nil {
+		return ErrNilSource
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = src.lock(ctx, true, false)
+	if err != nil {
+		return err
+	}
+	defer src.unlock(true, false)
+
+	err = os.MkdirAll(dirpath, 0700)
+	if err != nil {
+		return err
+	}
+
+	for _, rt := range src.rtables {
+		fname, err := csvFilename(rt.name)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Create(filepath.Join(dirpath, fname))
+		if err != nil {
+			return err
+		}
+
+		err = rt.exportCSV(ctx, f, withDd, 0, -1, []Condition{}, []Order{})
+		cerr := f.Close()
+		if err != nil {
+			return err
+		}
+		if cerr != nil {
+			return cerr
+		}
+	}
+	return nil
+}
+
+/*
+tries to import every table of <src> (on-disk) from "<table name>.csv" in <dirpath>, inserting (or <cbh>) its rows
+  - tables without a file are skipped (mustAll -> if any file is missing, abort before importing anything)
+*/
+func (src *DataSrc) ImportCSV(dirpath string, cbh conflict_behaviour, mustAll bool) (err error) {
+	return src.ImportCSVContext(context.Background(), dirpath, cbh, mustAll)
+}
+
+// same as ImportCSV, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) ImportCSVContext(ctx context.Context, dirpath string, cbh conflict_behaviour, mustAll bool) (err error) {
+	if src == nil {
+		return ErrNilSource
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = src.lock(ctx, true, false)
+	if err != nil {
+		return err
+	}
+	defer src.unlock(true, false)
+
+	fpaths := make([]string, len(src.rtables))
+	for i, rt := range src.rtables {
+		fname, err := csvFilename(rt.name)
+		if err != nil {
+			return err
+		}
+		fpaths[i] = filepath.Join(dirpath, fname)
+
+		_, err = os.Stat(fpaths[i])
+		if errors.Is(err, os.ErrNotExist) {
+			if mustAll {
+				return ErrIsNotPresent
+			}
+			fpaths[i] = ""
+		} else if err != nil {
+			return err
+		}
+	}
+
+	for i, rt := range src.rtables {
+		if fpaths[i] == "" {
+			continue
+		}
+
+		f, err := os.Open(fpaths[i])
+		if err != nil {
+			return err
+		}
+
+		err = rt.importCSV(ctx, f, cbh)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package dbops_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that tables exported to csv can be imported back, both one table at a time and for a whole data source
+func TestCSV(t *testing.T) {
+
+	//init
+	var dir = t.TempDir()
+	var tts = []dbops.Table{{Name: "cs v", Dd: true, Cols: []dbops.Col{{Name: "a a", Ext: "INTEGER", Pk: true},
+		{Name: "b b", Ext: "TEXT", Pk: false},
+		{Name: "c c", Ext: "REAL", Pk: false}}}}
+	var tdata = [][]any{{int64(0), "0,\"x\"", 0.5}, {int64(1), nil, 1.0}, {int64(2), "2", nil}}
+
+	src, err := dbops.CreateSrc(filepath.Join(dir, "csv.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+
+	tbl := src.GetRtable(tts[0].Name)
+	err = tbl.InsertData(dbops.Conf_abort, append(append(slices.Clone(tdata[0]), tdata[1]...), tdata[2]...))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//dd the last row, so that it only shows up with the dd column
+	err = tbl.DeleteData([]dbops.Condition{{Cname: "a a", Op: dbops.Op_eq, Val: 2}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//export without the dd column -> only live rows
+	var buf bytes.Buffer
+	err = tbl.ExportCSV(&buf, false, 0, -1, []dbops.Condition{}, []dbops.Order{{Cname: "a a", Dir: true}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if buf.String() != "a a,b b,c c\n0,\"0,\"\"x\"\"\",0.5\n1,\\N,1\n" {
+		t.Fatalf("unexpected csv output %q", buf.String())
+	}
+
+	//export the whole source with the dd column, then import it into a fresh source
+	err = src.ExportCSV(filepath.Join(dir, "out"), true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	dest, err := dbops.CreateSrc(filepath.Join(dir, "csv2.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer dest.Disconnect()
+
+	err = dest.ImportCSV(filepath.Join(dir, "out"), dbops.Conf_abort, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	dtbl := dest.GetRtable(tts[0].Name)
+	err = checkData(dtbl, "a a", tdata, false)
+	if err == nil {
+		t.Fatalf("dd'd row was returned after import")
+	}
+
+	//the dd'd row must come back once undone
+	err = dtbl.UndoDelete(1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = checkData(dtbl, "a a", tdata, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//blobs, NULL, empty strings and text which looks like either survive the round trip
+	raw := dbops.Table{Name: "raw", Cols: []dbops.Col{{Name: "a a", Ext: "INTEGER", Pk: true}, {Name: "b b", Ext: "BLOB", Pk: false},
+		{Name: "c c", Ext: "TEXT NOT NULL", Pk: false}, {Name: "d d", Ext: "TEXT", Pk: false}}}
+	rdata := [][]any{{int64(0), []byte{0, 0xff, '\n', ','}, "", nil}, {int64(1), nil, "\\N", "\\x00"}}
+	err = src.AddTable(raw)
+	if err == nil {
+		err = dest.AddTable(raw)
+	}
+	if err == nil {
+		err = src.GetRtable("raw").InsertData(dbops.Conf_abort, append(slices.Clone(rdata[0]), rdata[1]...))
+	}
+	buf.Reset()
+	if err == nil {
+		err = src.GetRtable("raw").ExportCSV(&buf, false, 0, -1, []dbops.Condition{}, []dbops.Order{})
+	}
+	if err == nil {
+		err = dest.GetRtable("raw").ImportCSV(&buf, dbops.Conf_abort)
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	data, err := dest.GetRtable("raw").GetData(0, -1, []dbops.Condition{}, []dbops.Order{{Cname: "a a", Dir: true}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !reflect.DeepEqual(data, rdata) {
+		t.Fatalf("expected %v, got %v", rdata, data)
+	}
+
+	//a header which does not match the table is rejected
+	err = dtbl.ImportCSV(bytes.NewBufferString("a a,x\n5,5\n"), dbops.Conf_abort)
+	if err != dbops.ErrDiffStructure {
+		t.Fatalf("expected ErrDiffStructure, got %v", err)
+	}
+}
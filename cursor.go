@@ -0,0 +1,150 @@
+package dbops
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// -------------------- CURSORS --------------------
+
+/*
+streams rows of a table one at a time, instead of retrieving all of them at once like GetData
+  - read it by calling Next until it returns false (then check Err), using Row or Scan on every row in between
+  - holds the lock of the database it reads from until closed (or until Next returns false), so other methods using it will block in the meantime
+  - always Close a cursor you stop reading before Next returns false
+*/
+type Cursor struct {
+	ctx     context.Context
+	src     *DataSrc
+	memheld bool //whether this cursor holds the memory lock (true) or the disk lock (false)
+	rows    *sqlx.Rows
+
+	err    error
+	closed bool
+}
+
+// tries to return a cursor over rows of <rt> (on-disk), selected the same way as in GetData (without the dd column)
+func (rt *Rtable) Cursor(index int, count int, condarr []Condition, ordarr []Order) (*Cursor, error) {
+	return rt.CursorContext(context.Background(), index, count, condarr, ordarr)
+}
+
+// same as Cursor, but gives up once <ctx> is done (-> ctx.Err()), this includes reading rows from the returned cursor
+func (rt *Rtable) CursorContext(ctx context.Context, index int, count int, condarr []Condition, ordarr []Order) (*Cursor, error) {
+	if !rt.valid() {
+		return nil, ErrInvalidTable
+	}
+
+	return rt.cursor(ctx, false, index, count, condarr, ordarr)
+}
+
+// tries to return a cursor over rows of <rt>'s in-memory version, selected the same way as in GetMemData (without the dd column)
+func (rt *Rtable) MemCursor(index int, count int, condarr []Condition, ordarr []Order) (*Cursor, error) {
+	return rt.MemCursorContext(context.Background(), index, count, condarr, ordarr)
+}
+
+// same as MemCursor, but gives up once <ctx> is done (-> ctx.Err()), this includes reading rows from the returned cursor
+func (rt *Rtable) MemCursorContext(ctx context.Context, index int, count int, condarr []Condition, ordarr []Order) (*Cursor, error) {
+	if !rt.valid() {
+		return nil, ErrInvalidTable
+	}
+	if rt.parent.mem == nil {
+		return nil, ErrNoMem
+	}
+
+	return rt.cursor(ctx, true, index, count, condarr, ordarr)
+}
+
+// tries to lock the disk (disk_or_mem false) or memory (true) of <rt>'s parent and open a cursor on it, the lock is only kept if this succeeds
+func (rt *Rtable) cursor(ctx context.Context, disk_or_mem bool, index int, count int, condarr []Condition, ordarr []Order) (cur *Cursor, err error) {
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := rt.parent.lock(ctx, !disk_or_mem, disk_or_mem)
+	if err != nil {
+		return nil, err
+	}
+	if disk_or_mem && !memheld { //memory was deleted in the meantime
+		return nil, ErrNoMem
+	}
+
+	db := rt.parent.db
+	if disk_or_mem {
+		db = rt.parent.mem
+	}
+
+	selcols := make([]string, 0, len(rt.cols)-rt.ddint)
+	for _, c := range rt.cols[rt.ddint:] {
+		selcols = append(selcols, "\""+c.name+"\"")
+	}
+	statement, subs, err := rt.selStatement(ctx, db, strings.Join(selcols, ", "), index, count, condarr, ordarr, false)
+	if err != nil {
+		rt.parent.unlock(!memheld, memheld)
+		return nil, err
+	}
+
+	rows, err := db.QueryxContext(ctx, statement, subs...)
+	if err != nil {
+		rt.parent.unlock(!memheld, memheld)
+		return nil, err
+	}
+
+	return &Cursor{ctx: ctx, src: rt.parent, memheld: memheld, rows: rows}, nil
+}
+
+// advances <cur> to the next row, returns false once there are no more rows (or on error -> Cursor.Err), at which point <cur> is closed
+func (cur *Cursor) Next() bool {
+	if (cur == nil) || cur.closed {
+		return false
+	}
+
+	if cur.rows.Next() {
+		return true
+	}
+
+	cur.err = ctxErr(cur.ctx, cur.rows.Err())
+	cur.Close()
+	return false
+}
+
+// tries to return the values of the current row of <cur>
+func (cur *Cursor) Row() ([]any, error) {
+	if (cur == nil) || cur.closed {
+		return []any{}, ErrBadData
+	}
+
+	row, err := cur.rows.SliceScan()
+	if err != nil {
+		return []any{}, ctxErr(cur.ctx, err)
+	}
+	return row, nil
+}
+
+// tries to copy the values of the current row of <cur> into <dest> (one per column, see sql.Rows.Scan)
+func (cur *Cursor) Scan(dest ...any) error {
+	if (cur == nil) || cur.closed {
+		return ErrBadData
+	}
+
+	return ctxErr(cur.ctx, cur.rows.Scan(dest...))
+}
+
+// returns the error (if any) which made Cursor.Next return false
+func (cur *Cursor) Err() error {
+	if cur == nil {
+		return nil
+	}
+	return cur.err
+}
+
+// closes <cur> and gives back the lock it holds (closing an already closed cursor does nothing)
+func (cur *Cursor) Close() (err error) {
+	if (cur == nil) || cur.closed {
+		return nil
+	}
+	cur.closed = true
+
+	err = cur.rows.Close()
+	cur.src.unlock(!cur.memheld, cur.memheld)
+	return err
+}
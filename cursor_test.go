@@ -0,0 +1,113 @@
+package dbops_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that cursors stream the same rows as GetData, and hold their lock only while open
+func TestCursor(t *testing.T) {
+
+	//init
+	var tts = []dbops.Table{{Name: "cur", Dd: true, Cols: []dbops.Col{{Name: "a a", Ext: "INTEGER", Pk: true},
+		{Name: "b b", Ext: "TEXT", Pk: false}}}}
+
+	src, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "cur.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+
+	tbl := src.GetRtable(tts[0].Name)
+	err = tbl.InsertData(dbops.Conf_abort, []any{1, "x", 2, "y", 3, "z"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.DeleteData([]dbops.Condition{{Cname: "a a", Op: dbops.Op_eq, Val: 2}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//the dd column and dd'd rows are left out
+	cur, err := tbl.Cursor(0, -1, []dbops.Condition{}, []dbops.Order{{Cname: "a a", Dir: true}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	var as []int64
+	var bs []string
+	for cur.Next() {
+		var a int64
+		var b string
+		err = cur.Scan(&a, &b)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		as, bs = append(as, a), append(bs, b)
+	}
+	if cur.Err() != nil {
+		t.Fatalf(cur.Err().Error())
+	}
+	if (len(as) != 2) || (as[0] != 1) || (as[1] != 3) || (bs[0] != "x") || (bs[1] != "z") {
+		t.Fatalf("unexpected rows %v %v", as, bs)
+	}
+
+	//while a cursor is open, its lock is held
+	cur, err = tbl.Cursor(0, 1, []dbops.Condition{}, []dbops.Order{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !cur.Next() {
+		t.Fatalf("expected a row")
+	}
+	row, err := cur.Row()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(row) != 2 {
+		t.Fatalf("unexpected row %v", row)
+	}
+
+	tctx, tcancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer tcancel()
+	if tbl.CountContext(tctx) != -1 {
+		t.Fatalf("lock was not held by the open cursor")
+	}
+
+	//closing gives it back
+	err = cur.Close()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tbl.Count() != 3 {
+		t.Fatalf("unexpected row count after closing")
+	}
+
+	//memory works the same way
+	err = src.CreateMem()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.LoadIntoMem(0, -1, dbops.Conf_abort, []dbops.Condition{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cur, err = tbl.MemCursor(0, -1, []dbops.Condition{{Cname: "a a", Op: dbops.Op_more, Val: 1}}, []dbops.Order{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	n := 0
+	for cur.Next() {
+		n++
+	}
+	if (cur.Err() != nil) || (n != 1) {
+		t.Fatalf("unexpected in-memory rows %d (%v)", n, cur.Err())
+	}
+	if tbl.CountMem() != 3 {
+		t.Fatalf("memory lock was not given back")
+	}
+}
@@ -1,18 +1,20 @@
 package dbops
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 /*
@@ -51,11 +53,16 @@ type Table struct {
 	Name string
 	Dd   bool
 	Cols []Col
+
+	Indexes     []Index      //indexes of the table (nil -> none)
+	ForeignKeys []ForeignKey //references to other tables (nil -> none)
+
+	Fts bool //whether its TEXT columns are indexed for Rtable.Search (needs SQLite with FTS5, e.g. go-sqlite3 built with the tag sqlite_fts5, and a primary key of one INTEGER column)
 }
 
 type Col struct {
 	Name string //Name (any string you want)
-	Ext  string //Datatype ("TEXT", "INTEGER DEFAULT 0 NOT NULL", etc...)
+	Ext  string //Datatype ("TEXT", "INTEGER DEFAULT 0 NOT NULL", etc..., or ColDef.Ext()), without PRIMARY KEY or REFERENCES
 	Pk   bool   //Whether this column is a part of the Primary Key
 }
 
@@ -73,7 +80,10 @@ type Rtable struct {
 
 	parent *DataSrc //the data source this Rtable belongs to
 
-	cols []rcol
+	cols    []rcol
+	indexes []rindex
+	fkeys   []rfkey
+	fts     bool
 }
 
 type DataSrc struct {
@@ -85,23 +95,37 @@ type DataSrc struct {
 	mem  *sqlx.DB
 
 	rtables []*Rtable
+	rviews  []*Rview
+	maxvars int //the most variables ("?") a single statement can have, as read from the disk connection (memory is of the same SQLite)
+
+	wb *writeBack //nil unless in write-back mode
+	rc *readCache //nil unless in read-through mode
 }
 
 // column that will be created/present if Rtable.dd == true ; will always be leftmost in Rtable.cols
 var orgDdCol = rcol{name: "verIndex", ext: "INTEGER DEFAULT 0 NOT NULL", pk: false}
 
+/*
+a condition which must be true for a row to be selected, conditions in a []Condition are joined left to right by Lrel
+  - if Sub is not nil, this condition is a bracketed group of the conditions in Sub (Cname, Op and Val are ignored), this allows nesting, e.g.
+    a == 1 AND (b == 2 OR c == 3) -> {{Cname: "a", Op: Op_eq, Val: 1}, {Lrel: true, Sub: []Condition{{Cname: "b", Op: Op_eq, Val: 2}, {Cname: "c", Op: Op_eq, Val: 3}}}}
+*/
 type Condition struct {
 	Ljoin bool //whether to put brackets around all preceding conditions
 	Lrel  bool //false = or | true = and
 
+	Tname string //table name, qualifying Cname in a JoinQuery ("" -> unqualified)
 	Cname string //column name (unchecked string literal)
 	Op    operator
-	Val   any //value to compare to (parsed by sqlx)
+	Val   any //value to compare to (parsed by sqlx); a slice for Op_in/Op_notin, a slice of 2 (low, high) for Op_between/Op_notbetween, ignored for Op_isnull/Op_notnull
+
+	Sub []Condition //conditions of a nested group (must not be empty if not nil)
 }
 
 var orgDdColIs0 Condition = Condition{Ljoin: true, Lrel: true, Cname: orgDdCol.name, Op: Op_eq, Val: 0}
 
 type Order struct {
+	Tname  string //table name, qualifying Cname in a JoinQuery ("" -> unqualified)
 	Cname  string //column name
 	Dir    bool   //ordering direction (false = descending | true = ascending)
 	Nullwh bool   //null value location (false = last | true = first)
@@ -114,14 +138,28 @@ const (
 	Op_eq  operator = " == " //equal
 	Op_neq operator = " != " //not equal
 
-	Op_is    operator = " IS NOT DISTICT FROM " //equal, but will match two "NULL"(s)
-	Op_isnot operator = " IS DISTINCT FROM "    //not equal, but will consider two "NULL"(s) equal
+	Op_is    operator = " IS NOT DISTINCT FROM " //equal, but will match two "NULL"(s)
+	Op_isnot operator = " IS DISTINCT FROM "     //not equal, but will consider two "NULL"(s) equal
 
 	Op_less operator = " < " //less than
 	Op_more operator = " > " //more than
 
 	Op_eqless operator = " <= " //less than or equal
 	Op_eqmore operator = " >= " //more than or equal
+
+	Op_in    operator = " IN "     //equal to any value of the list
+	Op_notin operator = " NOT IN " //not equal to any value of the list
+
+	Op_like    operator = " LIKE "     //matches the pattern (% and _ wildcards, case-insensitive for ASCII)
+	Op_notlike operator = " NOT LIKE " //does not match the pattern
+	Op_glob    operator = " GLOB "     //matches the pattern (unix * ? [...] wildcards, case-sensitive)
+	Op_notglob operator = " NOT GLOB " //does not match the pattern
+
+	Op_between    operator = " BETWEEN "     //within the inclusive range
+	Op_notbetween operator = " NOT BETWEEN " //outside the inclusive range
+
+	Op_isnull  operator = " IS NULL"     //is NULL
+	Op_notnull operator = " IS NOT NULL" //is not NULL
 )
 
 type conflict_behaviour string //constants begin with "conf_"; conf_rollback, conf_abort and conf_fail result in one of the sqlite.ErrConstraint...... errors on activation
@@ -150,17 +188,17 @@ func rtEqual(t *Rtable, t2 *Rtable) bool {
 	}
 
 	if (t.dd && t2.dd) || (!t.dd && !t2.dd) {
-		return slices.Equal(t.cols, t2.cols)
+		return slices.EqualFunc(t.cols, t2.cols, rcolEqual)
 
 	} else if t.dd {
-		return slices.Equal(t.cols[1:], t2.cols)
+		return slices.EqualFunc(t.cols[1:], t2.cols, rcolEqual)
 
 	} else { //-> t2.dd == true
-		return slices.Equal(t2.cols[1:], t.cols)
+		return slices.EqualFunc(t2.cols[1:], t.cols, rcolEqual)
 	}
 }
 
-// Checks if two tables are exactly equal in all fields except <t>.parent (nil and nil will not be equal)
+// Checks if two tables are exactly equal in all fields except <t>.parent, columns compared as in ColDef.Equal (nil and nil will not be equal)
 func rtStrictEqual(t *Rtable, t2 *Rtable) bool {
 	if (t == nil) || (t2 == nil) {
 		return false
@@ -168,16 +206,16 @@ func rtStrictEqual(t *Rtable, t2 *Rtable) bool {
 	if t.name != t2.name {
 		return false
 	}
-	if t.dd != t2.dd {
+	if (t.dd != t2.dd) || (t.fts != t2.fts) {
 		return false
 	}
 
-	return slices.Equal(t.cols, t2.cols)
+	return slices.EqualFunc(t.cols, t2.cols, rcolEqual) && slices.EqualFunc(t.indexes, t2.indexes, rindexEqual) && slices.EqualFunc(t.fkeys, t2.fkeys, rfkeyEqual)
 }
 
 func pubPriColEqual(c Col, rc rcol) bool {
 	if (c.Name != rc.name) ||
-		(c.Ext != rc.ext) ||
+		!extEqual(c.Ext, rc.ext) ||
 		(c.Pk != rc.pk) {
 		return false
 	}
@@ -189,7 +227,11 @@ func (t Table) equal(rt *Rtable) bool {
 	if rt == nil {
 		return false
 	}
-	if t.Name != rt.name {
+	if (t.Name != rt.name) || (t.Fts != rt.fts) {
+		return false
+	}
+
+	if !slices.EqualFunc(t.Indexes, rt.indexes, pubPriIdxEqual) || !slices.EqualFunc(t.ForeignKeys, rt.fkeys, pubPriFkEqual) {
 		return false
 	}
 
@@ -201,7 +243,7 @@ func (t Table) equal(rt *Rtable) bool {
 }
 
 func (t Table) valid() bool {
-	if t.Name == "" {
+	if (t.Name == "") || (t.Name == LogTableName) {
 		return false
 	}
 	if (len(t.Cols) == 0) && (!t.Dd) {
@@ -217,10 +259,31 @@ func (t Table) valid() bool {
 		if cnameset.has(c.Name) {
 			return false
 		}
-		//I should probably also check if c.Ext is valid, buuut...https://www.sqlite.org/syntax/column-constraint.html
+		if _, extra, err := parseColDef(c.Ext); (err != nil) || extra { //the primary key and foreign keys are declared by Col.Pk and Table.ForeignKeys
+			return false
+		}
 
 		cnameset[c.Name] = empty{}
 	}
+
+	if t.Dd {
+		cnameset[orgDdCol.name] = empty{}
+	}
+	inameset := make(stringset, len(t.Indexes))
+	for _, idx := range t.Indexes {
+		if !idx.valid(cnameset) || inameset.has(idx.Name) {
+			return false
+		}
+		inameset[idx.Name] = empty{}
+	}
+	for _, fk := range t.ForeignKeys {
+		if !fk.valid(cnameset) {
+			return false
+		}
+	}
+	if t.Fts && !ftsValid(t.rtable(nil).cols) {
+		return false
+	}
 	return true
 }
 
@@ -241,15 +304,94 @@ func (rt *Rtable) ToTable() Table {
 
 	t.Name = rt.name
 	t.Dd = rt.dd
+	t.Fts = rt.fts
 
 	t.Cols = make([]Col, len(rt.cols)-rt.ddint)
 	for i, c := range rt.cols[rt.ddint:] {
 		t.Cols[i] = Col{Name: c.name, Ext: c.ext, Pk: c.pk}
 	}
 
+	for _, ridx := range rt.indexes {
+		t.Indexes = append(t.Indexes, ridx.pub())
+	}
+	for _, rfk := range rt.fkeys {
+		t.ForeignKeys = append(t.ForeignKeys, rfk.pub())
+	}
+
 	return t
 }
 
+// without validating <t>, converts it to an Rtable belonging to <parent>
+func (t Table) rtable(parent *DataSrc) *Rtable {
+	rt := Rtable{name: t.Name, dd: t.Dd, fts: t.Fts, parent: parent}
+	if rt.dd {
+		rt.ddint = 1
+	}
+
+	rt.cols = make([]rcol, len(t.Cols)+rt.ddint)
+	if rt.dd {
+		rt.cols[0] = orgDdCol
+	}
+
+	for i, c := range t.Cols {
+		rt.cols[i+rt.ddint] = rcol{name: c.Name, ext: c.Ext, pk: c.Pk}
+	}
+	for _, idx := range t.Indexes {
+		rt.indexes = append(rt.indexes, idx.rindex())
+	}
+	for _, fk := range t.ForeignKeys {
+		rt.fkeys = append(rt.fkeys, fk.rfkey())
+	}
+	return &rt
+}
+
+/*
+tries to take the locks of <src> (<disk> -> dlock, <mem> -> memlock, if <src> has an in-memory database)
+  - gives up once <ctx> is done, giving back anything already taken, and returns ctx.Err()
+  - returns whether memlock was taken (to be passed to unlock)
+*/
+func (src *DataSrc) lock(ctx context.Context, disk bool, mem bool) (memheld bool, err error) {
+	if disk {
+		select {
+		case <-src.dlock:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+
+	if mem && (src.mem != nil) {
+		select {
+		case <-src.memlock:
+		case <-ctx.Done():
+			if disk {
+				src.dlock <- true
+			}
+			return false, ctx.Err()
+		}
+		memheld = true
+	}
+
+	return memheld, nil
+}
+
+// gives back the locks of <src> taken by lock
+func (src *DataSrc) unlock(disk bool, memheld bool) {
+	if disk {
+		src.dlock <- true
+	}
+	if memheld {
+		src.memlock <- true
+	}
+}
+
+// returns ctx.Err() if <ctx> is done (in which case <err> was most likely caused by it), otherwise <err>
+func ctxErr(ctx context.Context, err error) error {
+	if (err != nil) && (ctx.Err() != nil) {
+		return ctx.Err()
+	}
+	return err
+}
+
 // -------------------- OPERATIONS REGARDING DATA SOURCES --------------------
 
 // tries to create a database at <path> (will not overwrite), adds <tables> to it, and returns a handle to it
@@ -274,24 +416,8 @@ func CreateSrc(path string, tables []Table) (*DataSrc, error) {
 	for i, t := range tables {
 		if !t.valid() {
 			return nil, ErrInvalidTable
-		} //convert Table -> Rtable
-
-		new_rt := Rtable{name: t.Name, dd: t.Dd}
-		if new_rt.dd {
-			new_rt.ddint = 1
-		}
-
-		new_rt.cols = make([]rcol, len(t.Cols)+new_rt.ddint)
-		if new_rt.dd {
-			new_rt.cols[0] = orgDdCol
-		}
-
-		for i, c := range t.Cols {
-			new_rt.cols[i+new_rt.ddint] = rcol{name: c.Name, ext: c.Ext, pk: c.Pk}
 		}
-
-		new_rt.parent = &src
-		src.rtables[i] = &new_rt
+		src.rtables[i] = t.rtable(&src)
 	}
 
 	err = os.MkdirAll(dirpath, 0700)
@@ -299,17 +425,22 @@ func CreateSrc(path string, tables []Table) (*DataSrc, error) {
 		return nil, err
 	}
 
-	src.db, err = sqlx.Connect("sqlite3", path)
+	src.db, err = sqlx.Connect("sqlite3", fkDSN(path))
 	if err != nil {
 		return nil, err
 	}
 	src.path = path
+	src.maxvars, err = varLimit(src.db)
+	if err != nil {
+		return nil, err
+	}
 
 	for _, rt := range src.rtables {
-		statement := rt.crStatement()
-		_, err = src.db.Exec(statement)
-		if err != nil {
-			return nil, err
+		for _, statement := range rt.crStatements() {
+			_, err = src.db.Exec(statement)
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 
@@ -332,17 +463,25 @@ func ConnectSrc(path string, seekOwn bool) (*DataSrc, error) {
 		return nil, ErrIsNotDatabase
 	}
 
-	src.db, err = sqlx.Connect("sqlite3", path)
+	src.db, err = sqlx.Connect("sqlite3", fkDSN(path))
 	if err != nil {
 		return nil, err
 	}
 	src.path = path
+	src.maxvars, err = varLimit(src.db)
+	if err != nil {
+		return nil, err
+	}
 
 	tables, err := src.realTables(false, seekOwn)
 	if err != nil {
 		return nil, err
 	}
 	src.rtables = tables
+	src.rviews, err = src.readViews(src.db)
+	if err != nil {
+		return nil, err
+	}
 
 	src.dlock = make(chan bool, 1)
 	src.dlock <- true
@@ -369,85 +508,146 @@ func (src *DataSrc) realTables(disk_or_mem bool, seekOwn bool) (tables []*Rtable
 		db = src.db
 	}
 
-	var tblname_list []string
-	err = db.Select(&tblname_list, "SELECT name FROM sqlite_master WHERE type=\"table\";")
+	return src.readTables(db, seekOwn)
+}
+
+// without locking, does what realTables does, on <db> (the main schema of a database of <src>, or a transaction on it)
+func (src *DataSrc) readTables(db sqlx.Queryer, seekOwn bool) (tables []*Rtable, err error) {
+	type master struct {
+		Name      string `db:"name"`
+		Statement string `db:"sql"`
+	}
+	var tbl_list []master
+	err = sqlx.Select(db, &tbl_list, "SELECT name, sql FROM sqlite_master WHERE type=\"table\" AND name NOT LIKE 'sqlite\\_%' ESCAPE '\\';") //not internal ones, e.g. sqlite_sequence
 	if err != nil {
 		return tables, err
 	}
 
-	for _, tablename := range tblname_list {
-		cols, err := db.Queryx(fmt.Sprintf("PRAGMA table_info(\"%s\");", tablename))
+	statements := make(map[string]string, len(tbl_list))
+	for _, mtbl := range tbl_list {
+		statements[mtbl.Name] = mtbl.Statement
+	}
+	fts, ftsskip := ftsTables(statements)
+
+	for _, mtbl := range tbl_list {
+		tablename := mtbl.Name
+		if seekOwn && (tablename == LogTableName) {
+			continue
+		} //the log table is not a table of <src>
+		if ftsskip.has(tablename) {
+			continue
+		} //neither is an index for Search
+
+		cols, err := db.Queryx(fmt.Sprintf("PRAGMA table_xinfo(\"%s\");", tablename)) //unlike table_info, includes generated columns
 		if err != nil {
 			return tables, err
 		}
-		defer cols.Close()
 
-		tbl := Rtable{parent: src, name: tablename}
+		coldefs := colDefTexts(mtbl.Statement)
+		tbl := Rtable{parent: src, name: tablename, fts: fts.has(tablename)}
 		e := 0
 		for cols.Next() {
 			var index int
 			var name string
 			var datatype string
-			var allows_null bool
+			var not_null bool
 			var default_value sql.NullString
 			var pk int
+			var hidden int
 
-			err := cols.Scan(&index, &name, &datatype, &allows_null, &default_value, &pk)
+			err := cols.Scan(&index, &name, &datatype, &not_null, &default_value, &pk, &hidden)
 			if err != nil {
+				cols.Close()
 				return tables, err
 			}
-
-			var extra_props string
-			if default_value.Valid {
-				extra_props += " DEFAULT " + default_value.String
-			}
-			if allows_null {
-				extra_props += " NOT NULL"
+			if hidden == 1 { //a hidden column of a virtual table
+				continue
 			}
 
-			rcol := rcol{name: name, ext: datatype + extra_props}
+			rcol := rcol{name: name, ext: colExt(coldefs, name, datatype, not_null, default_value)}
 			if pk != 0 {
 				rcol.pk = true
 			}
 
 			//checks for a DeltaDelete rcol
-			if seekOwn && (rcol == orgDdCol) {
+			if seekOwn && rcolEqual(rcol, orgDdCol) {
 				tbl.dd = true
 				tbl.ddint = 1
+				rcol = orgDdCol
 			}
 
 			tbl.cols = append(tbl.cols, rcol)
 			e++
 		}
+		cols.Close()
+
+		tbl.indexes, err = readIndexes(db, tablename)
+		if err != nil {
+			return tables, err
+		}
+		tbl.fkeys, err = readFkeys(db, tablename)
+		if err != nil {
+			return tables, err
+		}
 		tables = append(tables, &tbl)
 	}
 	return tables, nil
 }
 
+/*
+returns the Col.Ext of the column named <name>, as written in <coldefs> (see colDefTexts)
+  - constraints a Col.Ext cannot hold (PRIMARY KEY, REFERENCES ...) are left out (as they are read as Col.Pk and Table.ForeignKeys)
+  - if its definition is missing or cannot be parsed, it is made of what PRAGMA table_info reports (<datatype>, <not_null>, <default_value>)
+*/
+func colExt(coldefs map[string]string, name string, datatype string, not_null bool, default_value sql.NullString) string {
+	text, ok := coldefs[name]
+	if ok {
+		def, extra, err := parseColDef(text)
+		switch {
+		case err != nil:
+		case extra:
+			return def.Ext()
+		default:
+			return text
+		}
+	}
+
+	def := ColDef{Type: datatype, NotNull: not_null, Default: default_value.String}
+	return def.Ext()
+}
+
 // invalidates <src>, tries to properly free all of its resources
 func (src *DataSrc) Disconnect() (err error) {
+	return src.DisconnectContext(context.Background())
+}
+
+// same as Disconnect, but gives up waiting for <src>'s locks once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) DisconnectContext(ctx context.Context) (err error) {
 	if src == nil {
 		return ErrNilSource
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() { <-src.dlock; wg.Done() }()
-	go func() {
-		if src.mem != nil {
-			<-src.memlock
+	memheld, err := src.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+
+	if src.wb != nil { //do not lose unflushed changes
+		err = src.wbDisable(ctx, true)
+		if err != nil {
+			src.unlock(true, memheld)
+			return err
 		}
-		wg.Done()
-	}()
-	wg.Wait()
+	}
 
+	var wg sync.WaitGroup
 	delfunc := func(db *sqlx.DB, errout chan error) {
 		defer wg.Done()
 		if db == nil {
 			return
 		}
 
-		err = src.db.Close()
+		err := db.Close()
 		if err != nil {
 			errout <- err
 			return
@@ -468,7 +668,12 @@ func (src *DataSrc) Disconnect() (err error) {
 }
 
 // tries to create <t> in <src>
-func (src *DataSrc) AddTable(t Table) error {
+func (src *DataSrc) AddTable(t Table) (err error) {
+	return src.AddTableContext(context.Background(), t)
+}
+
+// same as AddTable, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) AddTableContext(ctx context.Context, t Table) (err error) {
 	if src == nil {
 		return ErrNilSource
 	}
@@ -476,23 +681,15 @@ func (src *DataSrc) AddTable(t Table) error {
 		return ErrInvalidTable
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() { <-src.dlock; wg.Done() }()
-	go func() {
-		if src.mem != nil {
-			<-src.memlock
-		}
-		wg.Done()
-	}()
-	wg.Wait()
+	defer func() { err = ctxErr(ctx, err) }()
 
-	defer func() {
-		src.dlock <- true
-		if src.mem != nil {
-			src.memlock <- true
-		}
-	}()
+	memheld, err := src.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer src.unlock(true, memheld)
+
+	var wg sync.WaitGroup
 
 	if !t.valid() {
 		return ErrInvalidTable
@@ -503,22 +700,12 @@ func (src *DataSrc) AddTable(t Table) error {
 		}
 	}
 
-	//convert Table -> Rtable
-	new_rt := Rtable{name: t.Name, dd: t.Dd}
-	if new_rt.dd {
-		new_rt.ddint = 1
-	}
-
-	new_rt.cols = make([]rcol, len(t.Cols)+new_rt.ddint)
-	if new_rt.dd {
-		new_rt.cols[0] = orgDdCol
-	}
-
-	for i, c := range t.Cols {
-		new_rt.cols[i+new_rt.ddint] = rcol{name: c.Name, ext: c.Ext, pk: c.Pk}
-	}
+	new_rt := t.rtable(src)
+	if (src.wb != nil) && (len(new_rt.pkList("")) == 0) {
+		return ErrBadData
+	} //write-back mode needs a primary key
 
-	statement := new_rt.crStatement()
+	statements := new_rt.crStatements()
 
 	addfunc := func(db *sqlx.DB, errout chan error) {
 		defer wg.Done()
@@ -526,7 +713,15 @@ func (src *DataSrc) AddTable(t Table) error {
 			return
 		}
 
-		_, err := src.db.Exec(statement)
+		err := inTx(ctx, db, func(tx *sqlx.Tx) error {
+			for _, statement := range statements {
+				_, err := tx.ExecContext(ctx, statement)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
 		if err != nil {
 			errout <- err
 			return
@@ -542,14 +737,24 @@ func (src *DataSrc) AddTable(t Table) error {
 		return <-errin
 	}
 
-	new_rt.parent = src
-	src.rtables = append(src.rtables, &new_rt)
+	src.rtables = append(src.rtables, new_rt)
 
+	if src.wb != nil {
+		return new_rt.wbInstall(ctx, src.mem)
+	}
 	return nil
 }
 
-// tries to delete <t> in <src>
-func (src *DataSrc) DelTable(rt *Rtable) error {
+/*
+tries to delete <t> in <src>, along with its index for Search
+  - views reading <t> (see AddView) -> ErrViewDepends
+*/
+func (src *DataSrc) DelTable(rt *Rtable) (err error) {
+	return src.DelTableContext(context.Background(), rt)
+}
+
+// same as DelTable, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) DelTableContext(ctx context.Context, rt *Rtable) (err error) {
 	if src == nil {
 		return ErrNilSource
 	}
@@ -557,23 +762,15 @@ func (src *DataSrc) DelTable(rt *Rtable) error {
 		return ErrInvalidTable
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() { <-src.dlock; wg.Done() }()
-	go func() {
-		if src.mem != nil {
-			<-src.memlock
-		}
-		wg.Done()
-	}()
-	wg.Wait()
+	defer func() { err = ctxErr(ctx, err) }()
 
-	defer func() {
-		src.dlock <- true
-		if src.mem != nil {
-			src.memlock <- true
-		}
-	}()
+	memheld, err := src.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer src.unlock(true, memheld)
+
+	var wg sync.WaitGroup
 
 	if !(rt.parent == src) {
 		return ErrIsNotPresent
@@ -586,6 +783,19 @@ func (src *DataSrc) DelTable(rt *Rtable) error {
 			break
 		}
 	}
+	if len(src.dependentViews(rt.name)) != 0 {
+		return ErrViewDepends
+	}
+
+	if src.wb != nil {
+		err = rt.wbUninstall(ctx, src.mem)
+		if err != nil {
+			return err
+		}
+	}
+	if src.rc != nil {
+		src.rc.drop(rt.name)
+	}
 
 	dropfunc := func(db *sqlx.DB, errout chan error) {
 		defer wg.Done()
@@ -593,11 +803,25 @@ func (src *DataSrc) DelTable(rt *Rtable) error {
 			return
 		}
 
-		_, err := db.Exec("DROP TABLE \"main\".\"" + rt.name + "\";")
+		_, err := db.ExecContext(ctx, "DROP TABLE \"main\".\""+rt.name+"\";")
+		if (err == nil) && rt.fts {
+			_, err = db.ExecContext(ctx, rt.ftsDrop())
+		}
 		if err != nil {
 			errout <- err
 			return
 		}
+
+		if rt.dd && (db == src.db) { //forget its deletions, a new table of the same name should not inherit them
+			err = ensureLog(ctx, db)
+			if err == nil {
+				_, err = db.ExecContext(ctx, "DELETE FROM \"main\".\""+LogTableName+"\" WHERE \"table\" = ?;", rt.name)
+			}
+			if err != nil {
+				errout <- err
+				return
+			}
+		}
 	}
 
 	errin := make(chan error, 2)
@@ -625,12 +849,13 @@ func (t *Rtable) crStatement() (statement string) {
 		}
 	}
 
-	if len(pkdefs) == 0 {
-		return "CREATE TABLE \"" + t.name + "\"(" + strings.Join(coldefs, ", ") + ");"
-	} else {
-		return "CREATE TABLE \"" + t.name + "\"(" + strings.Join(coldefs, ", ") + ", PRIMARY KEY(" + strings.Join(pkdefs, ", ") + "));"
+	if len(pkdefs) != 0 {
+		coldefs = append(coldefs, "PRIMARY KEY("+strings.Join(pkdefs, ", ")+")")
 	}
-
+	for _, rfk := range t.fkeys {
+		coldefs = append(coldefs, rfk.clause())
+	}
+	return "CREATE TABLE \"" + t.name + "\"(" + strings.Join(coldefs, ", ") + ");"
 }
 
 // tries to create an in-memory datbase for <src> (does nothing if it already exists)
@@ -643,14 +868,22 @@ func (src *DataSrc) CreateMem() (err error) {
 		return nil
 	}
 
-	src.mem, err = sqlx.Connect("sqlite3", ":memory:")
+	src.mem, err = sqlx.Connect("sqlite3", fkDSN(":memory:"))
 	if err != nil {
 		return err
 	}
+	src.mem.SetMaxOpenConns(1) //every new connection would open a different (empty) in-memory database
 
 	for _, tbl := range src.rtables {
-		statement := tbl.crStatement()
-		_, err := src.mem.Exec(statement)
+		for _, statement := range tbl.crStatements() {
+			_, err := src.mem.Exec(statement)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, rv := range src.rviews { //in the order they were created, as one can read another
+		_, err := src.mem.Exec("CREATE VIEW \"" + rv.name + "\" AS " + rv.query + ";")
 		if err != nil {
 			return err
 		}
@@ -663,42 +896,21 @@ func (src *DataSrc) CreateMem() (err error) {
 
 // tries to insert (or <cbh>) all rows of <src>'s in-memory database into disk
 func (src *DataSrc) SaveMem(cbh conflict_behaviour) (err error) {
-	if src == nil {
-		return ErrNilSource
-	}
-	if src.mem == nil {
-		return ErrNoMem
-	}
-
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() { <-src.dlock; wg.Done() }()
-	go func() { <-src.memlock; wg.Done() }()
-	wg.Wait()
-
-	defer func() {
-		src.dlock <- true
-		src.memlock <- true
-	}()
-
-	_, err = src.mem.Exec("ATTACH DATABASE \"" + src.path + "\" AS \"disk\";")
-	if err != nil {
-		return err
-	}
-	defer src.mem.Exec("DETACH DATABASE \"disk\";")
-
-	for _, t := range src.rtables {
+	return src.SaveMemContext(context.Background(), cbh)
+}
 
-		_, err = src.mem.Exec("INSERT OR " + string(cbh) + " INTO \"disk\".\"" + t.name + "\" SELECT * FROM \"main\".\"" + t.name + "\";")
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+// same as SaveMem, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) SaveMemContext(ctx context.Context, cbh conflict_behaviour) (err error) {
+	return src.SaveMemUpsertContext(ctx, nil, cbh)
 }
 
 // tries to delete <src>'s in-memory database (without saving)
 func (src *DataSrc) DeleteMem() (err error) {
+	return src.DeleteMemContext(context.Background())
+}
+
+// same as DeleteMem, but gives up waiting for <src>'s memlock once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) DeleteMemContext(ctx context.Context) (err error) {
 	if src == nil {
 		return ErrNilSource
 	}
@@ -706,7 +918,16 @@ func (src *DataSrc) DeleteMem() (err error) {
 		return ErrNoMem
 	}
 
-	<-src.memlock
+	_, err = src.lock(ctx, false, true)
+	if err != nil {
+		return err
+	}
+
+	if src.wb != nil { //unflushed changes are lost with the memory
+		src.wb.cancel()
+		src.wb = nil
+	}
+	src.rc = nil
 
 	err = src.mem.Close()
 	if err != nil {
@@ -719,22 +940,22 @@ func (src *DataSrc) DeleteMem() (err error) {
 
 // forces other methods of <src> to block until you <src>.Reclaim() it, but exposes you its underlying database handles
 func (src *DataSrc) Release() (disk *sqlx.DB, mem *sqlx.DB) {
+	disk, mem, _ = src.ReleaseContext(context.Background())
+	return disk, mem
+}
+
+// same as Release, but gives up waiting for <src>'s locks once <ctx> is done (-> nil handles, ctx.Err())
+func (src *DataSrc) ReleaseContext(ctx context.Context) (disk *sqlx.DB, mem *sqlx.DB, err error) {
 	if src == nil {
-		return nil, nil
+		return nil, nil, ErrNilSource
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() { <-src.dlock; wg.Done() }()
-	go func() {
-		if src.mem != nil {
-			<-src.memlock
-		}
-		wg.Done()
-	}()
-	wg.Wait()
+	_, err = src.lock(ctx, true, true)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return src.db, src.mem
+	return src.db, src.mem, nil
 }
 
 /*
@@ -759,6 +980,9 @@ func (src *DataSrc) Reclaim(noreload bool, seekOwn bool) error {
 		go func() {
 			defer wg.Done() //gen disk structure
 			src.rtables, derr = src.realTables(false, seekOwn)
+			if derr == nil {
+				src.rviews, derr = src.readViews(src.db)
+			}
 		}()
 
 		go func() {
@@ -794,20 +1018,28 @@ tries to insert (or <cbh>) all rows of all tables in <src> into their counterpar
   - operates on-disk only
 */
 func (dest *DataSrc) FetchAllFrom(src *DataSrc, cbh conflict_behaviour, mustAll bool) (err error) {
+	return dest.FetchAllFromContext(context.Background(), src, cbh, mustAll)
+}
+
+// same as FetchAllFrom, but gives up once <ctx> is done (-> ctx.Err())
+func (dest *DataSrc) FetchAllFromContext(ctx context.Context, src *DataSrc, cbh conflict_behaviour, mustAll bool) (err error) {
 	if (dest == nil) || (src == nil) {
 		return ErrNilSource
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() { <-src.dlock; wg.Done() }()
-	go func() { <-dest.dlock; wg.Done() }()
-	wg.Wait()
+	defer func() { err = ctxErr(ctx, err) }()
 
-	defer func() {
-		src.dlock <- true
-		dest.dlock <- true
-	}()
+	_, err = src.lock(ctx, true, false)
+	if err != nil {
+		return err
+	}
+	defer src.unlock(true, false)
+
+	_, err = dest.lock(ctx, true, false)
+	if err != nil {
+		return err
+	}
+	defer dest.unlock(true, false)
 
 	if mustAll && (len(dest.rtables) != len(src.rtables)) {
 		return ErrDiffStructure
@@ -837,7 +1069,7 @@ func (dest *DataSrc) FetchAllFrom(src *DataSrc, cbh conflict_behaviour, mustAll
 		tocpy = append(tocpy, rt)
 	}
 
-	_, err = dest.db.Exec("ATTACH DATABASE \"" + src.path + "\" AS \"src\";")
+	_, err = dest.db.ExecContext(ctx, "ATTACH DATABASE \""+src.path+"\" AS \"src\";")
 	if err != nil {
 		return err
 	}
@@ -861,7 +1093,7 @@ func (dest *DataSrc) FetchAllFrom(src *DataSrc, cbh conflict_behaviour, mustAll
 		}
 
 		jnd_cnames := strings.Join(colnames, ", ")
-		_, err := dest.db.Exec("INSERT OR " + string(cbh) + " INTO \"main\".\"" + srcrt.name + "\"(" + jnd_cnames + ") SELECT " + jnd_cnames + " FROM \"src\".\"" + srcrt.name + "\";")
+		_, err := dest.db.ExecContext(ctx, "INSERT OR "+string(cbh)+" INTO \"main\".\""+srcrt.name+"\"("+jnd_cnames+") SELECT "+jnd_cnames+" FROM \"src\".\""+srcrt.name+"\";")
 		if err != nil {
 			return err
 		}
@@ -954,38 +1186,156 @@ func (src *DataSrc) HasTable(t Table) bool {
 
 // -------------------- OPERATIONS REGARDING TABLES --------------------
 
-// tries to recreate <rt> (both disk and memory) with only <newcols>, while copying data from old columns (key) into new ones (value) according to <remap>
-func (rt *Rtable) Edit(newcols []Col, remap map[string]string) error {
+/*
+tries to recreate <rt> (both disk and memory) with only <newcols>, while copying data from old columns (key) into new ones (value) according to <remap>
+  - indexes and foreign keys of <rt> are kept (with their columns renamed), unless one of their columns is not copied
+  - rows of other tables referencing <rt> are kept as they are, a foreign key referencing a column which is gone -> ErrForeignKey
+  - views reading <rt> (see AddView) read the new table, a view naming a column which is gone (or renamed) -> ErrViewDepends
+*/
+func (rt *Rtable) Edit(newcols []Col, remap map[string]string) (err error) {
+	return rt.EditContext(context.Background(), newcols, remap)
+}
+
+// same as Edit, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) EditContext(ctx context.Context, newcols []Col, remap map[string]string) (err error) {
 	if !rt.valid() {
 		return ErrInvalidTable
 	}
 
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := rt.parent.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.unlock(true, memheld)
+
 	var wg sync.WaitGroup //it's possible to do the prep steps + free dlock before mem is actually finished, but it doesn't feel right...
-	wg.Add(2)
-	go func() { <-rt.parent.dlock; wg.Done() }()
-	go func() {
-		if rt.parent.mem != nil {
-			<-rt.parent.memlock
-		}
-		wg.Done()
-	}()
-	wg.Wait()
 
-	defer func() {
-		rt.parent.dlock <- true
-		if rt.parent.mem != nil {
-			rt.parent.memlock <- true
-		}
-	}()
+	nindexes, nfkeys := rt.remapIndexes(remap), rt.remapFkeys(remap)
+	ncols, statements, err := rt.editPlan(newcols, remap, nindexes, nfkeys, rt.fts)
+	if err != nil {
+		return err
+	}
+	if !refsKept(rt.parent.rtables, rt.name, ncols) {
+		return ErrForeignKey
+	}
+	views := rt.parent.dependentViews(rt.name)
+	if !rt.viewsKept(views, remap) {
+		return ErrViewDepends
+	}
 
-	//make a set of the old column names (used later)
-	orgset := make(stringset, len(rt.cols))
-	for _, orgrc := range rt.cols {
-		orgset[orgrc.name] = empty{}
+	wb := rt.parent.wb != nil
+	if wb {
+		if len((&Rtable{cols: ncols}).pkList("")) == 0 {
+			return ErrBadData
+		} //write-back mode needs a primary key
+
+		err = rt.parent.wbFlush(ctx, []*Rtable{rt})
+		if err == nil {
+			err = rt.wbUninstall(ctx, rt.parent.mem)
+		}
+		if err != nil {
+			return err
+		}
 	}
 
-	//validate the new columns, make a set of them, and prepare them for Rtable creation
-	ncols := make([]rcol, len(newcols)+rt.ddint)
+	edit_func := func(db *sqlx.DB, errout chan error) {
+		defer wg.Done()
+		if db == nil {
+			return
+		}
+
+		//dropping <rt> must not touch the rows referencing it, memory usually holds only some rows, so only disk is checked
+		err := fkOffTx(ctx, db, db == rt.parent.db, func(tx *sqlx.Tx) error {
+			for _, statement := range statements {
+				_, err := tx.ExecContext(ctx, statement)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			errout <- err
+			return
+		}
+	}
+
+	errin := make(chan error, 2)
+	wg.Add(2) //edit both memory and disk at the same time
+	go edit_func(rt.parent.db, errin)
+	go edit_func(rt.parent.mem, errin)
+	wg.Wait()
+	if len(errin) != 0 {
+		return <-errin
+	}
+
+	//in this order to make sure anything that takes over next has the right data
+	rt.cols = ncols
+	rt.indexes = nindexes
+	rt.fkeys = nfkeys
+	for _, rv := range views { //e.g. "SELECT *" now has other columns
+		rv.cols, _ = viewCols(rt.parent.db, rv.name)
+	}
+	if rt.parent.rc != nil { //the conditions of cached queries may not fit the new columns
+		rt.parent.rc.drop(rt.name)
+	}
+
+	if wb {
+		return rt.wbInstall(ctx, rt.parent.mem)
+	}
+	return nil
+}
+
+/*
+returns the indexes of <rt> with their columns renamed by <remap> (as in Edit), leaving out those with a column which is not copied
+  - partial indexes whose condition names (in quotes) a column which is not copied under the same name are left out as well
+*/
+func (rt *Rtable) remapIndexes(remap map[string]string) []rindex {
+	var nindexes []rindex
+	for _, ridx := range rt.indexes {
+		if ridx.where != "" && slices.ContainsFunc(rt.cols, func(c rcol) bool {
+			return (remap[c.name] != c.name) && (c.name != orgDdCol.name) && strings.Contains(ridx.where, "\""+c.name+"\"")
+		}) {
+			continue
+		}
+
+		nridx := ridx
+		nridx.cols = make([]string, len(ridx.cols))
+		for i, cname := range ridx.cols {
+			ncname, ok := remap[cname]
+			if cname == orgDdCol.name {
+				ncname, ok = cname, rt.dd
+			}
+			if !ok {
+				nridx.cols = nil
+				break
+			}
+			nridx.cols[i] = ncname
+		}
+
+		if nridx.cols != nil {
+			nindexes = append(nindexes, nridx)
+		}
+	}
+	return nindexes
+}
+
+/*
+without locking, tries to return the columns <rt> will have after Edit(<newcols>, <remap>), and the statements (to run in one transaction, without enforcing foreign keys) doing it
+  - the new table gets <nindexes> (the condition of a partial index is kept as is, so it must still fit the new columns) and <nfkeys>
+  - if <nfts>, it gets an index for Search as well, made anew from its rows (see Table.Fts)
+*/
+func (rt *Rtable) editPlan(newcols []Col, remap map[string]string, nindexes []rindex, nfkeys []rfkey, nfts bool) (ncols []rcol, statements []string, err error) {
+	//make a set of the old column names (used later)
+	orgset := make(stringset, len(rt.cols))
+	for _, orgrc := range rt.cols {
+		orgset[orgrc.name] = empty{}
+	}
+
+	//validate the new columns, make a set of them, and prepare them for Rtable creation
+	ncols = make([]rcol, len(newcols)+rt.ddint)
 	coldefs := make([]string, len(newcols)+rt.ddint)
 	var pkdefs []string
 	var i int = rt.ddint
@@ -998,12 +1348,14 @@ func (rt *Rtable) Edit(newcols []Col, remap map[string]string) error {
 
 	for _, newc := range newcols {
 		if newc.Name == "" {
-			return ErrInvalidTable
+			return nil, nil, ErrInvalidTable
+		}
+		if _, extra, err := parseColDef(newc.Ext); (err != nil) || extra {
+			return nil, nil, ErrInvalidTable
 		}
-		//I should probably check if Col.Ext is valid, buuut...https://www.sqlite.org/syntax/column-constraint.html
 
 		if newset.has(newc.Name) {
-			return ErrInvalidTable
+			return nil, nil, ErrInvalidTable
 		}
 		newset[newc.Name] = empty{}
 
@@ -1021,7 +1373,7 @@ func (rt *Rtable) Edit(newcols []Col, remap map[string]string) error {
 	i = 0
 	for orgcname, newcname := range remap {
 		if !orgset.has(orgcname) || !newset.has(newcname) {
-			return ErrIsNotPresent
+			return nil, nil, ErrIsNotPresent
 		}
 
 		sporgnames[i] = "\"" + orgcname + "\""
@@ -1039,87 +1391,61 @@ func (rt *Rtable) Edit(newcols []Col, remap map[string]string) error {
 	//TODO: add specifiers of into which columns to insert the values
 	var orgtransfer string = "INSERT INTO \"temp\".\"" + rt.name + "\"(" + strings.Join(spnewnames, ", ") + ") SELECT " + strings.Join(sporgnames, ", ") + " FROM \"main\".\"" + rt.name + "\";"
 
-	normcreate := "CREATE TABLE \"" + rt.name + "\" AS SELECT * FROM \"temp\".\"" + rt.name + "\";"
-
-	edit_func := func(db *sqlx.DB, errout chan error) {
-		defer wg.Done()
-		if db == nil {
-			return
-		}
-
-		tx, err := db.Beginx() //begin transaction
-		if err != nil {
-			errout <- err
-			return
+	normcreate := (&Rtable{name: rt.name, cols: ncols, fkeys: nfkeys}).crStatement() //keeps the primary key and column definitions (unlike CREATE TABLE AS)
+	for _, ridx := range nindexes {
+		if !ridx.pub().valid(newset) {
+			return nil, nil, ErrInvalidTable
 		}
-
-		_, err = tx.Exec(tempcreate) //create temp table
-		if err != nil {
-			tx.Rollback()
-			errout <- err
-			return
-		}
-
-		_, err = tx.Exec(orgtransfer) //move + reformat/retarget from old to temp
-		if err != nil {
-			tx.Rollback()
-			errout <- err
-			return
-		}
-
-		_, err = tx.Exec("DROP TABLE \"main\".\"" + rt.name + "\";") //drop old table
-		if err != nil {
-			tx.Rollback()
-			errout <- err
-			return
-		}
-
-		_, err = tx.Exec(normcreate) //create new table with data of temp
-		if err != nil {
-			tx.Rollback()
-			errout <- err
-			return
-		}
-
-		_, err = tx.Exec("DROP TABLE \"temp\".\"" + rt.name + "\";") //drop temp
-		if err != nil {
-			tx.Rollback()
-			errout <- err
-			return
-		}
-
-		err = tx.Commit() //end transaction
-		if err != nil {
-			errout <- err
-			return
+	}
+	for _, rfk := range nfkeys {
+		if !rfk.pub().valid(newset) {
+			return nil, nil, ErrInvalidTable
 		}
 	}
+	normtransfer := "INSERT INTO \"main\".\"" + rt.name + "\" SELECT * FROM \"temp\".\"" + rt.name + "\";"
 
-	errin := make(chan error, 2)
-	wg.Add(2) //edit both memory and disk at the same time
-	go edit_func(rt.parent.db, errin)
-	go edit_func(rt.parent.mem, errin)
-	wg.Wait()
-	if len(errin) != 0 {
-		return <-errin
+	statements = []string{tempcreate, //create temp table
+		orgtransfer, //move + reformat/retarget from old to temp
+		"DROP TABLE \"main\".\"" + rt.name + "\";", //drop old table
+		normcreate,   //create new table
+		normtransfer, //move data of temp to it
+		"DROP TABLE \"temp\".\"" + rt.name + "\";"} //drop temp
+	for _, ridx := range nindexes {
+		statements = append(statements, ridx.crStatement(rt.name)) //dropped along with the old table
 	}
 
-	//in this order to make sure anything that takes over next has the right data
-	rt.cols = ncols
-
-	return nil
+	if rt.fts { //the columns of the index may change, and the rowids of the rows it points to do
+		statements = append([]string{rt.ftsDrop()}, statements...)
+	}
+	if nfts {
+		nrt := &Rtable{name: rt.name, cols: ncols}
+		if !ftsValid(ncols) {
+			return nil, nil, ErrInvalidTable
+		}
+		statements = append(statements, nrt.ftsStatements()...)
+		statements = append(statements, "INSERT INTO \""+rt.name+ftsSuffix+"\"(\""+rt.name+ftsSuffix+"\") VALUES ('rebuild');")
+	}
+	return ncols, statements, nil
 }
 
 // tries to return the true number of rows (including dd'd) in <rt> (err -> -1)
 func (rt *Rtable) Count() (num int) {
+	return rt.CountContext(context.Background())
+}
+
+// same as Count, but gives up once <ctx> is done (-> -1)
+func (rt *Rtable) CountContext(ctx context.Context) (num int) {
 	if !rt.valid() {
 		return -1
 	}
 
-	<-rt.parent.dlock
-	defer func() { rt.parent.dlock <- true }()
+	_, err := rt.parent.lock(ctx, true, false)
+	if err != nil {
+		return -1
+	}
+	defer rt.parent.unlock(true, false)
 
-	err := rt.parent.db.Get(&num, "SELECT COUNT(*) FROM \"main\".\""+rt.name+"\";")
+	err = sqlx.GetContext(ctx, rt.parent.db, &num, "SELECT COUNT(*) FROM \"main\".\""+rt.name+"\";")
 	if err != nil {
 		return -1
 	}
@@ -1129,6 +1455,11 @@ func (rt *Rtable) Count() (num int) {
 
 // tries to return the true number of rows (including dd'd) in <rt>'s in-memory representation (err -> -1)
 func (rt *Rtable) CountMem() (num int) {
+	return rt.CountMemContext(context.Background())
+}
+
+// same as CountMem, but gives up once <ctx> is done (-> -1)
+func (rt *Rtable) CountMemContext(ctx context.Context) (num int) {
 	if !rt.valid() {
 		return -1
 	}
@@ -1136,10 +1467,13 @@ func (rt *Rtable) CountMem() (num int) {
 		return -1
 	}
 
-	<-rt.parent.memlock
-	defer func() { rt.parent.memlock <- true }()
+	_, err := rt.parent.lock(ctx, false, true)
+	if err != nil {
+		return -1
+	}
+	defer rt.parent.unlock(false, true)
 
-	err := rt.parent.mem.Get(&num, "SELECT COUNT(*) FROM \"main\".\""+rt.name+"\";")
+	err = sqlx.GetContext(ctx, rt.parent.mem, &num, "SELECT COUNT(*) FROM \"main\".\""+rt.name+"\";")
 	if err != nil {
 		return -1
 	}
@@ -1147,51 +1481,61 @@ func (rt *Rtable) CountMem() (num int) {
 	return num
 }
 
-// tries to interpret <data> as {x} rows of <rt>, then insert (or <cbh>) it into <rt>
+/*
+tries to interpret <data> as {x} rows of <rt>, then insert (or <cbh>) it into <rt>
+  - <data> too big for a single statement is inserted in chunks, all in one transaction
+*/
 func (rt *Rtable) InsertData(cbh conflict_behaviour, data []any) (err error) {
-	if !rt.valid() {
-		return ErrInvalidTable
-	}
-
-	<-rt.parent.dlock
-	defer func() { rt.parent.dlock <- true }()
+	return rt.InsertDataContext(context.Background(), cbh, data)
+}
 
-	if len(data) == 0 {
-		return nil
-	}
+// same as InsertData, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) InsertDataContext(ctx context.Context, cbh conflict_behaviour, data []any) (err error) {
+	return rt.InsertDataProgressContext(ctx, cbh, data, nil)
+}
 
-	if (len(data) % (len(rt.cols) - rt.ddint)) != 0 {
-		return ErrBadData
-	}
-	rowcount := (len(data) / (len(rt.cols) - rt.ddint))
+// same as InsertData, but calls <progress> (if not nil) with the number of rows inserted so far and the total after every chunk
+func (rt *Rtable) InsertDataProgress(cbh conflict_behaviour, data []any, progress func(done int, total int)) (err error) {
+	return rt.InsertDataProgressContext(context.Background(), cbh, data, progress)
+}
 
-	rowval_ph := "(?"
-	for i := 1; i < (len(rt.cols) - rt.ddint); i++ {
-		rowval_ph += ", ?"
+// same as InsertDataProgress, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) InsertDataProgressContext(ctx context.Context, cbh conflict_behaviour, data []any, progress func(done int, total int)) (err error) {
+	if !rt.valid() {
+		return ErrInvalidTable
 	}
-	rowval_ph += ")"
 
-	allval_ph := rowval_ph
-	for i := 1; i < rowcount; i++ {
-		allval_ph += "," + rowval_ph
-	}
+	defer func() { err = ctxErr(ctx, err) }()
 
-	colidef := "(\"" + rt.cols[rt.ddint].name + "\""
-	for _, rcol := range rt.cols[rt.ddint+1:] {
-		colidef += ",\"" + rcol.name + "\""
-	}
-	colidef += ")"
-
-	_, err = rt.parent.db.Exec("INSERT OR "+string(cbh)+" INTO \"main\".\""+rt.name+"\" "+colidef+" VALUES "+allval_ph+";", data...)
+	_, err = rt.parent.lock(ctx, true, false)
 	if err != nil {
 		return err
 	}
+	defer rt.parent.unlock(true, false)
 
-	return nil
+	return rt.insertRows(ctx, rt.parent.db, "INSERT OR "+string(cbh), "", rt.cols[rt.ddint:], data, progress)
 }
 
-// tries to interpret <data> as {x} rows of <rt>, then insert (or <cbh>) it into <rt>'s in-memory version
+/*
+tries to interpret <data> as {x} rows of <rt>, then insert (or <cbh>) it into <rt>'s in-memory version
+  - <data> too big for a single statement is inserted in chunks, all in one transaction
+*/
 func (rt *Rtable) InsertMemData(cbh conflict_behaviour, data []any) (err error) {
+	return rt.InsertMemDataContext(context.Background(), cbh, data)
+}
+
+// same as InsertMemData, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) InsertMemDataContext(ctx context.Context, cbh conflict_behaviour, data []any) (err error) {
+	return rt.InsertMemDataProgressContext(ctx, cbh, data, nil)
+}
+
+// same as InsertMemData, but calls <progress> (if not nil) with the number of rows inserted so far and the total after every chunk
+func (rt *Rtable) InsertMemDataProgress(cbh conflict_behaviour, data []any, progress func(done int, total int)) (err error) {
+	return rt.InsertMemDataProgressContext(context.Background(), cbh, data, progress)
+}
+
+// same as InsertMemDataProgress, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) InsertMemDataProgressContext(ctx context.Context, cbh conflict_behaviour, data []any, progress func(done int, total int)) (err error) {
 	if !rt.valid() {
 		return ErrInvalidTable
 	}
@@ -1199,70 +1543,225 @@ func (rt *Rtable) InsertMemData(cbh conflict_behaviour, data []any) (err error)
 		return ErrNoMem
 	}
 
-	<-rt.parent.memlock
-	defer func() { rt.parent.memlock <- true }()
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, false, true)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.unlock(false, true)
 
+	return rt.insertRows(ctx, rt.parent.mem, "INSERT OR "+string(cbh), "", rt.cols[rt.ddint:], data, progress)
+}
+
+// without locking, tries to interpret <data> as {x} rows of <cols>, then insert (or <cbh>) it into <rt> on <db>
+func (rt *Rtable) insert(ctx context.Context, db sqlx.ExecerContext, cbh conflict_behaviour, cols []rcol, data []any) (err error) {
+	return rt.insertRows(ctx, db, "INSERT OR "+string(cbh), "", cols, data, nil)
+}
+
+// tries to return the most variables ("?") a single statement can have on <db> (SQLITE_LIMIT_VARIABLE_NUMBER, 999 for SQLite before 3.32)
+func varLimit(db *sqlx.DB) (limit int, err error) {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(dc any) error {
+		sc, ok := dc.(*sqlite3.SQLiteConn)
+		if !ok {
+			return ErrIsNotDatabase
+		}
+		limit = sc.GetLimit(sqlite3.SQLITE_LIMIT_VARIABLE_NUMBER)
+		return nil
+	})
+	return limit, err
+}
+
+/*
+without locking, tries to interpret <data> as {x} rows of <cols>, then insert it into <rt> on <db>, with <verb> ("INSERT ...") and <clause> (appended after the values)
+  - if <data> needs more variables than the SQLite of <rt> allows in one statement, it is inserted in chunks (in a transaction, unless <db> already is one), calling <progress> (if not nil) after each
+*/
+func (rt *Rtable) insertRows(ctx context.Context, db sqlx.ExecerContext, verb string, clause string, cols []rcol, data []any, progress func(done int, total int)) (err error) {
 	if len(data) == 0 {
 		return nil
 	}
+	maxvars := rt.parent.maxvars
+	if (len(cols) == 0) || (len(cols) > maxvars) {
+		return ErrBadData
+	}
 
-	if (len(data) % (len(rt.cols) - rt.ddint)) != 0 {
+	if (len(data) % len(cols)) != 0 {
 		return ErrBadData
 	}
-	rowcount := (len(data) / (len(rt.cols) - rt.ddint))
+	rowcount := (len(data) / len(cols))
+	chunk := min(rowcount, maxvars/len(cols)) //rows per statement
 
 	rowval_ph := "(?"
-	for i := 1; i < len(rt.cols); i++ {
+	for i := 1; i < len(cols); i++ {
 		rowval_ph += ", ?"
 	}
 	rowval_ph += ")"
 
-	allval_ph := rowval_ph
-	for i := 1; i < rowcount; i++ {
-		allval_ph += "," + rowval_ph
-	}
-
-	colidef := "(\"" + rt.cols[rt.ddint].name + "\""
-	for _, rcol := range rt.cols[rt.ddint+1:] {
+	colidef := "(\"" + cols[0].name + "\""
+	for _, rcol := range cols[1:] {
 		colidef += ",\"" + rcol.name + "\""
 	}
 	colidef += ")"
 
-	_, err = rt.parent.mem.Exec("INSERT OR "+string(cbh)+" INTO \"main\".\""+rt.name+"\" "+colidef+" VALUES "+allval_ph+";", data...)
-	if err != nil {
-		return err
+	statement := func(rows int) string {
+		return verb + " INTO \"main\".\"" + rt.name + "\" " + colidef + " VALUES " + rowval_ph + strings.Repeat(","+rowval_ph, rows-1) + clause + ";"
 	}
 
-	return nil
+	if chunk == rowcount {
+		_, err = db.ExecContext(ctx, statement(rowcount), data...)
+		if err != nil {
+			return err
+		}
+
+		if progress != nil {
+			progress(rowcount, rowcount)
+		}
+		return nil
+	}
+
+	chunkfunc := func(db sqlx.ExecerContext) error {
+		var stmt *sql.Stmt
+		stmtrows := 0
+		defer func() {
+			if stmt != nil {
+				stmt.Close()
+			}
+		}()
+
+		for done := 0; done < rowcount; done += chunk {
+			rows := min(chunk, rowcount-done)
+			if rows != stmtrows { //only the last chunk can differ in size
+				if stmt != nil {
+					stmt.Close()
+				}
+
+				stmt, err = db.(sqlx.PreparerContext).PrepareContext(ctx, statement(rows))
+				if err != nil {
+					stmt = nil
+					return err
+				}
+				stmtrows = rows
+			}
+
+			_, err = stmt.ExecContext(ctx, data[done*len(cols):(done+rows)*len(cols)]...)
+			if err != nil {
+				return err
+			}
+
+			if progress != nil {
+				progress(done+rows, rowcount)
+			}
+		}
+		return nil
+	}
+
+	if sdb, ok := db.(*sqlx.DB); ok {
+		return inTx(ctx, sdb, func(tx *sqlx.Tx) error { return chunkfunc(tx) })
+	}
+	return chunkfunc(db)
 }
 
-func clausify_condition_array(condarr []Condition) (result string, substitutions []any) {
+/*
+tries to turn <condarr> into a where clause (" WHERE ...", or "" if empty) and the values to substitute into it
+  - a value which does not fit its operator (e.g. a non-slice for Op_in) -> ErrBadData
+*/
+func clausify_condition_array(condarr []Condition) (result string, substitutions []any, err error) {
 	if len(condarr) == 0 {
-		return "", []any{}
+		return "", []any{}, nil
+	}
+
+	result, substitutions, err = clausify_conditions(condarr)
+	if err != nil {
+		return "", []any{}, err
 	}
+	return " WHERE " + result, substitutions, nil
+}
 
+// does what clausify_condition_array does, without the " WHERE " (<condarr> must not be empty)
+func clausify_conditions(condarr []Condition) (result string, substitutions []any, err error) {
 	lrelmap := map[bool]string{true: " AND ", false: " OR "}
-	substitutions = make([]any, len(condarr))
+	substitutions = make([]any, 0, len(condarr))
 
-	result += "(\"" + condarr[0].Cname + "\" " + string(condarr[0].Op) + " ? )"
-	substitutions[0] = condarr[0].Val
+	for i, cond := range condarr {
+		if i != 0 {
+			if cond.Ljoin {
+				result = "(" + result + ") "
+			} //encapsulate preceding conditions
 
-	i := 1
-	for _, cond := range condarr[1:] {
-		if cond.Ljoin {
-			result = "(" + result + ") "
-		} //encapsulate preceding conditions
+			result += lrelmap[cond.Lrel]
+		}
 
-		result += lrelmap[cond.Lrel]
+		clause, subs, err := clausify_condition(cond)
+		if err != nil {
+			return "", []any{}, err
+		}
+		result += clause
+		substitutions = append(substitutions, subs...)
+	}
 
-		result += "(\"" + cond.Cname + "\" " + string(cond.Op) + " ? )"
-		substitutions[i] = cond.Val
+	return result, substitutions, nil
+}
 
-		i++
+// tries to turn a single <cond> (or group of conditions) into a bracketed clause and the values to substitute into it
+func clausify_condition(cond Condition) (result string, substitutions []any, err error) {
+	if cond.Sub != nil {
+		if len(cond.Sub) == 0 {
+			return "", []any{}, ErrBadData
+		}
+
+		result, substitutions, err = clausify_conditions(cond.Sub)
+		if err != nil {
+			return "", []any{}, err
+		}
+		return "(" + result + ")", substitutions, nil
+	}
+
+	col := "(" + qualName(cond.Tname, cond.Cname)
+	switch cond.Op {
+	case Op_isnull, Op_notnull:
+		return col + string(cond.Op) + ")", []any{}, nil
+
+	case Op_in, Op_notin:
+		vals, ok := condValues(cond.Val)
+		if !ok {
+			return "", []any{}, ErrBadData
+		}
+		return col + string(cond.Op) + "(" + strings.TrimSuffix(strings.Repeat("?, ", len(vals)), ", ") + ") )", vals, nil
+
+	case Op_between, Op_notbetween:
+		vals, ok := condValues(cond.Val)
+		if !ok || (len(vals) != 2) {
+			return "", []any{}, ErrBadData
+		}
+		return col + string(cond.Op) + "? AND ? )", vals, nil
+
+	default:
+		return col + " " + string(cond.Op) + " ? )", []any{cond.Val}, nil
+	}
+}
+
+// tries to return the elements of <v>, if it is a slice or an array (except []byte, which is a single value)
+func condValues(v any) (vals []any, ok bool) {
+	if vals, ok = v.([]any); ok {
+		return vals, true
 	}
-	result = " WHERE " + result
 
-	return result, substitutions
+	rv := reflect.ValueOf(v)
+	if ((rv.Kind() != reflect.Slice) && (rv.Kind() != reflect.Array)) || (rv.Type().Elem().Kind() == reflect.Uint8) {
+		return nil, false
+	}
+
+	vals = make([]any, rv.Len())
+	for i := range vals {
+		vals[i] = rv.Index(i).Interface()
+	}
+	return vals, true
 }
 
 func clausify_order_array(ordarr []Order) (result string) {
@@ -1273,14 +1772,22 @@ func clausify_order_array(ordarr []Order) (result string) {
 	dirmap := map[bool]string{true: " ASC", false: " DESC"}
 	nwhmap := map[bool]string{true: " NULLS FIRST", false: " NULLS LAST"}
 
-	result += " ORDER BY \"" + ordarr[0].Cname + "\"" + dirmap[ordarr[0].Dir] + nwhmap[ordarr[0].Nullwh]
+	result += " ORDER BY " + qualName(ordarr[0].Tname, ordarr[0].Cname) + dirmap[ordarr[0].Dir] + nwhmap[ordarr[0].Nullwh]
 	for _, ord := range ordarr[1:] {
-		result += ", \"" + ord.Cname + "\"" + dirmap[ord.Dir] + nwhmap[ord.Nullwh]
+		result += ", " + qualName(ord.Tname, ord.Cname) + dirmap[ord.Dir] + nwhmap[ord.Nullwh]
 	}
 	result += " "
 	return result
 }
 
+// returns the quoted name of column <cname>, qualified by table <tname> unless it is ""
+func qualName(tname string, cname string) string {
+	if tname == "" {
+		return "\"" + cname + "\""
+	}
+	return "\"" + tname + "\".\"" + cname + "\""
+}
+
 /*
 tries to return a slice of slices, which represent rows of <rt> (on-disk)
   - negative <index> indexes from the end of <rt>, instead of the beginning (-1 -> last item)
@@ -1289,46 +1796,24 @@ tries to return a slice of slices, which represent rows of <rt> (on-disk)
   - <ordarr> specifies the order of retrieval
 */
 func (rt *Rtable) GetData(index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	return rt.GetDataContext(context.Background(), index, count, condarr, ordarr)
+}
+
+// same as GetData, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) GetDataContext(ctx context.Context, index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
 	if !rt.valid() {
 		return [][]any{}, ErrInvalidTable
 	}
 
-	<-rt.parent.dlock
-	defer func() { rt.parent.dlock <- true }()
-
-	var perlen int //perceived length of the table
-	if (index < 0) || (count < 0) {
-		err = rt.parent.db.Get(&perlen, "SELECT COUNT(*) FROM \"main\".\""+rt.name+"\";")
-		if err != nil {
-			return [][]any{}, err
-		}
-		perlen++ //because the lowest neg value of (index, count) is -1, and that should select everything
-	}
-	offset := perlen*(index>>(strconv.IntSize-1))*-1 + index //pos -> index ; neg -> len(rt) - index
-	limit := perlen*(count>>(strconv.IntSize-1))*-1 + count  //pos -> count ; neg -> len(rt) - count
+	defer func() { err = ctxErr(ctx, err) }()
 
-	if rt.dd {
-		condarr = append(condarr, orgDdColIs0)
-	} //do not include "deleted" rows
-	where, wheresubs := clausify_condition_array(condarr)
-	order_by := clausify_order_array(ordarr)
-
-	rows, err := rt.parent.db.Queryx("SELECT * FROM \"main\".\""+rt.name+"\""+where+order_by+"LIMIT "+strconv.Itoa(limit)+" OFFSET "+strconv.Itoa(offset)+";", wheresubs...)
+	_, err = rt.parent.lock(ctx, true, false)
 	if err != nil {
 		return [][]any{}, err
 	}
-	defer rows.Close()
+	defer rt.parent.unlock(true, false)
 
-	for rows.Next() {
-		row_vals, err := rows.SliceScan()
-		if err != nil {
-			return data, err
-		}
-
-		data = append(data, row_vals[rt.ddint:]) //strip the dd col
-	}
-
-	return data, nil
+	return rt.get(ctx, rt.parent.db, index, count, condarr, ordarr, false)
 }
 
 /*
@@ -1339,6 +1824,11 @@ tries to return a slice of slices, which represent rows of <rt> (in-memory)
   - <ordarr> specifies the order of retrieval
 */
 func (rt *Rtable) GetMemData(index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	return rt.GetMemDataContext(context.Background(), index, count, condarr, ordarr)
+}
+
+// same as GetMemData, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) GetMemDataContext(ctx context.Context, index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
 	if !rt.valid() {
 		return [][]any{}, ErrInvalidTable
 	}
@@ -1346,27 +1836,51 @@ func (rt *Rtable) GetMemData(index int, count int, condarr []Condition, ordarr [
 		return [][]any{}, ErrNoMem
 	}
 
-	<-rt.parent.memlock
-	defer func() { rt.parent.memlock <- true }()
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, false, true)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer rt.parent.unlock(false, true)
+
+	return rt.get(ctx, rt.parent.mem, index, count, condarr, ordarr, false)
+}
+
+// without locking, tries to convert <index> and <count> (as in GetData) into a LIMIT and OFFSET for <rt> on <db>
+func (rt *Rtable) window(ctx context.Context, db sqlx.QueryerContext, index int, count int) (limit int, offset int, err error) {
+	return window(ctx, db, "\"main\".\""+rt.name+"\"", nil, index, count)
+}
 
+// without locking, tries to convert <index> and <count> (as in GetData) into a LIMIT and OFFSET for the rows of <from> (a table or subquery, with substitutions <subs>) on <db>
+func window(ctx context.Context, db sqlx.QueryerContext, from string, subs []any, index int, count int) (limit int, offset int, err error) {
 	var perlen int //perceived length of the table
 	if (index < 0) || (count < 0) {
-		err = rt.parent.db.Get(&perlen, "SELECT COUNT(*) FROM \"main\".\""+rt.name+"\";")
+		err = sqlx.GetContext(ctx, db, &perlen, "SELECT COUNT(*) FROM "+from+";", subs...)
 		if err != nil {
-			return [][]any{}, err
+			return 0, 0, err
 		}
 		perlen++ //because the lowest neg value of (index, count) is -1, and that should select everything
 	}
-	offset := perlen + index //pos -> index ; neg -> len(rt) - index
-	limit := perlen + count  //pos -> count ; neg -> len(rt) - count
+	offset = perlen*(index>>(strconv.IntSize-1))*-1 + index //pos -> index ; neg -> len(rt) - index
+	limit = perlen*(count>>(strconv.IntSize-1))*-1 + count  //pos -> count ; neg -> len(rt) - count
 
-	if rt.dd {
-		condarr = append(condarr, orgDdColIs0)
-	} //do not include "deleted" rows
-	where, wheresubs := clausify_condition_array(condarr)
-	order_by := clausify_order_array(ordarr)
+	return limit, offset, nil
+}
 
-	rows, err := rt.parent.mem.Queryx("SELECT * FROM \"main\".\""+rt.name+"\""+where+order_by+"LIMIT "+strconv.Itoa(limit)+" OFFSET "+strconv.Itoa(offset)+";", wheresubs...)
+// without locking, tries to return rows of <rt> on <db> as selected by GetData (keepDd -> also returns dd'd rows, including the dd col)
+func (rt *Rtable) get(ctx context.Context, db sqlx.QueryerContext, index int, count int, condarr []Condition, ordarr []Order, keepDd bool) (data [][]any, err error) {
+	statement, subs, err := rt.selStatement(ctx, db, "*", index, count, condarr, ordarr, keepDd)
+	if err != nil {
+		return [][]any{}, err
+	}
+
+	stripint := rt.ddint
+	if keepDd {
+		stripint = 0
+	}
+
+	rows, err := db.QueryxContext(ctx, statement, subs...)
 	if err != nil {
 		return [][]any{}, err
 	}
@@ -1378,10 +1892,30 @@ func (rt *Rtable) GetMemData(index int, count int, condarr []Condition, ordarr [
 			return data, err
 		}
 
-		data = append(data, row_vals[rt.ddint:]) //strip the dd col
+		data = append(data, row_vals[stripint:]) //strip the dd col
 	}
 
-	return data, nil
+	return data, rows.Err()
+}
+
+// without locking, tries to return an sql statement (and its substitutions) which selects <selcols> of rows of <rt> on <db> as selected by GetData (keepDd -> also selects dd'd rows)
+func (rt *Rtable) selStatement(ctx context.Context, db sqlx.QueryerContext, selcols string, index int, count int, condarr []Condition, ordarr []Order, keepDd bool) (statement string, subs []any, err error) {
+	limit, offset, err := rt.window(ctx, db, index, count)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if rt.dd && !keepDd {
+		condarr = append(condarr[:len(condarr):len(condarr)], orgDdColIs0)
+	} //do not include "deleted" rows
+	where, wheresubs, err := clausify_condition_array(condarr)
+	if err != nil {
+		return "", nil, err
+	}
+	order_by := clausify_order_array(ordarr)
+
+	statement = "SELECT " + selcols + " FROM \"main\".\"" + rt.name + "\"" + where + order_by + " LIMIT " + strconv.Itoa(limit) + " OFFSET " + strconv.Itoa(offset) + ";"
+	return statement, wheresubs, nil
 }
 
 /*
@@ -1392,6 +1926,11 @@ tries to load (copy) <rt>'s items from disk into memory
   - <condarr> specifies conditions which must be true for a row to be retrieved
 */
 func (rt *Rtable) LoadIntoMem(index int, count int, cbh conflict_behaviour, condarr []Condition) (err error) {
+	return rt.LoadIntoMemContext(context.Background(), index, count, cbh, condarr)
+}
+
+// same as LoadIntoMem, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) LoadIntoMemContext(ctx context.Context, index int, count int, cbh conflict_behaviour, condarr []Condition) (err error) {
 	if !rt.valid() {
 		return ErrInvalidTable
 	}
@@ -1399,37 +1938,48 @@ func (rt *Rtable) LoadIntoMem(index int, count int, cbh conflict_behaviour, cond
 		return ErrNoMem
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() { <-rt.parent.dlock; wg.Done() }()
-	go func() { <-rt.parent.memlock; wg.Done() }()
-	wg.Wait()
+	defer func() { err = ctxErr(ctx, err) }()
 
-	defer func() {
-		rt.parent.dlock <- true
-		rt.parent.memlock <- true
-	}()
+	_, err = rt.parent.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.unlock(true, true)
 
-	var perlen int //perceived length of the table
-	if (index < 0) || (count < 0) {
-		err = rt.parent.db.Get(&perlen, "SELECT COUNT(*) FROM \"main\".\""+rt.name+"\";")
-		if err != nil {
-			return err
-		}
-		perlen++ //because the lowest neg value of (index, count) is -1, and that should select everything
+	return rt.load(ctx, index, count, cbh, condarr)
+}
+
+// without locking, does what LoadIntoMem does
+func (rt *Rtable) load(ctx context.Context, index int, count int, cbh conflict_behaviour, condarr []Condition) error {
+	limit, offset, err := rt.window(ctx, rt.parent.db, index, count)
+	if err != nil {
+		return err
 	}
-	offset := perlen + index //pos -> index ; neg -> len(rt) - index
-	limit := perlen + count  //pos -> count ; neg -> len(rt) - count
 
-	where, wheresubs := clausify_condition_array(condarr)
+	where, wheresubs, err := clausify_condition_array(condarr)
+	if err != nil {
+		return err
+	}
 
-	_, err = rt.parent.mem.Exec("ATTACH DATABASE \"" + rt.parent.path + "\" AS \"disk\";")
+	_, err = rt.parent.mem.ExecContext(ctx, "ATTACH DATABASE \""+rt.parent.path+"\" AS \"disk\";")
 	if err != nil {
 		return err
 	}
 	defer rt.parent.mem.Exec("DETACH DATABASE \"disk\";")
 
-	_, err = rt.parent.mem.Exec("INSERT OR "+string(cbh)+"INTO \"main\".\""+rt.name+"\" SELECT * FROM \"disk\".\""+rt.name+"\""+where+"LIMIT "+strconv.Itoa(limit)+" OFFSET "+strconv.Itoa(offset)+";", wheresubs...)
+	err = rt.parent.wbPause(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.wbPause(context.Background(), false) //loaded rows are not changes
+
+	err = rt.parent.memFks(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.memFks(context.Background(), true) //the rows they reference may not be loaded
+
+	_, err = rt.parent.mem.ExecContext(ctx, "INSERT OR "+string(cbh)+" INTO \"main\".\""+rt.name+"\" SELECT * FROM \"disk\".\""+rt.name+"\""+where+" LIMIT "+strconv.Itoa(limit)+" OFFSET "+strconv.Itoa(offset)+";", wheresubs...)
 	if err != nil {
 		return err
 	}
@@ -1437,8 +1987,13 @@ func (rt *Rtable) LoadIntoMem(index int, count int, cbh conflict_behaviour, cond
 	return nil
 }
 
-// tries to irreversibly remove rows where <condarr> is true from <rt>'s memory
+// tries to irreversibly remove rows where <condarr> is true from <rt>'s memory (in write-back mode, unflushed changes of <rt> are flushed first)
 func (rt *Rtable) UnloadFromMem(condarr []Condition) (err error) {
+	return rt.UnloadFromMemContext(context.Background(), condarr)
+}
+
+// same as UnloadFromMem, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) UnloadFromMemContext(ctx context.Context, condarr []Condition) (err error) {
 	if !rt.valid() {
 		return ErrInvalidTable
 	}
@@ -1446,12 +2001,51 @@ func (rt *Rtable) UnloadFromMem(condarr []Condition) (err error) {
 		return ErrNoMem
 	}
 
-	<-rt.parent.memlock
-	defer func() { rt.parent.memlock <- true }()
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.unlock(true, true)
+
+	if rt.parent.rc != nil { //cached queries sharing unloaded rows are incomplete from now on
+		err = rt.parent.rcForget(ctx, rt, condarr)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rt.unload(ctx, condarr)
+}
+
+// without locking, does what UnloadFromMem does (without touching the read-through cache)
+func (rt *Rtable) unload(ctx context.Context, condarr []Condition) error {
+	where, wheresubs, err := clausify_condition_array(condarr)
+	if err != nil {
+		return err
+	}
+
+	if rt.parent.wb != nil {
+		err = rt.parent.wbFlush(ctx, []*Rtable{rt})
+		if err != nil {
+			return err
+		}
+
+		err = rt.parent.wbPause(ctx, true)
+		if err != nil {
+			return err
+		}
+		defer rt.parent.wbPause(context.Background(), false) //unloaded rows are not deleted
+	}
 
-	where, wheresubs := clausify_condition_array(condarr)
+	err = rt.parent.memFks(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.memFks(context.Background(), true) //the rows referencing them are not deleted
 
-	_, err = rt.parent.mem.Exec("DELETE FROM \"main\".\""+rt.name+"\""+where+";", wheresubs...)
+	_, err = rt.parent.mem.ExecContext(ctx, "DELETE FROM \"main\".\""+rt.name+"\""+where+";", wheresubs...)
 	if err != nil {
 		return err
 	}
@@ -1459,74 +2053,196 @@ func (rt *Rtable) UnloadFromMem(condarr []Condition) (err error) {
 	return nil
 }
 
-// tries to, depending on rt.dd, permanently delete or mark as outdated, rows from where <condarr> is true, both from <rt>'s memory and disk
+/*
+tries to, depending on rt.dd, permanently delete or mark as outdated, rows from where <condarr> is true, both from <rt>'s memory and disk
+  - if rt.dd, the marked rows become deletion 1 (see UndoDelete), and every older deletion's <ver> grows by 1
+  - rows which are already marked are not marked again
+*/
 func (rt *Rtable) DeleteData(condarr []Condition) (err error) {
+	return rt.DeleteDataContext(context.Background(), condarr)
+}
+
+// same as DeleteData, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) DeleteDataContext(ctx context.Context, condarr []Condition) (err error) {
 	if !rt.valid() {
 		return ErrInvalidTable
 	}
 
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := rt.parent.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.unlock(true, memheld)
+
 	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() { <-rt.parent.dlock; wg.Done() }()
-	go func() {
-		if rt.parent.mem != nil {
-			<-rt.parent.memlock
+
+	delfunc := func(db *sqlx.DB, errout chan error) {
+		defer wg.Done()
+		if db == nil {
+			return
 		}
-		wg.Done()
-	}()
-	wg.Wait()
 
-	defer func() {
-		rt.parent.dlock <- true
-		if rt.parent.mem != nil {
-			rt.parent.memlock <- true
+		err := inTx(ctx, db, func(tx *sqlx.Tx) error { //aging and marking must not be torn apart
+			if db == rt.parent.db { //only disk keeps a log
+				return rt.loggedDelete(ctx, tx, condarr)
+			}
+			_, err := rt.delete(ctx, tx, condarr)
+			return err
+		})
+		if err != nil {
+			errout <- err
+			return
 		}
-	}()
+	}
 
-	var delfunc func(db *sqlx.DB, errout chan error)
+	errin := make(chan error, 2)
+	wg.Add(2)
+	go delfunc(rt.parent.db, errin)
+	go delfunc(rt.parent.mem, errin)
+	wg.Wait()
+	if len(errin) != 0 {
+		return <-errin
+	}
+
+	return nil
+}
+
+// without locking, tries to, depending on rt.dd, permanently delete or mark as outdated, rows of <rt> on <db> where <condarr> is true (-> number of rows affected)
+func (rt *Rtable) delete(ctx context.Context, db sqlx.ExecerContext, condarr []Condition) (n int64, err error) {
+	var res sql.Result
 	if rt.dd {
-		delfunc = func(db *sqlx.DB, errout chan error) {
-			defer wg.Done()
-			if db == nil {
-				return
-			}
+		condarr = append(condarr[:len(condarr):len(condarr)], orgDdColIs0) //do not mark rows of older deletions again
+		where, wheresubs, err := clausify_condition_array(condarr)
+		if err != nil {
+			return 0, err
+		}
 
-			condarr = append(condarr, Condition{Ljoin: true, Lrel: false, Cname: orgDdCol.name, Op: Op_more, Val: 0}) //also increment any rows where the dd col is >= 0
-			where, wheresubs := clausify_condition_array(condarr)
+		_, err = db.ExecContext(ctx, "UPDATE \"main\".\""+rt.name+"\" SET \""+orgDdCol.name+"\" = \""+orgDdCol.name+"\" + 1 WHERE \""+orgDdCol.name+"\" > 0;")
+		if err != nil {
+			return 0, err
+		} //age older deletions, even if nothing new gets marked (so that <ver>s always count deletions)
 
-			_, err := db.Exec("UPDATE \"main\".\""+rt.name+"\" SET \""+orgDdCol.name+"\" = 1"+where+";", wheresubs...)
-			if err != nil {
-				errout <- err
-				return
-			}
+		res, err = db.ExecContext(ctx, "UPDATE \"main\".\""+rt.name+"\" SET \""+orgDdCol.name+"\" = 1"+where+";", wheresubs...)
+		if err != nil {
+			return 0, err
 		}
+		return res.RowsAffected()
+	}
 
-	} else {
-		delfunc = func(db *sqlx.DB, errout chan error) {
-			defer wg.Done()
-			if db == nil {
-				return
-			}
+	where, wheresubs, err := clausify_condition_array(condarr)
+	if err != nil {
+		return 0, err
+	}
+	res, err = db.ExecContext(ctx, "DELETE FROM \"main\".\""+rt.name+"\""+where+";", wheresubs...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+/*
+tries to set the columns of rows where <condarr> is true to the values in <set> (column name -> value), both in <rt>'s memory and disk
+  - returns the number of rows affected on-disk
+  - rows which are "deleted" (see DeleteData) are not affected
+*/
+func (rt *Rtable) UpdateData(set map[string]any, condarr []Condition) (affected int, err error) {
+	return rt.UpdateDataContext(context.Background(), set, condarr)
+}
 
-			where, wheresubs := clausify_condition_array(condarr)
-			_, err := db.Exec("DELETE FROM \"main\".\""+rt.name+"\""+where+";", wheresubs...)
+// same as UpdateData, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) UpdateDataContext(ctx context.Context, set map[string]any, condarr []Condition) (affected int, err error) {
+	if !rt.valid() {
+		return 0, ErrInvalidTable
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := rt.parent.lock(ctx, true, true)
+	if err != nil {
+		return 0, err
+	}
+	defer rt.parent.unlock(true, memheld)
+
+	var wg sync.WaitGroup
+
+	statement, subs, err := rt.updStatement(set, condarr)
+	if err != nil {
+		return 0, err
+	}
+
+	updfunc := func(db *sqlx.DB, errout chan error, affout *int) {
+		defer wg.Done()
+		if db == nil {
+			return
+		}
+
+		res, err := db.ExecContext(ctx, statement, subs...)
+		if err != nil {
+			errout <- err
+			return
+		}
+
+		if affout != nil {
+			n, err := res.RowsAffected()
 			if err != nil {
 				errout <- err
 				return
 			}
+			*affout = int(n)
 		}
 	}
 
 	errin := make(chan error, 2)
 	wg.Add(2)
-	go delfunc(rt.parent.db, errin)
-	go delfunc(rt.parent.mem, errin)
+	go updfunc(rt.parent.db, errin, &affected)
+	go updfunc(rt.parent.mem, errin, nil)
 	wg.Wait()
 	if len(errin) != 0 {
-		return <-errin
+		return 0, <-errin
 	}
 
-	return nil
+	return affected, nil
+}
+
+// tries to return an sql statement (and its substitutions) which sets the columns of rows of <rt> where <condarr> is true according to <set>
+func (rt *Rtable) updStatement(set map[string]any, condarr []Condition) (statement string, subs []any, err error) {
+	if len(set) == 0 {
+		return "", nil, ErrBadData
+	}
+
+	colset := make(stringset, len(rt.cols))
+	for _, c := range rt.cols[rt.ddint:] {
+		colset[c.name] = empty{}
+	}
+
+	cnames := make([]string, 0, len(set))
+	for cname := range set {
+		if !colset.has(cname) {
+			return "", nil, ErrIsNotPresent
+		}
+		cnames = append(cnames, cname)
+	}
+	slices.Sort(cnames) //map order is random, keep the statement the same for the same <set>
+
+	setdefs := make([]string, len(cnames))
+	subs = make([]any, len(cnames), len(cnames)+len(condarr)+1)
+	for i, cname := range cnames {
+		setdefs[i] = "\"" + cname + "\" = ?"
+		subs[i] = set[cname]
+	}
+
+	if rt.dd {
+		condarr = append(condarr[:len(condarr):len(condarr)], orgDdColIs0)
+	} //do not update "deleted" rows
+	where, wheresubs, err := clausify_condition_array(condarr)
+	if err != nil {
+		return "", nil, err
+	}
+
+	statement = "UPDATE \"main\".\"" + rt.name + "\" SET " + strings.Join(setdefs, ", ") + where + ";"
+	return statement, append(subs, wheresubs...), nil
 }
 
 /*
@@ -1534,44 +2250,36 @@ tries to unmark the deletion of rows marked in the <ver>th last deletion (both m
   - will not do anything if not rt.dd
   - will not change the <ver> required to address any other deletions
   - addressing a nonexistent deletion with <ver> will simply not affect any rows
-  - <ver> is indexed starting at 1
-  - negative <ver> will instead delete the <ver>th deletion
+  - <ver> is indexed starting at 1 (1 -> the last deletion)
+  - negative <ver> indexes from the oldest deletion which still has marked rows instead (-1 -> the oldest one)
 */
 func (rt *Rtable) UndoDelete(ver int) (err error) {
+	return rt.UndoDeleteContext(context.Background(), ver)
+}
+
+// same as UndoDelete, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) UndoDeleteContext(ctx context.Context, ver int) (err error) {
 	if !rt.valid() {
 		return ErrInvalidTable
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() { <-rt.parent.dlock; wg.Done() }()
-	go func() {
-		if rt.parent.mem != nil {
-			<-rt.parent.memlock
-		}
-		wg.Done()
-	}()
-	wg.Wait()
+	defer func() { err = ctxErr(ctx, err) }()
 
-	defer func() {
-		rt.parent.dlock <- true
-		if rt.parent.mem != nil {
-			rt.parent.memlock <- true
-		}
-	}()
+	memheld, err := rt.parent.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.unlock(true, memheld)
+
+	var wg sync.WaitGroup
 
 	if !rt.dd {
 		return nil
 	}
 
-	if ver < 0 {
-		var maxver int
-		err := rt.parent.db.Get(&maxver, "SELECT MAX(\""+orgDdCol.name+"\") FROM \"main\".\""+rt.name+"\";")
-		if (err != sql.ErrNoRows) && (err != nil) {
-			return err
-		}
-
-		ver = maxver + ver //ver is negative -> negative indexing
+	ver, err = rt.absVer(ctx, rt.parent.db, ver)
+	if err != nil {
+		return err
 	}
 
 	undelfunc := func(db *sqlx.DB, errout chan error) {
@@ -1580,7 +2288,12 @@ func (rt *Rtable) UndoDelete(ver int) (err error) {
 			return
 		}
 
-		_, err := db.Exec("UPDATE \"main\".\""+rt.name+"\" SET \""+orgDdCol.name+"\" = 0 WHERE \""+orgDdCol.name+"\" = ?", ver)
+		var err error
+		if db == rt.parent.db { //only disk keeps a log
+			err = inTx(ctx, db, func(tx *sqlx.Tx) error { return rt.loggedUndelete(ctx, tx, ver) })
+		} else {
+			_, err = rt.undelete(ctx, db, ver)
+		}
 		if err != nil {
 			errout <- err
 			return
@@ -1604,42 +2317,36 @@ tries to irreversibly remove rows marked in the <ver>th last deletion (both memo
   - will not do anything if not rt.dd
   - will not change the <ver> required to address any other deletions
   - addressing a nonexistent deletion with <ver> will simply not affect any rows
-  - <ver> is indexed starting at 1
-  - negative <ver> will instead delete the <ver>th deletion
+  - <ver> is indexed starting at 1 (1 -> the last deletion)
+  - negative <ver> indexes from the oldest deletion which still has marked rows instead (-1 -> the oldest one)
 */
 func (rt *Rtable) ConfirmDelete(ver int) (err error) {
+	return rt.ConfirmDeleteContext(context.Background(), ver)
+}
+
+// same as ConfirmDelete, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) ConfirmDeleteContext(ctx context.Context, ver int) (err error) {
 	if !rt.valid() {
 		return ErrInvalidTable
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() { <-rt.parent.dlock; wg.Done() }()
-	go func() {
-		if rt.parent.mem != nil {
-			<-rt.parent.memlock
-		}
-		wg.Done()
-	}()
-	wg.Wait()
+	defer func() { err = ctxErr(ctx, err) }()
 
-	defer func() {
-		rt.parent.dlock <- true
-		rt.parent.memlock <- true
-	}()
+	memheld, err := rt.parent.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.unlock(true, memheld)
+
+	var wg sync.WaitGroup
 
 	if !rt.dd {
 		return nil
 	}
 
-	if ver < 0 {
-		var maxver int
-		err := rt.parent.db.Get(&maxver, "SELECT MAX(\""+orgDdCol.name+"\") FROM \"main\".\""+rt.name+"\";")
-		if (err != sql.ErrNoRows) && (err != nil) {
-			return err
-		}
-
-		ver = maxver + ver //ver is negative -> negative indexing
+	ver, err = rt.absVer(ctx, rt.parent.db, ver)
+	if err != nil {
+		return err
 	}
 
 	remfunc := func(db *sqlx.DB, errout chan error) {
@@ -1648,7 +2355,12 @@ func (rt *Rtable) ConfirmDelete(ver int) (err error) {
 			return
 		}
 
-		_, err := db.Exec("DELETE FROM \"main\".\""+rt.name+"\" WHERE \""+orgDdCol.name+"\" = ?", ver)
+		var err error
+		if db == rt.parent.db { //only disk keeps a log
+			err = inTx(ctx, db, func(tx *sqlx.Tx) error { return rt.loggedRemove(ctx, tx, ver) })
+		} else {
+			_, err = rt.remove(ctx, db, ver)
+		}
 		if err != nil {
 			errout <- err
 			return
@@ -1667,6 +2379,42 @@ func (rt *Rtable) ConfirmDelete(ver int) (err error) {
 	return nil
 }
 
-/*TODO:
-- Add export to CSV
-- Add export to checksum format or something (and integrate it)*/
+// without locking, tries to convert a negative <ver> (as in UndoDelete) into the deletion it addresses on <db> (0 -> none)
+func (rt *Rtable) absVer(ctx context.Context, db sqlx.QueryerContext, ver int) (int, error) {
+	if ver >= 0 {
+		return ver, nil
+	}
+
+	var absver int
+	err := sqlx.GetContext(ctx, db, &absver, "SELECT DISTINCT \""+orgDdCol.name+"\" FROM \"main\".\""+rt.name+"\" WHERE \""+orgDdCol.name+"\" > 0 ORDER BY \""+orgDdCol.name+"\" DESC LIMIT 1 OFFSET ?;", -ver-1)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return absver, err
+}
+
+// without locking, tries to unmark the deletion of rows of <rt> on <db> marked in deletion <ver> (-> number of rows affected)
+func (rt *Rtable) undelete(ctx context.Context, db sqlx.ExecerContext, ver int) (n int64, err error) {
+	if ver < 1 {
+		return 0, nil
+	} //0 would address rows which are not marked
+
+	res, err := db.ExecContext(ctx, "UPDATE \"main\".\""+rt.name+"\" SET \""+orgDdCol.name+"\" = 0 WHERE \""+orgDdCol.name+"\" = ?", ver)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// without locking, tries to irreversibly remove rows of <rt> on <db> marked in deletion <ver> (-> number of rows affected)
+func (rt *Rtable) remove(ctx context.Context, db sqlx.ExecerContext, ver int) (n int64, err error) {
+	if ver < 1 {
+		return 0, nil
+	} //0 would address rows which are not marked
+
+	res, err := db.ExecContext(ctx, "DELETE FROM \"main\".\""+rt.name+"\" WHERE \""+orgDdCol.name+"\" = ?", ver)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -1,12 +1,14 @@
 package dbops_test
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
 	"slices"
 	"testing"
+	"time"
 
 	"github.com/hexani-4/go-dbops"
 )
@@ -112,7 +114,7 @@ func TestBasic(t *testing.T) {
 	}
 
 	//check that it got inserted
-	err = checkData(tbl, tdata[:2], false)
+	err = checkData(tbl, "a a", tdata[:2], false)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -136,7 +138,7 @@ func TestBasic(t *testing.T) {
 	}
 
 	//check that it was edited properly
-	err = checkData(tbl, tdata[:2], false)
+	err = checkData(tbl, "a a", tdata[:2], false)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -148,7 +150,7 @@ func TestBasic(t *testing.T) {
 	}
 
 	//check that it will not be returned
-	err = checkData(tbl, tdata[1:2], true)
+	err = checkData(tbl, "a a", tdata[1:2], true)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -160,7 +162,7 @@ func TestBasic(t *testing.T) {
 	}
 
 	//check that it will be returned again
-	err = checkData(tbl, tdata[:2], false)
+	err = checkData(tbl, "a a", tdata[:2], false)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -185,7 +187,7 @@ func TestBasic(t *testing.T) {
 	}
 
 	//check that all data in tts[1] of src is now in dummy
-	err = checkData(dtbl, tdata[:2], false)
+	err = checkData(dtbl, "a a", tdata[:2], false)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -204,6 +206,336 @@ func TestBasic(t *testing.T) {
 	os.Remove(sec_path)
 }
 
+// tests that UpdateData changes the right rows on both disk and memory, and leaves dd'd rows alone
+func TestUpdate(t *testing.T) {
+
+	//init
+	var tts = []dbops.Table{{Name: "upd", Dd: true, Cols: []dbops.Col{{Name: "a a", Ext: "INTEGER", Pk: true},
+		{Name: "b b", Ext: "TEXT", Pk: false}}}}
+
+	src, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "upd.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+
+	tbl := src.GetRtable(tts[0].Name)
+	err = tbl.InsertData(dbops.Conf_abort, []any{int64(1), "x", int64(2), "x", int64(3), "x"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	err = src.CreateMem()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.LoadIntoMem(0, -1, dbops.Conf_abort, []dbops.Condition{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//dd the last row, it must not be updated
+	err = tbl.DeleteData([]dbops.Condition{{Cname: "a a", Op: dbops.Op_eq, Val: 3}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	n, err := tbl.UpdateData(map[string]any{"b b": "y"}, []dbops.Condition{{Cname: "a a", Op: dbops.Op_more, Val: 1}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 affected row, got %d", n)
+	}
+
+	err = checkData(tbl, "a a", [][]any{{int64(1), "x"}, {int64(2), "y"}}, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	mdata, err := tbl.GetMemData(0, -1, []dbops.Condition{}, []dbops.Order{{Cname: "a a", Dir: true}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !reflect.DeepEqual(mdata, [][]any{{int64(1), "x"}, {int64(2), "y"}}) {
+		t.Fatalf("unexpected in-memory data %v", mdata)
+	}
+
+	//unknown columns are rejected
+	_, err = tbl.UpdateData(map[string]any{"verIndex": 5}, []dbops.Condition{})
+	if err != dbops.ErrIsNotPresent {
+		t.Fatalf("expected ErrIsNotPresent, got %v", err)
+	}
+}
+
+// tests that context variants give up waiting for a released source, and work normally otherwise
+func TestContext(t *testing.T) {
+
+	//init
+	var tts = []dbops.Table{{Name: "ctx", Dd: false, Cols: []dbops.Col{{Name: "a a", Ext: "INTEGER", Pk: true}}}}
+
+	src, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "ctx.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+	tbl := src.GetRtable(tts[0].Name)
+
+	//an already cancelled context must not do anything
+	cctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = tbl.InsertDataContext(cctx, dbops.Conf_abort, []any{1})
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	//while released, waiting for the lock must time out
+	src.Release()
+	tctx, tcancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer tcancel()
+	_, err = tbl.GetDataContext(tctx, 0, -1, []dbops.Condition{}, []dbops.Order{})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	err = src.Reclaim(true, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//after reclaiming, everything works as usual
+	err = tbl.InsertDataContext(context.Background(), dbops.Conf_abort, []any{1})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tbl.CountContext(context.Background()) != 1 {
+		t.Fatalf("row was not inserted")
+	}
+}
+
+// tests that every deletion gets its own version, which positive and negative <ver>s address exactly, on both disk and memory
+func TestDeltaDelete(t *testing.T) {
+
+	//init
+	var tts = []dbops.Table{{Name: "dd", Dd: true, Cols: []dbops.Col{{Name: "a a", Ext: "INTEGER", Pk: true}}}}
+
+	src, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "dd.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+
+	tbl := src.GetRtable(tts[0].Name)
+	err = tbl.InsertData(dbops.Conf_abort, []any{1, 2, 3, 4, 5})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = src.CreateMem()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.LoadIntoMem(0, -1, dbops.Conf_abort, []dbops.Condition{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//checks that exactly <expected> is visible on both disk and memory
+	check := func(expected []int64) {
+		t.Helper()
+		for _, get := range []func(int, int, []dbops.Condition, []dbops.Order) ([][]any, error){tbl.GetData, tbl.GetMemData} {
+			data, err := get(0, -1, []dbops.Condition{}, []dbops.Order{{Cname: "a a", Dir: true}})
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			got := make([]int64, len(data))
+			for i, row := range data {
+				got[i] = row[0].(int64)
+			}
+			if !slices.Equal(got, expected) {
+				t.Fatalf("expected %v, got %v", expected, got)
+			}
+		}
+	}
+
+	//deletions 3, 2 and 1 (from oldest to last); the last one overlaps the first, which must stay unchanged
+	for _, vals := range [][]int{{1}, {2, 3}, {1, 4}} {
+		err = tbl.DeleteData([]dbops.Condition{{Cname: "a a", Op: dbops.Op_in, Val: vals}})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	check([]int64{5})
+
+	//undo the middle one only
+	err = tbl.UndoDelete(2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	check([]int64{2, 3, 5})
+
+	//confirming the oldest one (-1) removes 1 for good, undoing the last one brings back 4
+	err = tbl.ConfirmDelete(-1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.UndoDelete(1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	check([]int64{2, 3, 4, 5})
+	if (tbl.Count() != 4) || (tbl.CountMem() != 4) {
+		t.Fatalf("confirmed rows were not removed")
+	}
+
+	//a new deletion ages the others, nonexistent versions do nothing
+	err = tbl.DeleteData([]dbops.Condition{{Cname: "a a", Op: dbops.Op_eq, Val: 5}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.UndoDelete(0)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.ConfirmDelete(-2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	check([]int64{2, 3, 4})
+	err = tbl.UndoDelete(-1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	check([]int64{2, 3, 4, 5})
+}
+
+// tests that inserts past the variable limit are split into chunks, which are committed or rolled back together
+func TestBulkInsert(t *testing.T) {
+
+	//init
+	var tts = []dbops.Table{{Name: "bulk", Dd: true, Cols: []dbops.Col{{Name: "a a", Ext: "INTEGER", Pk: true},
+		{Name: "b b", Ext: "TEXT", Pk: false}}}}
+
+	src, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "bulk.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+	tbl := src.GetRtable(tts[0].Name)
+
+	const rows = 40000 //80000 variables
+	data := make([]any, 0, rows*2)
+	for i := 0; i < rows; i++ {
+		data = append(data, i, "x")
+	}
+
+	//a conflict in the last chunk rolls back all of them
+	data[len(data)-2] = 0
+	err = tbl.InsertData(dbops.Conf_abort, data)
+	if err == nil {
+		t.Fatalf("expected a constraint error")
+	}
+	if tbl.Count() != 0 {
+		t.Fatalf("failed chunked insert was not rolled back")
+	}
+	data[len(data)-2] = rows - 1
+
+	var calls []int
+	err = tbl.InsertDataProgress(dbops.Conf_abort, data, func(done int, total int) {
+		if total != rows {
+			t.Fatalf("unexpected total %d", total)
+		}
+		calls = append(calls, done)
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if (len(calls) < 2) || (calls[len(calls)-1] != rows) || !slices.IsSorted(calls) {
+		t.Fatalf("unexpected progress %v", calls)
+	}
+	if tbl.Count() != rows {
+		t.Fatalf("expected %d rows, got %d", rows, tbl.Count())
+	}
+
+	//memory works the same way
+	err = src.CreateMem()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.InsertMemData(dbops.Conf_abort, data)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tbl.CountMem() != rows {
+		t.Fatalf("expected %d rows in memory, got %d", rows, tbl.CountMem())
+	}
+}
+
+// tests that every operator, and nested groups of conditions, select the right rows
+func TestConditions(t *testing.T) {
+
+	//init
+	var tts = []dbops.Table{{Name: "cond", Dd: true, Cols: []dbops.Col{{Name: "a a", Ext: "INTEGER", Pk: true},
+		{Name: "b b", Ext: "TEXT", Pk: false}}}}
+
+	src, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "cond.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+
+	tbl := src.GetRtable(tts[0].Name)
+	err = tbl.InsertData(dbops.Conf_abort, []any{1, "apple", 2, "Apricot", 3, "banana", 4, nil, 5, "cherry"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	var cases = []struct {
+		condarr  []dbops.Condition
+		expected []int64
+	}{
+		{[]dbops.Condition{{Cname: "a a", Op: dbops.Op_in, Val: []int{1, 3, 9}}}, []int64{1, 3}},
+		{[]dbops.Condition{{Cname: "a a", Op: dbops.Op_notin, Val: []any{1, 3}}}, []int64{2, 4, 5}},
+		{[]dbops.Condition{{Cname: "b b", Op: dbops.Op_like, Val: "ap%"}}, []int64{1, 2}},
+		{[]dbops.Condition{{Cname: "b b", Op: dbops.Op_glob, Val: "a*"}}, []int64{1}},
+		{[]dbops.Condition{{Cname: "b b", Op: dbops.Op_notglob, Val: "a*"}}, []int64{2, 3, 5}},
+		{[]dbops.Condition{{Cname: "a a", Op: dbops.Op_between, Val: []int{2, 4}}}, []int64{2, 3, 4}},
+		{[]dbops.Condition{{Cname: "a a", Op: dbops.Op_notbetween, Val: [2]int{2, 4}}}, []int64{1, 5}},
+		{[]dbops.Condition{{Cname: "b b", Op: dbops.Op_isnull}}, []int64{4}},
+		{[]dbops.Condition{{Cname: "b b", Op: dbops.Op_is, Val: nil}}, []int64{4}},
+		{[]dbops.Condition{{Cname: "b b", Op: dbops.Op_notnull}, {Lrel: true, Cname: "a a", Op: dbops.Op_more, Val: 3}}, []int64{5}},
+
+		//a > 1 AND (b LIKE 'a%' OR (a >= 4 AND b IS NULL))
+		{[]dbops.Condition{{Cname: "a a", Op: dbops.Op_more, Val: 1},
+			{Lrel: true, Sub: []dbops.Condition{{Cname: "b b", Op: dbops.Op_like, Val: "a%"},
+				{Lrel: false, Sub: []dbops.Condition{{Cname: "a a", Op: dbops.Op_eqmore, Val: 4}, {Lrel: true, Cname: "b b", Op: dbops.Op_isnull}}}}}},
+			[]int64{2, 4}},
+	}
+
+	for i, c := range cases {
+		data, err := tbl.GetData(0, -1, c.condarr, []dbops.Order{{Cname: "a a", Dir: true}})
+		if err != nil {
+			t.Fatalf("case %d: %s", i, err.Error())
+		}
+
+		got := make([]int64, len(data))
+		for j, row := range data {
+			got[j] = row[0].(int64)
+		}
+		if !slices.Equal(got, c.expected) {
+			t.Fatalf("case %d: expected %v, got %v", i, c.expected, got)
+		}
+	}
+
+	//values which do not fit their operator are rejected
+	for _, condarr := range [][]dbops.Condition{{{Cname: "a a", Op: dbops.Op_in, Val: 1}},
+		{{Cname: "a a", Op: dbops.Op_between, Val: []int{1}}},
+		{{Cname: "a a", Op: dbops.Op_eq, Val: 1}, {Sub: []dbops.Condition{}}}} {
+
+		err = tbl.DeleteData(condarr)
+		if err != dbops.ErrBadData {
+			t.Fatalf("expected ErrBadData, got %v", err)
+		}
+	}
+}
+
 /*
 All mem funcs
 */
@@ -243,7 +575,7 @@ func checkTables(src *dbops.DataSrc, expected_tables []dbops.Table) error {
 	return nil
 }
 
-func checkData(tbl *dbops.Rtable, expected_data [][]any, nocount bool) error {
+func checkData(tbl *dbops.Rtable, kcol string, expected_data [][]any, nocount bool) error {
 
 	if !nocount {
 		//check table length
@@ -258,7 +590,7 @@ func checkData(tbl *dbops.Rtable, expected_data [][]any, nocount bool) error {
 	}
 
 	//get the actual data
-	rdata, err := tbl.GetData(0, -1, []dbops.Condition{{Ljoin: true, Lrel: false, Cname: "a a", Op: dbops.Op_neq, Val: 69}}, []dbops.Order{{Cname: "a a", Dir: false, Nullwh: false}})
+	rdata, err := tbl.GetData(0, -1, []dbops.Condition{{Ljoin: true, Lrel: false, Cname: kcol, Op: dbops.Op_neq, Val: 69}}, []dbops.Order{{Cname: kcol, Dir: false, Nullwh: false}})
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,372 @@
+package dbops
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// -------------------- DISK/MEMORY DIFF --------------------
+
+/*
+the differences between the rows of a table on disk and in memory, as returned by DataSrc.Diff
+  - rows are matched by primary key, tables without one are matched by all columns (so none of their rows are Changed)
+  - rows hold all columns, including the dd column (a row "deleted" on only one side is Changed)
+*/
+type TableDiff struct {
+	Table string
+
+	DiskOnly [][]any     //rows whose key is only on disk
+	MemOnly  [][]any     //rows whose key is only in memory
+	Changed  []RowChange //rows whose key is on both, with different values
+}
+
+// a row whose values differ between disk and memory
+type RowChange struct {
+	Disk []any
+	Mem  []any
+}
+
+// returns whether <d> holds no differences
+func (d TableDiff) Empty() bool {
+	return (len(d.DiskOnly) == 0) && (len(d.MemOnly) == 0) && (len(d.Changed) == 0)
+}
+
+type reconcile_direction string //constants begin with "Recon_"; which side wins when reconciling disk and memory
+const (
+	Recon_toDisk reconcile_direction = "DISK" //disk is made to match memory (rows which are only on disk are deleted!)
+	Recon_toMem  reconcile_direction = "MEM"  //memory is made to match disk (every row of disk is loaded)
+)
+
+// returns the quoted names of the columns <rt>'s rows are matched by
+func (rt *Rtable) keyCols() []string {
+	keys := rt.pkList("")
+	if len(keys) == 0 {
+		for _, c := range rt.cols {
+			keys = append(keys, "\""+c.name+"\"")
+		}
+	}
+	return keys
+}
+
+// returns the quoted names of <rt>'s columns which are not matched by (see keyCols), if any
+func (rt *Rtable) valueCols() []string {
+	var values []string
+	if len(rt.pkList("")) == 0 {
+		return values
+	}
+	for _, c := range rt.cols {
+		if !c.pk {
+			values = append(values, "\""+c.name+"\"")
+		}
+	}
+	return values
+}
+
+// returns an sql condition matching the rows of <a> and <b> (table aliases) by <cols>, NULLs matching each other
+func matchOn(a string, b string, cols []string) string {
+	matches := make([]string, len(cols))
+	for i, c := range cols {
+		matches[i] = a + "." + c + " IS " + b + "." + c
+	}
+	return strings.Join(matches, " AND ")
+}
+
+// without locking, tries to return all rows selected by <statement> on <db>
+func queryRows(ctx context.Context, db sqlx.QueryerContext, statement string, args ...any) (data [][]any, err error) {
+	rows, err := db.QueryxContext(ctx, statement, args...)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer rows.Close()
+
+	data = [][]any{}
+	for rows.Next() {
+		row, err := rows.SliceScan()
+		if err != nil {
+			return data, err
+		}
+		data = append(data, row)
+	}
+	return data, rows.Err()
+}
+
+// without locking, tries to return the differences of <rt> between "disk" and "main" on <db> (the in-memory database, with disk attached)
+func (rt *Rtable) diff(ctx context.Context, db sqlx.QueryerContext) (d TableDiff, err error) {
+	d = TableDiff{Table: rt.name, Changed: []RowChange{}}
+	keys := rt.keyCols()
+	order := " ORDER BY " + strings.Join(keys, ", ") + ";"
+	disk := "\"disk\".\"" + rt.name + "\""
+	mem := "\"main\".\"" + rt.name + "\""
+
+	d.DiskOnly, err = queryRows(ctx, db, "SELECT * FROM "+disk+" AS d WHERE NOT EXISTS (SELECT 1 FROM "+mem+" AS m WHERE "+matchOn("d", "m", keys)+")"+order)
+	if err != nil {
+		return d, err
+	}
+	d.MemOnly, err = queryRows(ctx, db, "SELECT * FROM "+mem+" AS m WHERE NOT EXISTS (SELECT 1 FROM "+disk+" AS d WHERE "+matchOn("d", "m", keys)+")"+order)
+	if err != nil {
+		return d, err
+	}
+
+	values := rt.valueCols()
+	if len(values) == 0 { //nothing outside the key to differ in
+		return d, nil
+	}
+
+	both, err := queryRows(ctx, db, "SELECT d.*, m.* FROM "+disk+" AS d JOIN "+mem+" AS m ON "+matchOn("d", "m", keys)+" WHERE NOT ("+matchOn("d", "m", values)+") ORDER BY "+strings.Join(rt.pkList("d."), ", ")+";")
+	if err != nil {
+		return d, err
+	}
+	for _, row := range both {
+		d.Changed = append(d.Changed, RowChange{Disk: row[:len(rt.cols)], Mem: row[len(rt.cols):]})
+	}
+	return d, nil
+}
+
+// without locking, tries to attach <src>'s disk to its in-memory database, run <f> in a transaction on the latter, and detach it again
+func (src *DataSrc) attached(ctx context.Context, f func(tx *sqlx.Tx) error) error {
+	_, err := src.mem.ExecContext(ctx, "ATTACH DATABASE \""+src.path+"\" AS \"disk\";")
+	if err != nil {
+		return err
+	}
+	defer src.mem.Exec("DETACH DATABASE \"disk\";")
+
+	return inTx(ctx, src.mem, f)
+}
+
+// tries to return the differences between the rows on disk and in memory of every table of <src> (in the order of GetTables)
+func (src *DataSrc) Diff() ([]TableDiff, error) {
+	return src.DiffContext(context.Background())
+}
+
+// same as Diff, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) DiffContext(ctx context.Context) (diffs []TableDiff, err error) {
+	if src == nil {
+		return []TableDiff{}, ErrNilSource
+	}
+	if src.mem == nil {
+		return []TableDiff{}, ErrNoMem
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := src.lock(ctx, true, true)
+	if err != nil {
+		return []TableDiff{}, err
+	}
+	defer src.unlock(true, memheld)
+	if !memheld { //memory was deleted in the meantime
+		return []TableDiff{}, ErrNoMem
+	}
+
+	err = src.attached(ctx, func(tx *sqlx.Tx) error {
+		diffs, err = src.diff(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return []TableDiff{}, err
+	}
+	return diffs, nil
+}
+
+// without locking, tries to return the differences of every table of <src> on <db> (the in-memory database, with disk attached)
+func (src *DataSrc) diff(ctx context.Context, db sqlx.QueryerContext) ([]TableDiff, error) {
+	diffs := make([]TableDiff, len(src.rtables))
+	for i, rt := range src.rtables {
+		d, err := rt.diff(ctx, db)
+		if err != nil {
+			return []TableDiff{}, err
+		}
+		diffs[i] = d
+	}
+	return diffs, nil
+}
+
+/*
+tries to make the rows on disk and in memory of every table of <src> equal, <dir> deciding which side wins (in one transaction)
+  - memory usually holds only some rows of disk, so Recon_toDisk deletes every other row from disk
+  - in write-back mode, the reconciled rows are no pending changes anymore
+*/
+func (src *DataSrc) Reconcile(dir reconcile_direction) (err error) {
+	return src.ReconcileContext(context.Background(), dir)
+}
+
+// same as Reconcile, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) ReconcileContext(ctx context.Context, dir reconcile_direction) (err error) {
+	if (dir != Recon_toDisk) && (dir != Recon_toMem) {
+		return ErrBadData
+	}
+
+	from, to := "\"main\"", "\"disk\""
+	if dir == Recon_toMem {
+		from, to = to, from
+	}
+
+	return src.reconcile(ctx, func(tx *sqlx.Tx) error {
+		for _, rt := range src.rtables {
+			keys, values := rt.keyCols(), rt.valueCols()
+			ftable := from + ".\"" + rt.name + "\""
+			ttable := to + ".\"" + rt.name + "\""
+
+			same := matchOn("x", "y", keys) //rows of <ttable> (x) which equal those of <ftable> (y)
+			if len(values) != 0 {
+				same += " AND " + matchOn("x", "y", values)
+			}
+			statements := []string{"DELETE FROM " + ttable + " AS x WHERE NOT EXISTS (SELECT 1 FROM " + ftable + " AS y WHERE " + matchOn("x", "y", keys) + ");",
+				"INSERT OR REPLACE INTO " + ttable + " SELECT * FROM " + ftable + " AS y WHERE NOT EXISTS (SELECT 1 FROM " + ttable + " AS x WHERE " + same + ");"}
+
+			for _, statement := range statements {
+				_, err := tx.ExecContext(ctx, statement)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+/*
+tries to make the rows on disk and in memory of every table of <src> equal, by asking <resolve> about every difference (see Diff) (in one transaction)
+  - <disk> or <mem> is nil if the row is only on the other side
+  - <resolve> returns the row to keep on both sides (all columns, as in Diff), nil to delete it from both, or an error to roll back everything
+  - in write-back mode, the reconciled rows are no pending changes anymore
+*/
+func (src *DataSrc) ReconcileFunc(resolve func(table string, disk []any, mem []any) ([]any, error)) (err error) {
+	return src.ReconcileFuncContext(context.Background(), resolve)
+}
+
+// same as ReconcileFunc, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) ReconcileFuncContext(ctx context.Context, resolve func(table string, disk []any, mem []any) ([]any, error)) (err error) {
+	if resolve == nil {
+		return ErrBadData
+	}
+
+	return src.reconcile(ctx, func(tx *sqlx.Tx) error {
+		diffs, err := src.diff(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		for i, d := range diffs {
+			rt := src.rtables[i]
+			for _, row := range d.DiskOnly {
+				err = rt.resolve(ctx, tx, resolve, row, nil)
+				if err != nil {
+					return err
+				}
+			}
+			for _, row := range d.MemOnly {
+				err = rt.resolve(ctx, tx, resolve, nil, row)
+				if err != nil {
+					return err
+				}
+			}
+			for _, c := range d.Changed {
+				err = rt.resolve(ctx, tx, resolve, c.Disk, c.Mem)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// without locking, tries to replace the row <disk> (on disk) and <mem> (in memory) of <rt> on <db> with the row <resolve> returns for them, on both sides
+func (rt *Rtable) resolve(ctx context.Context, db sqlx.ExecerContext, resolve func(table string, disk []any, mem []any) ([]any, error), disk []any, mem []any) error {
+	row, err := resolve(rt.name, disk, mem)
+	if err != nil {
+		return err
+	}
+	if (row != nil) && (len(row) != len(rt.cols)) {
+		return ErrBadData
+	}
+
+	keyed := rt.keyCols()
+	matches := make([]string, len(keyed))
+	keyidx := make([]int, 0, len(keyed))
+	for i, c := range rt.cols {
+		if c.pk || (len(keyed) == len(rt.cols)) {
+			keyidx = append(keyidx, i)
+		}
+	}
+	for i, k := range keyed {
+		matches[i] = k + " IS ?"
+	}
+
+	for _, side := range []struct {
+		schema string
+		old    []any
+	}{{"\"disk\"", disk}, {"\"main\"", mem}} {
+		table := side.schema + ".\"" + rt.name + "\""
+
+		if side.old != nil {
+			keyvals := make([]any, len(keyidx))
+			for i, idx := range keyidx {
+				keyvals[i] = side.old[idx]
+			}
+			_, err = db.ExecContext(ctx, "DELETE FROM "+table+" WHERE "+strings.Join(matches, " AND ")+";", keyvals...)
+			if err != nil {
+				return err
+			}
+		}
+
+		if row != nil {
+			_, err = db.ExecContext(ctx, "INSERT INTO "+table+" VALUES ("+strings.TrimSuffix(strings.Repeat("?, ", len(row)), ", ")+");", row...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tries to lock <src>, pause write-back tracking and run <f> in a transaction on its in-memory database with disk attached, then forget pending changes
+func (src *DataSrc) reconcile(ctx context.Context, f func(tx *sqlx.Tx) error) (err error) {
+	if src == nil {
+		return ErrNilSource
+	}
+	if src.mem == nil {
+		return ErrNoMem
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := src.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer src.unlock(true, memheld)
+	if !memheld { //memory was deleted in the meantime
+		return ErrNoMem
+	}
+
+	err = src.wbPause(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer src.wbPause(context.Background(), false) //reconciled rows are not changes
+
+	err = src.memFks(ctx, false) //rows are copied as they are, replacing or deleting one must not touch the rows referencing it
+	if err != nil {
+		return err
+	}
+	defer src.memFks(context.Background(), true)
+
+	return src.attached(ctx, func(tx *sqlx.Tx) error {
+		err := f(tx)
+		if (err != nil) || (src.wb == nil) {
+			return err
+		}
+
+		for _, rt := range src.rtables { //disk and memory are equal now
+			_, err = tx.ExecContext(ctx, "DELETE FROM \"temp\".\""+rt.wbTable()+"\";")
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
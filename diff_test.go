@@ -0,0 +1,128 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that diffs find rows only on disk, only in memory and changed ones, and that reconciling removes them
+func TestDiff(t *testing.T) {
+
+	//init
+	var tts = []dbops.Table{{Name: "df", Dd: false, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true},
+		{Name: "v", Ext: "TEXT", Pk: false}}},
+		{Name: "nopk", Dd: false, Cols: []dbops.Col{{Name: "v", Ext: "TEXT", Pk: false}}}}
+
+	src, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "df.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+
+	tbl := src.GetRtable(tts[0].Name)
+	nopk := src.GetRtable(tts[1].Name)
+	err = src.CreateMem()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//diverge: 1 only on disk, 2 changed, 3 equal, 4 only in memory
+	err = tbl.InsertData(dbops.Conf_abort, []any{1, "a", 2, "b", 3, "c"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.InsertMemData(dbops.Conf_abort, []any{2, "B", 3, "c", 4, "d"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = nopk.InsertMemData(dbops.Conf_abort, []any{"x"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	diffs, err := src.Diff()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := []dbops.TableDiff{{Table: "df", DiskOnly: [][]any{{int64(1), "a"}}, MemOnly: [][]any{{int64(4), "d"}},
+		Changed: []dbops.RowChange{{Disk: []any{int64(2), "b"}, Mem: []any{int64(2), "B"}}}},
+		{Table: "nopk", DiskOnly: [][]any{}, MemOnly: [][]any{{"x"}}, Changed: []dbops.RowChange{}}}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Fatalf("expected %v, got %v", expected, diffs)
+	}
+
+	//a resolver keeping the lesser id (of changed rows, the disk version), and dropping rows without a key
+	err = src.ReconcileFunc(func(table string, disk []any, mem []any) ([]any, error) {
+		switch {
+		case table == "nopk":
+			return nil, nil
+		case disk != nil:
+			return disk, nil
+		}
+		return []any{mem[0], "new"}, nil
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expectSame(t, src)
+	err = checkData(tbl, "id", [][]any{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}, {int64(4), "new"}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if nopk.Count() != 0 {
+		t.Fatalf("resolver did not delete")
+	}
+
+	//by direction
+	err = tbl.InsertMemData(dbops.Conf_replace, []any{1, "A", 5, "e"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = src.Reconcile(dbops.Recon_toMem)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expectSame(t, src)
+	err = checkData(tbl, "id", [][]any{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}, {int64(4), "new"}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	err = tbl.UnloadFromMem([]dbops.Condition{{Cname: "id", Op: dbops.Op_eq, Val: 4}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = nopk.InsertMemData(dbops.Conf_abort, []any{"y"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = src.Reconcile(dbops.Recon_toDisk)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expectSame(t, src)
+	err = checkData(tbl, "id", [][]any{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if nopk.Count() != 1 {
+		t.Fatalf("reconciling did not insert")
+	}
+}
+
+func expectSame(t *testing.T, src *dbops.DataSrc) {
+	t.Helper()
+
+	diffs, err := src.Diff()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, d := range diffs {
+		if !d.Empty() {
+			t.Fatalf("disk and memory still differ %v", d)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package dbops
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrForeignKey error = errors.New("ErrForeignKey (dbops) - The operation would leave rows (or foreign keys) referencing something which does not exist")
+
+// -------------------- FOREIGN KEYS --------------------
+
+// returns the DSN of the database at <path>, with which every connection of its pool enforces foreign keys (PRAGMA foreign_keys only affects one)
+func fkDSN(path string) string {
+	if strings.Contains(path, "?") { //the driver would take everything after it as parameters, so the path is escaped within a URI (whose parameters then begin after the path)
+		path = "file:" + (&url.URL{Path: path}).EscapedPath()
+	}
+	return path + "?_foreign_keys=on"
+}
+
+/*
+a reference from columns of a Table to columns of another (or the same) table, enforced on every connection dbops opens
+  - the referenced columns must be the primary key of RefTable, or have a unique index (checked by SQLite when rows are written, not when the table is created)
+  - the in-memory database usually holds only some rows of disk, so loading, unloading and reconciling rows neither checks nor acts on foreign keys
+*/
+type ForeignKey struct {
+	Cols     []string //names of the referencing columns, in order
+	RefTable string   //name of the referenced table
+	RefCols  []string //names of the referenced columns, in the order of Cols (nil -> the primary key of RefTable)
+
+	OnDelete fk_action //what happens to referencing rows once their referenced row is deleted
+	OnUpdate fk_action //what happens to referencing rows once the referenced columns of their referenced row change
+}
+
+type fk_action string //constants begin with "Fk_"; what happens to referencing rows of a ForeignKey
+const (
+	Fk_noAction   fk_action = ""            //nothing, but the statement fails if it leaves them referencing nothing (the default)
+	Fk_restrict   fk_action = "RESTRICT"    //nothing, and the statement fails at once if there are any
+	Fk_setNull    fk_action = "SET NULL"    //their referencing columns are set to NULL
+	Fk_setDefault fk_action = "SET DEFAULT" //their referencing columns are set to their default values
+	Fk_cascade    fk_action = "CASCADE"     //they are deleted along with the referenced row, or changed along with it
+)
+
+type rfkey struct {
+	cols     []string
+	refTable string
+	refCols  []string
+	onDelete fk_action
+	onUpdate fk_action
+}
+
+// returns whether <fk> and <rfk> are equal
+func pubPriFkEqual(fk ForeignKey, rfk rfkey) bool {
+	return (fk.RefTable == rfk.refTable) && (fk.OnDelete == rfk.onDelete) && (fk.OnUpdate == rfk.onUpdate) &&
+		slices.Equal(fk.Cols, rfk.cols) && slices.Equal(fk.RefCols, rfk.refCols)
+}
+
+// returns whether <a> and <b> are equal
+func rfkeyEqual(a rfkey, b rfkey) bool {
+	return pubPriFkEqual(a.pub(), b)
+}
+
+// returns whether <a> is one of the Fk_ constants
+func (a fk_action) valid() bool {
+	switch a {
+	case Fk_noAction, Fk_restrict, Fk_setNull, Fk_setDefault, Fk_cascade:
+		return true
+	}
+	return false
+}
+
+// checks whether <fk> can be a foreign key of a table with the columns <cnames>
+func (fk ForeignKey) valid(cnames stringset) bool {
+	if (fk.RefTable == "") || (fk.RefTable == LogTableName) {
+		return false
+	}
+	if (len(fk.Cols) == 0) || ((fk.RefCols != nil) && (len(fk.RefCols) != len(fk.Cols))) {
+		return false
+	}
+	for _, cname := range fk.Cols {
+		if !cnames.has(cname) {
+			return false
+		}
+	}
+	return fk.OnDelete.valid() && fk.OnUpdate.valid()
+}
+
+// converts <fk> to an rfkey
+func (fk ForeignKey) rfkey() rfkey {
+	return rfkey{cols: slices.Clone(fk.Cols), refTable: fk.RefTable, refCols: slices.Clone(fk.RefCols), onDelete: fk.OnDelete, onUpdate: fk.OnUpdate}
+}
+
+// converts <rfk> to a ForeignKey
+func (rfk rfkey) pub() ForeignKey {
+	return ForeignKey{Cols: slices.Clone(rfk.cols), RefTable: rfk.refTable, RefCols: slices.Clone(rfk.refCols), OnDelete: rfk.onDelete, OnUpdate: rfk.onUpdate}
+}
+
+// returns <cnames> quoted and joined, as in a column list
+func quoteList(cnames []string) string {
+	quoted := make([]string, len(cnames))
+	for i, cname := range cnames {
+		quoted[i] = "\"" + cname + "\""
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// returns the table constraint declaring <rfk>, e.g. `FOREIGN KEY("a") REFERENCES "t"("b") ON DELETE CASCADE`
+func (rfk rfkey) clause() string {
+	clause := "FOREIGN KEY(" + quoteList(rfk.cols) + ") REFERENCES \"" + rfk.refTable + "\""
+	if rfk.refCols != nil {
+		clause += "(" + quoteList(rfk.refCols) + ")"
+	}
+
+	if rfk.onDelete != Fk_noAction {
+		clause += " ON DELETE " + string(rfk.onDelete)
+	}
+	if rfk.onUpdate != Fk_noAction {
+		clause += " ON UPDATE " + string(rfk.onUpdate)
+	}
+	return clause
+}
+
+// without locking, tries to return the foreign keys of the table named <table> on <db> (in order of declaration)
+func readFkeys(db sqlx.Queryer, table string) (fkeys []rfkey, err error) {
+	type row struct {
+		Id       int            `db:"id"`
+		RefTable string         `db:"table"`
+		From     string         `db:"from"`
+		To       sql.NullString `db:"to"`
+		OnUpdate string         `db:"on_update"`
+		OnDelete string         `db:"on_delete"`
+	}
+	var rows []row
+	err = sqlx.Select(db, &rows, "SELECT \"id\", \"table\", \"from\", \"to\", \"on_update\", \"on_delete\" FROM pragma_foreign_key_list(?) ORDER BY \"id\" DESC, \"seq\";", table) //ids count from the last declared
+	if err != nil {
+		return nil, err
+	}
+
+	action := func(s string) fk_action {
+		if s == "NO ACTION" {
+			return Fk_noAction
+		}
+		return fk_action(s)
+	}
+
+	for i, r := range rows {
+		if (i == 0) || (r.Id != rows[i-1].Id) {
+			fkeys = append(fkeys, rfkey{refTable: r.RefTable, onDelete: action(r.OnDelete), onUpdate: action(r.OnUpdate)})
+		}
+		rfk := &fkeys[len(fkeys)-1]
+
+		rfk.cols = append(rfk.cols, r.From)
+		if r.To.Valid {
+			rfk.refCols = append(rfk.refCols, r.To.String)
+		}
+	}
+	return fkeys, nil
+}
+
+/*
+returns the foreign keys of <rt> with their columns renamed by <remap> (as in Edit), leaving out those with a column which is not copied
+  - columns a foreign key of <rt> references in itself are renamed as well
+*/
+func (rt *Rtable) remapFkeys(remap map[string]string) []rfkey {
+	rename := func(cnames []string) []string {
+		if cnames == nil {
+			return nil
+		}
+		ncnames := make([]string, len(cnames))
+		for i, cname := range cnames {
+			ncname, ok := remap[cname]
+			if !ok {
+				return nil
+			}
+			ncnames[i] = ncname
+		}
+		return ncnames
+	}
+
+	var nfkeys []rfkey
+	for _, rfk := range rt.fkeys {
+		nrfk := rfk
+		nrfk.cols = rename(rfk.cols)
+		if nrfk.cols == nil {
+			continue
+		}
+
+		if rfk.refTable == rt.name {
+			nrfk.refCols = rename(rfk.refCols)
+			if (rfk.refCols != nil) && (nrfk.refCols == nil) {
+				continue
+			}
+		}
+		nfkeys = append(nfkeys, nrfk)
+	}
+	return nfkeys
+}
+
+// returns whether every foreign key of <rtables> referencing the table named <name> (other than its own) still finds its columns in <ncols>
+func refsKept(rtables []*Rtable, name string, ncols []rcol) bool {
+	for _, rt := range rtables {
+		if rt.name == name {
+			continue
+		}
+
+		for _, rfk := range rt.fkeys {
+			if rfk.refTable != name {
+				continue
+			}
+
+			if rfk.refCols == nil {
+				if len((&Rtable{cols: ncols}).pkList("")) != len(rfk.cols) {
+					return false
+				}
+				continue
+			}
+			for _, cname := range rfk.refCols {
+				if !slices.ContainsFunc(ncols, func(c rcol) bool { return c.name == cname }) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// without locking, tries to return ErrForeignKey if a row of the tables named <tables> (nil -> all of them) in <schema> of <db> references a row which does not exist
+func fkCheck(ctx context.Context, db sqlx.QueryerContext, schema string, tables []string) error {
+	statements := []string{"PRAGMA \"" + schema + "\".foreign_key_check;"}
+	if tables != nil {
+		statements = statements[:0]
+		for _, table := range tables {
+			statements = append(statements, "PRAGMA \""+schema+"\".foreign_key_check(\""+table+"\");")
+		}
+	}
+
+	for _, statement := range statements {
+		rows, err := db.QueryxContext(ctx, statement)
+		if err != nil {
+			if strings.Contains(err.Error(), "foreign key mismatch") {
+				return ErrForeignKey
+			}
+			return err
+		}
+		violated := rows.Next()
+		err = rows.Err()
+		rows.Close()
+
+		if err != nil {
+			return err
+		}
+		if violated {
+			return ErrForeignKey
+		}
+	}
+	return nil
+}
+
+/*
+without locking, tries to run <f> in a transaction on a connection of <db> which does not enforce foreign keys, committing it if <f> succeeds
+  - this is how SQLite wants tables to be recreated, as dropping a referenced table would otherwise delete (or fail on) the rows referencing it
+  - check -> if a row of the main schema references a row which does not exist afterwards, rolls back (-> ErrForeignKey)
+*/
+func fkOffTx(ctx context.Context, db *sqlx.DB, check bool, f func(tx *sqlx.Tx) error) error {
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF;") //does nothing within a transaction
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, err := conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON;")
+		if err != nil { //the pool must not hand out a connection which does not enforce foreign keys
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = f(tx)
+	if (err == nil) && check {
+		err = fkCheck(ctx, tx, "main", nil)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// without locking, tries to stop (or resume) enforcing foreign keys on <src>'s in-memory database (which has only one connection), must not be called within a transaction on it
+func (src *DataSrc) memFks(ctx context.Context, on bool) error {
+	statement := "PRAGMA foreign_keys = OFF;"
+	if on {
+		statement = "PRAGMA foreign_keys = ON;"
+	}
+
+	_, err := src.mem.ExecContext(ctx, statement)
+	return err
+}
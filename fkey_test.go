@@ -0,0 +1,174 @@
+package dbops_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that foreign keys are created with their tables, enforced, discovered on connecting, and survive Edit
+func TestForeignKeys(t *testing.T) {
+
+	//init
+	path := filepath.Join(t.TempDir(), "fk.db")
+	var tts = []dbops.Table{{Name: "authors", Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true}, {Name: "name", Ext: "TEXT", Pk: false}}},
+		{Name: "books", Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true}, {Name: "author", Ext: "INTEGER", Pk: false}, {Name: "title", Ext: "TEXT", Pk: false}},
+			ForeignKeys: []dbops.ForeignKey{{Cols: []string{"author"}, RefTable: "authors", RefCols: []string{"id"}, OnDelete: dbops.Fk_cascade}}},
+		{Name: "notes", Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true}, {Name: "book", Ext: "INTEGER", Pk: false}},
+			ForeignKeys: []dbops.ForeignKey{{Cols: []string{"book"}, RefTable: "books", OnDelete: dbops.Fk_setNull, OnUpdate: dbops.Fk_cascade},
+				{Cols: []string{"id"}, RefTable: "notes", RefCols: []string{"id"}}}}}
+
+	_, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "bad.db"), []dbops.Table{{Name: "bad", Cols: tts[1].Cols, ForeignKeys: []dbops.ForeignKey{{Cols: []string{"nope"}, RefTable: "authors"}}}})
+	if err != dbops.ErrInvalidTable {
+		t.Fatalf("expected ErrInvalidTable for a foreign key on a missing column, got %v", err)
+	}
+
+	//a "?" in the path is not taken for the beginning of parameters
+	qpath := filepath.Join(t.TempDir(), "a?b", "fk.db")
+	src, err := dbops.CreateSrc(qpath, tts)
+	if err == nil {
+		err = src.GetRtable("authors").InsertData(dbops.Conf_abort, []any{1, "ann"})
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if src.GetRtable("books").InsertData(dbops.Conf_abort, []any{1, 9, "orphan"}) == nil {
+		t.Fatalf("foreign keys are not enforced on a database whose path contains \"?\"")
+	}
+	err = src.Disconnect()
+	if err == nil {
+		_, err = os.Stat(qpath)
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	src, err = dbops.CreateSrc(path, tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	authors, books, notes := src.GetRtable("authors"), src.GetRtable("books"), src.GetRtable("notes")
+
+	err = authors.InsertData(dbops.Conf_abort, []any{1, "ann", 2, "bob"})
+	if err == nil {
+		err = books.InsertData(dbops.Conf_abort, []any{1, 1, "a", 2, 2, "b", 3, 2, "c"})
+	}
+	if err == nil {
+		err = notes.InsertData(dbops.Conf_abort, []any{1, 1, 2, 3})
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//enforced
+	err = books.InsertData(dbops.Conf_abort, []any{4, 9, "orphan"})
+	if err == nil {
+		t.Fatalf("a book of a missing author was inserted")
+	}
+	err = src.Disconnect()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//discovered on connecting
+	src, err = dbops.ConnectSrc(path, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+	err = checkTables(src, tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	authors, books, notes = src.GetRtable("authors"), src.GetRtable("books"), src.GetRtable("notes")
+
+	//recreating a referenced table does not delete the rows referencing it
+	err = src.CreateMem()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = authors.Edit([]dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true}, {Name: "name", Ext: "TEXT", Pk: false}, {Name: "born", Ext: "INTEGER", Pk: false}},
+		map[string]string{"id": "id", "name": "name"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = checkData(books, "id", [][]any{{int64(1), int64(1), "a"}, {int64(2), int64(2), "b"}, {int64(3), int64(2), "c"}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//but a referenced column must not go
+	err = authors.Edit([]dbops.Col{{Name: "aid", Ext: "INTEGER", Pk: true}, {Name: "name", Ext: "TEXT", Pk: false}}, map[string]string{"id": "aid", "name": "name"})
+	if err != dbops.ErrForeignKey {
+		t.Fatalf("expected ErrForeignKey for removing a referenced column, got %v", err)
+	}
+
+	//the foreign keys of an edited table follow its renamed columns
+	err = books.Edit([]dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true}, {Name: "writer", Ext: "INTEGER", Pk: false}, {Name: "title", Ext: "TEXT", Pk: false}},
+		map[string]string{"id": "id", "author": "writer", "title": "title"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tts[0].Cols = append(tts[0].Cols, dbops.Col{Name: "born", Ext: "INTEGER", Pk: false})
+	tts[1].Cols[1].Name = "writer"
+	tts[1].ForeignKeys[0].Cols = []string{"writer"}
+	err = checkTables(src, tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = checkData(notes, "id", [][]any{{int64(1), int64(1)}, {int64(2), int64(3)}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//actions
+	err = authors.DeleteData([]dbops.Condition{{Cname: "id", Op: dbops.Op_eq, Val: 2}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = checkData(books, "id", [][]any{{int64(1), int64(1), "a"}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = checkData(notes, "id", [][]any{{int64(1), int64(1)}, {int64(2), nil}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//memory holds only some rows, so loading does not check them, but writing does
+	err = books.LoadIntoMem(0, -1, dbops.Conf_abort, []dbops.Condition{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = books.InsertMemData(dbops.Conf_abort, []any{5, 9, "orphan"})
+	if err == nil {
+		t.Fatalf("a book of a missing author was inserted into memory")
+	}
+
+	//flushing a changed row does not replace it, which would delete the rows referencing it
+	err = authors.LoadIntoMem(0, -1, dbops.Conf_abort, []dbops.Condition{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = src.EnableWriteBack(0, nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = authors.UpsertMemData(dbops.Upsert{}, []any{1, "ann b.", 1970})
+	if err == nil {
+		err = src.Flush()
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = checkData(authors, "id", [][]any{{int64(1), "ann b.", int64(1970)}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = checkData(books, "id", [][]any{{int64(1), int64(1), "a"}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+}
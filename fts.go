@@ -0,0 +1,222 @@
+package dbops
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// -------------------- FULL-TEXT SEARCH --------------------
+
+const ftsSuffix = "_fts" //the FTS5 index of a table with Fts is the virtual table named as the table, followed by this
+
+var ftsShadows = []string{"_data", "_idx", "_content", "_docsize", "_config"} //suffixes of the tables FTS5 keeps an index in
+
+// how Rtable.Search marks the matches in the text it returns
+type SearchMarks struct {
+	Open     string //put before each match, e.g. "<b>"
+	Close    string //put after each match, e.g. "</b>"
+	Ellipsis string //put where a snippet cuts the text, e.g. "..."
+	Tokens   int    //most words in a snippet (1 to 64, 0 -> 16)
+}
+
+// returns the names of the columns of <cols> which are indexed for Search (those with TEXT affinity)
+func ftsCols(cols []rcol) (cnames []string) {
+	for _, c := range cols {
+		if def, err := ParseColDef(c.ext); (err == nil) && (def.Affinity() == Aff_text) {
+			cnames = append(cnames, c.name)
+		}
+	}
+	return cnames
+}
+
+/*
+returns whether <cols> can have an FTS5 index made by Fts: they have a column to index (see ftsCols), and an INTEGER primary key of one column
+  - the index finds its rows by rowid, which only an INTEGER primary key keeps from being renumbered (e.g. by VACUUM)
+*/
+func ftsValid(cols []rcol) bool {
+	var pks []rcol
+	for _, c := range cols {
+		if c.pk {
+			pks = append(pks, c)
+		}
+	}
+	if len(pks) != 1 {
+		return false
+	}
+	def, err := ParseColDef(pks[0].ext)
+	return (err == nil) && strings.EqualFold(def.Type, "INTEGER") && (len(ftsCols(cols)) != 0)
+}
+
+/*
+without validating <rt>, returns sql statements creating its FTS5 index, and the triggers keeping it in sync with <rt>
+  - the index holds no text of its own, it reads <rt> by rowid (an "external content" table), which is its primary key (see ftsValid)
+  - updates only touch the index if they change an indexed column or the key, so e.g. marking rows "deleted" does not
+*/
+func (rt *Rtable) ftsStatements() []string {
+	fts := "\"" + rt.name + ftsSuffix + "\""
+	cnames := ftsCols(rt.cols)
+	cols := quoteList(cnames)
+	row := func(prefix string) string {
+		vals := make([]string, len(cnames))
+		for i, cname := range cnames {
+			vals[i] = prefix + ".\"" + cname + "\""
+		}
+		return prefix + ".rowid, " + strings.Join(vals, ", ")
+	}
+	insert := "INSERT INTO " + fts + "(rowid, " + cols + ") VALUES (" + row("new") + ");"
+	remove := "INSERT INTO " + fts + "(" + fts + ", rowid, " + cols + ") VALUES ('delete', " + row("old") + ");"
+	var key []string //changing it changes the rowid
+	for _, c := range rt.cols {
+		if c.pk {
+			key = append(key, c.name)
+		}
+	}
+	trigger := func(suffix string, event string, body string) string {
+		return "CREATE TRIGGER \"" + rt.name + ftsSuffix + "_" + suffix + "\" AFTER " + event + " ON \"" + rt.name + "\" BEGIN " + body + " END;"
+	}
+
+	return []string{"CREATE VIRTUAL TABLE " + fts + " USING fts5(" + cols + ", content='" + strings.ReplaceAll(rt.name, "'", "''") + "');",
+		trigger("ins", "INSERT", insert),
+		trigger("upd", "UPDATE OF "+quoteList(append(key, cnames...)), remove+" "+insert),
+		trigger("del", "DELETE", remove)}
+}
+
+// returns an sql statement dropping the FTS5 index of <rt> (its triggers are dropped along with <rt>)
+func (rt *Rtable) ftsDrop() string {
+	return "DROP TABLE IF EXISTS \"main\".\"" + rt.name + ftsSuffix + "\";"
+}
+
+/*
+returns the names of the tables of <statements> (of sqlite_master, by name) which have an FTS5 index made by Fts
+  - <skip> gets the names of these indexes and of the tables they are kept in, which are not tables of a DataSrc
+*/
+func ftsTables(statements map[string]string) (fts stringset, skip stringset) {
+	fts, skip = stringset{}, stringset{}
+	for name := range statements {
+		index, ok := statements[name+ftsSuffix]
+		if !ok || !strings.HasPrefix(strings.ToUpper(index), "CREATE VIRTUAL TABLE") || !strings.Contains(strings.ToLower(index), "fts5") {
+			continue
+		}
+
+		fts[name] = empty{}
+		skip[name+ftsSuffix] = empty{}
+		for _, shadow := range ftsShadows {
+			skip[name+ftsSuffix+shadow] = empty{}
+		}
+	}
+	return fts, skip
+}
+
+/*
+tries to return the rows of <rt> (on-disk) matching <match> (an FTS5 query, e.g. `go AND "full text"`, `title:sql*` or `NEAR(a b)`), best first
+  - each row holds the columns of <rt>, followed by its rank (a float, lower is better), a snippet of its best matching column, and each indexed column (see Table.Fts) with every match marked, all as set by <marks>
+  - negative <index> indexes from the end of the matches, instead of the beginning (-1 -> last item)
+  - negative <count> means how many matches to leave out of the selection (-1 -> leave out 0 rows)
+  - <condarr> specifies conditions which must be true for a row to be retrieved ("deleted" rows never are, see DeleteData)
+  - <rt> without Fts -> ErrIsNotPresent, a malformed <match> -> its error
+*/
+func (rt *Rtable) Search(match string, marks SearchMarks, index int, count int, condarr []Condition) (data [][]any, err error) {
+	return rt.SearchContext(context.Background(), match, marks, index, count, condarr)
+}
+
+// same as Search, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) SearchContext(ctx context.Context, match string, marks SearchMarks, index int, count int, condarr []Condition) (data [][]any, err error) {
+	if !rt.valid() {
+		return [][]any{}, ErrInvalidTable
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, true, false)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer rt.parent.unlock(true, false)
+
+	return rt.search(ctx, rt.parent.db, match, marks, index, count, condarr)
+}
+
+// same as Search, but on <rt>'s in-memory version (so only the rows loaded into memory are found)
+func (rt *Rtable) SearchMem(match string, marks SearchMarks, index int, count int, condarr []Condition) (data [][]any, err error) {
+	return rt.SearchMemContext(context.Background(), match, marks, index, count, condarr)
+}
+
+// same as SearchMem, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) SearchMemContext(ctx context.Context, match string, marks SearchMarks, index int, count int, condarr []Condition) (data [][]any, err error) {
+	if !rt.valid() {
+		return [][]any{}, ErrInvalidTable
+	}
+	if rt.parent.mem == nil {
+		return [][]any{}, ErrNoMem
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, false, true)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer rt.parent.unlock(false, true)
+
+	return rt.search(ctx, rt.parent.mem, match, marks, index, count, condarr)
+}
+
+// without locking, tries to return rows of <rt> on <db> as selected by Search
+func (rt *Rtable) search(ctx context.Context, db sqlx.QueryerContext, match string, marks SearchMarks, index int, count int, condarr []Condition) (data [][]any, err error) {
+	if !rt.fts {
+		return [][]any{}, ErrIsNotPresent
+	}
+	if marks.Tokens == 0 {
+		marks.Tokens = 16
+	}
+	if (marks.Tokens < 1) || (marks.Tokens > 64) {
+		return [][]any{}, ErrBadData
+	}
+
+	fts := "\"" + rt.name + ftsSuffix + "\""
+	selcols := make([]string, 0, len(rt.cols)+2)
+	for _, c := range rt.cols[rt.ddint:] {
+		selcols = append(selcols, "\"t\".\""+c.name+"\"")
+	}
+	selcols = append(selcols, fts+".rank", "snippet("+fts+", -1, ?, ?, ?, "+strconv.Itoa(marks.Tokens)+")")
+	selsubs := []any{marks.Open, marks.Close, marks.Ellipsis}
+	for i := range ftsCols(rt.cols) {
+		selcols = append(selcols, "highlight("+fts+", "+strconv.Itoa(i)+", ?, ?)")
+		selsubs = append(selsubs, marks.Open, marks.Close)
+	}
+
+	if rt.dd {
+		condarr = append(condarr[:len(condarr):len(condarr)], orgDdColIs0)
+	} //do not include "deleted" rows
+	where, subs, err := clausify_condition_array(condarr)
+	if err != nil {
+		return [][]any{}, err
+	}
+
+	//conditions are put into a subquery, where their columns cannot be confused with those of the index
+	from := "\"main\"." + fts + " JOIN (SELECT rowid AS \"fts_rowid\", * FROM \"main\".\"" + rt.name + "\"" + where + ") AS \"t\" ON \"t\".\"fts_rowid\" == " + fts + ".rowid WHERE " + fts + " MATCH ?"
+	subs = append(subs, match)
+	limit, offset, err := window(ctx, db, from, subs, index, count)
+	if err != nil {
+		return [][]any{}, err
+	}
+	statement := "SELECT " + strings.Join(selcols, ", ") + " FROM " + from + " ORDER BY " + fts + ".rank LIMIT " + strconv.Itoa(limit) + " OFFSET " + strconv.Itoa(offset) + ";"
+
+	rows, err := db.QueryxContext(ctx, statement, append(selsubs, subs...)...)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row_vals, err := rows.SliceScan()
+		if err != nil {
+			return data, err
+		}
+		data = append(data, row_vals)
+	}
+	return data, rows.Err()
+}
@@ -0,0 +1,162 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that tables with Fts are searchable, kept in sync by inserts, updates and deletes, discovered on connecting, and survive Edit (needs FTS5, e.g. go test -tags sqlite_fts5)
+func TestSearch(t *testing.T) {
+
+	//init
+	path := filepath.Join(t.TempDir(), "fts.db")
+	var tts = []dbops.Table{{Name: "posts", Dd: true, Fts: true, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true},
+		{Name: "title", Ext: "TEXT", Pk: false}, {Name: "body", Ext: "TEXT", Pk: false}, {Name: "votes", Ext: "INTEGER", Pk: false}}}}
+
+	src, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "probe.db"), nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	disk, _ := src.Release()
+	var enabled bool
+	err = disk.Get(&enabled, "SELECT sqlite_compileoption_used('ENABLE_FTS5');")
+	if err == nil {
+		err = src.Reclaim(true, true)
+	}
+	if err == nil {
+		err = src.Disconnect()
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !enabled {
+		t.Skip("SQLite was built without FTS5")
+	}
+
+	_, err = dbops.CreateSrc(filepath.Join(t.TempDir(), "bad.db"), []dbops.Table{{Name: "bad", Fts: true, Cols: []dbops.Col{{Name: "n", Ext: "INTEGER", Pk: false}}}})
+	if err != dbops.ErrInvalidTable {
+		t.Fatalf("expected ErrInvalidTable for Fts without TEXT columns, got %v", err)
+	}
+	_, err = dbops.CreateSrc(filepath.Join(t.TempDir(), "bad.db"), []dbops.Table{{Name: "bad", Fts: true, Cols: []dbops.Col{{Name: "s", Ext: "TEXT", Pk: true}}}})
+	if err != dbops.ErrInvalidTable {
+		t.Fatalf("expected ErrInvalidTable for Fts without an INTEGER primary key, got %v", err)
+	}
+
+	src, err = dbops.CreateSrc(path, tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	posts := src.GetRtable("posts")
+	err = posts.InsertData(dbops.Conf_abort, []any{1, "go databases", "sqlite from go, with full text search", 3,
+		2, "cooking", "how to cook pasta", 5,
+		3, "search engines", "ranking full text matches", 1,
+		4, "old post", "search for old things", 9})
+	if err == nil {
+		err = posts.DeleteData([]dbops.Condition{{Cname: "id", Op: dbops.Op_eq, Val: 4}})
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	ids := func(data [][]any) (ids []any) {
+		for _, row := range data {
+			ids = append(ids, row[0])
+		}
+		return ids
+	}
+
+	//ranked, with snippets and highlights, "deleted" rows left out
+	marks := dbops.SearchMarks{Open: "[", Close: "]", Ellipsis: "..."}
+	data, err := posts.Search("search", marks, 0, -1, []dbops.Condition{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !reflect.DeepEqual(ids(data), []any{int64(3), int64(1)}) {
+		t.Fatalf("expected posts 3 and 1, got %v", data)
+	}
+	if len(data[0]) != 4+4 {
+		t.Fatalf("expected the columns, the rank, a snippet and 2 highlights, got %v", data[0])
+	}
+	if _, ok := data[0][4].(float64); !ok {
+		t.Fatalf("expected a float rank, got %#v", data[0][4])
+	}
+	if (data[0][5] != "[search] engines") || (data[0][6] != "[search] engines") || (data[1][7] != "sqlite from go, with full text [search]") {
+		t.Fatalf("unexpected snippets or highlights: %v", data)
+	}
+
+	//with conditions on the rows and FTS5 queries
+	data, err = posts.Search("full AND text", marks, 0, -1, []dbops.Condition{{Cname: "votes", Op: dbops.Op_more, Val: 2}})
+	if err != nil || !reflect.DeepEqual(ids(data), []any{int64(1)}) {
+		t.Fatalf("expected post 1, got %v (%v)", data, err)
+	}
+	_, err = posts.Search("AND AND", marks, 0, -1, []dbops.Condition{})
+	if err == nil {
+		t.Fatalf("a malformed query did not fail")
+	}
+
+	//kept in sync
+	_, err = posts.UpdateData(map[string]any{"title": "pasta"}, []dbops.Condition{{Cname: "id", Op: dbops.Op_eq, Val: 3}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	data, err = posts.Search("title:pasta", marks, 0, -1, []dbops.Condition{})
+	if err != nil || !reflect.DeepEqual(ids(data), []any{int64(3)}) {
+		t.Fatalf("expected post 3, got %v (%v)", data, err)
+	}
+	err = src.Disconnect()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//discovered on connecting, the index is not a table
+	src, err = dbops.ConnectSrc(path, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+	err = checkTables(src, tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	posts = src.GetRtable("posts")
+
+	//survives Edit, with the new columns
+	err = posts.Edit([]dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true}, {Name: "title", Ext: "TEXT", Pk: false}, {Name: "votes", Ext: "INTEGER", Pk: false}, {Name: "tags", Ext: "TEXT", Pk: false}},
+		map[string]string{"id": "id", "title": "title", "votes": "votes"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, err = posts.UpdateData(map[string]any{"tags": "kitchen"}, []dbops.Condition{{Cname: "id", Op: dbops.Op_eq, Val: 2}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	data, err = posts.Search("pasta OR kitchen", marks, 0, -1, []dbops.Condition{{Cname: "id", Op: dbops.Op_neq, Val: 4}})
+	if err != nil || !reflect.DeepEqual(ids(data), []any{int64(2), int64(3)}) && !reflect.DeepEqual(ids(data), []any{int64(3), int64(2)}) {
+		t.Fatalf("expected posts 2 and 3, got %v (%v)", data, err)
+	}
+
+	//in memory, as loaded
+	err = src.CreateMem()
+	if err == nil {
+		err = posts.LoadIntoMem(0, -1, dbops.Conf_abort, []dbops.Condition{{Cname: "id", Op: dbops.Op_eq, Val: 3}})
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	data, err = posts.SearchMem("pasta", marks, 0, -1, []dbops.Condition{})
+	if err != nil || !reflect.DeepEqual(ids(data), []any{int64(3)}) {
+		t.Fatalf("expected post 3 in memory, got %v (%v)", data, err)
+	}
+
+	//without Fts
+	err = src.AddTable(dbops.Table{Name: "plain", Cols: []dbops.Col{{Name: "text", Ext: "TEXT", Pk: false}}})
+	if err == nil {
+		_, err = src.GetRtable("plain").Search("x", marks, 0, -1, []dbops.Condition{})
+	}
+	if err != dbops.ErrIsNotPresent {
+		t.Fatalf("expected ErrIsNotPresent for searching a table without Fts, got %v", err)
+	}
+}
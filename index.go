@@ -0,0 +1,344 @@
+package dbops
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// -------------------- INDEXES --------------------
+
+// an index on columns of a Table, created and kept along with it
+type Index struct {
+	Name   string   //Name (unique within the whole database, must not begin with "sqlite_")
+	Cols   []string //names of the indexed columns, in order
+	Unique bool     //whether no two rows may have the same values in Cols
+
+	Where string //condition of a partial index (only rows where it is true are indexed, "" -> all rows); build it from conditions with IndexWhere
+}
+
+type rindex struct {
+	name   string
+	cols   []string
+	unique bool
+	where  string
+}
+
+// returns whether <idx> and <ridx> are equal
+func pubPriIdxEqual(idx Index, ridx rindex) bool {
+	return (idx.Name == ridx.name) && (idx.Unique == ridx.unique) && (idx.Where == ridx.where) && slices.Equal(idx.Cols, ridx.cols)
+}
+
+// returns whether <a> and <b> are equal
+func rindexEqual(a rindex, b rindex) bool {
+	return (a.name == b.name) && (a.unique == b.unique) && (a.where == b.where) && slices.Equal(a.cols, b.cols)
+}
+
+// checks whether <idx> can be an index of a table with the columns <cnames>
+func (idx Index) valid(cnames stringset) bool {
+	if (idx.Name == "") || strings.HasPrefix(strings.ToLower(idx.Name), "sqlite_") {
+		return false
+	}
+	if len(idx.Cols) == 0 {
+		return false
+	}
+	for _, cname := range idx.Cols {
+		if !cnames.has(cname) {
+			return false
+		}
+	}
+	return true
+}
+
+// converts <idx> to an rindex
+func (idx Index) rindex() rindex {
+	return rindex{name: idx.Name, cols: slices.Clone(idx.Cols), unique: idx.Unique, where: idx.Where}
+}
+
+// converts <ridx> to an Index
+func (ridx rindex) pub() Index {
+	return Index{Name: ridx.name, Cols: slices.Clone(ridx.cols), Unique: ridx.unique, Where: ridx.where}
+}
+
+// returns an sql statement creating <ridx> on the table named <table>
+func (ridx rindex) crStatement(table string) string {
+	statement := "CREATE INDEX"
+	if ridx.unique {
+		statement = "CREATE UNIQUE INDEX"
+	}
+
+	cols := make([]string, len(ridx.cols))
+	for i, cname := range ridx.cols {
+		cols[i] = "\"" + cname + "\""
+	}
+	statement += " \"" + ridx.name + "\" ON \"" + table + "\"(" + strings.Join(cols, ", ") + ")"
+
+	if ridx.where != "" {
+		statement += " WHERE " + ridx.where
+	}
+	return statement + ";"
+}
+
+// without validating <t>, returns sql statements for its creation, along with its indexes (and its index for Search)
+func (t *Rtable) crStatements() []string {
+	statements := []string{t.crStatement()}
+	for _, ridx := range t.indexes {
+		statements = append(statements, ridx.crStatement(t.name))
+	}
+	if t.fts {
+		statements = append(statements, t.ftsStatements()...)
+	}
+	return statements
+}
+
+/*
+tries to turn <condarr> into a condition for Index.Where (values are written into it, as an index cannot have parameters)
+  - values can be nil, bool, integers, floats, strings, []byte or time.Time
+*/
+func IndexWhere(condarr []Condition) (string, error) {
+	where, subs, err := clausify_conditions(condarr)
+	if err != nil {
+		return "", err
+	}
+	return inline(where, subs)
+}
+
+// tries to write <subs> into the places of the "?" (outside of quotes) of <clause>, as sql literals (see literal)
+func inline(clause string, subs []any) (string, error) {
+	var b strings.Builder
+	var quote rune
+	for _, r := range clause {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case (r == '"') || (r == '\''):
+			quote = r
+		case r == '?':
+			if len(subs) == 0 {
+				return "", ErrBadData
+			}
+			lit, err := literal(subs[0])
+			if err != nil {
+				return "", err
+			}
+			subs = subs[1:]
+
+			b.WriteString(lit)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String(), nil
+}
+
+// tries to return <v> as an sql literal
+func literal(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "NULL", nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'", nil
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'", nil
+	case time.Time:
+		return "'" + v.Format("2006-01-02 15:04:05.999999999-07:00") + "'", nil //as the driver writes it
+	}
+	return "", ErrBadData
+}
+
+// returns the condition of the partial index created by <statement> ("" -> none)
+func indexWhere(statement string) string {
+	var quote rune
+	depth := 0
+	for i, r := range statement {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case (r == '"') || (r == '\'') || (r == '`'):
+			quote = r
+		case r == '[':
+			quote = ']'
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth != 0 {
+				continue
+			}
+
+			rest := strings.TrimSpace(statement[i+1:])
+			if len(rest) > len("WHERE") && strings.EqualFold(rest[:len("WHERE")], "WHERE") {
+				return strings.TrimSuffix(strings.TrimSpace(rest[len("WHERE"):]), ";")
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// without locking, tries to return the indexes of the table named <table> on <db> (only those created by CREATE INDEX on columns, in order of creation)
+func readIndexes(db sqlx.Queryer, table string) (indexes []rindex, err error) {
+	type row struct {
+		Name      string `db:"name"`
+		Statement string `db:"sql"`
+	}
+	var rows []row
+	err = sqlx.Select(db, &rows, "SELECT \"name\", \"sql\" FROM \"main\".sqlite_master WHERE \"type\" = 'index' AND \"tbl_name\" = ? AND \"sql\" IS NOT NULL ORDER BY rowid;", table)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rows {
+		var cnames []sql.NullString
+		err = sqlx.Select(db, &cnames, "SELECT \"name\" FROM pragma_index_info(?) ORDER BY \"seqno\";", r.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		ridx := rindex{name: r.Name, where: indexWhere(r.Statement)}
+		for _, cname := range cnames {
+			if !cname.Valid { //an index on an expression cannot be an Index
+				ridx.cols = nil
+				break
+			}
+			ridx.cols = append(ridx.cols, cname.String)
+		}
+		if ridx.cols == nil {
+			continue
+		}
+
+		head, _, _ := strings.Cut(strings.ToUpper(strings.TrimSpace(r.Statement)), "INDEX")
+		ridx.unique = strings.Contains(head, "UNIQUE")
+
+		indexes = append(indexes, ridx)
+	}
+	return indexes, nil
+}
+
+// tries to create <idx> on <rt> (both disk and memory)
+func (rt *Rtable) AddIndex(idx Index) (err error) {
+	return rt.AddIndexContext(context.Background(), idx)
+}
+
+// same as AddIndex, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) AddIndexContext(ctx context.Context, idx Index) (err error) {
+	if !rt.valid() {
+		return ErrInvalidTable
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := rt.parent.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.unlock(true, memheld)
+
+	cnames := make(stringset, len(rt.cols))
+	for _, c := range rt.cols {
+		cnames[c.name] = empty{}
+	}
+	if !idx.valid(cnames) {
+		return ErrInvalidTable
+	}
+	for _, ridx := range rt.indexes {
+		if ridx.name == idx.Name {
+			return ErrIsDuplicate
+		}
+	}
+
+	ridx := idx.rindex()
+	statement := ridx.crStatement(rt.name)
+
+	_, err = rt.parent.db.ExecContext(ctx, statement)
+	if err != nil {
+		return err
+	}
+	if memheld {
+		_, err = rt.parent.mem.ExecContext(ctx, statement)
+		if err != nil {
+			rt.parent.db.ExecContext(ctx, "DROP INDEX \"main\".\""+ridx.name+"\";") //keep disk and memory alike
+			return err
+		}
+	}
+
+	rt.indexes = append(rt.indexes, ridx)
+	return nil
+}
+
+// tries to delete the index named <name> of <rt> (both disk and memory), none -> ErrIsNotPresent
+func (rt *Rtable) DelIndex(name string) (err error) {
+	return rt.DelIndexContext(context.Background(), name)
+}
+
+// same as DelIndex, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) DelIndexContext(ctx context.Context, name string) (err error) {
+	if !rt.valid() {
+		return ErrInvalidTable
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := rt.parent.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.unlock(true, memheld)
+
+	iidx := slices.IndexFunc(rt.indexes, func(ridx rindex) bool { return ridx.name == name })
+	if iidx == -1 {
+		return ErrIsNotPresent
+	}
+
+	for _, db := range []*sqlx.DB{rt.parent.db, rt.parent.mem} {
+		if (db == nil) || ((db == rt.parent.mem) && !memheld) {
+			continue
+		}
+		_, err = db.ExecContext(ctx, "DROP INDEX IF EXISTS \"main\".\""+name+"\";")
+		if err != nil {
+			return err
+		}
+	}
+
+	rt.indexes = slices.Delete(rt.indexes, iidx, iidx+1)
+	return nil
+}
@@ -0,0 +1,128 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that indexes are created with their tables, discovered on connecting, and kept by Edit
+func TestIndexes(t *testing.T) {
+
+	//init
+	path := filepath.Join(t.TempDir(), "idx.db")
+	active, err := dbops.IndexWhere([]dbops.Condition{{Cname: "state", Op: dbops.Op_eq, Val: "it's on"}, {Lrel: true, Cname: "n", Op: dbops.Op_in, Val: []any{1, 2.5, nil}}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if active != "(\"state\"  ==  'it''s on' ) AND (\"n\" IN (1, 2.5, NULL) )" {
+		t.Fatalf("unexpected index condition %s", active)
+	}
+	_, err = dbops.IndexWhere([]dbops.Condition{{Cname: "state", Op: dbops.Op_eq, Val: struct{}{}}})
+	if err != dbops.ErrBadData {
+		t.Fatalf("expected ErrBadData, got %v", err)
+	}
+
+	var tts = []dbops.Table{{Name: "items", Dd: true, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true},
+		{Name: "code", Ext: "TEXT", Pk: false}, {Name: "state", Ext: "TEXT", Pk: false}, {Name: "n", Ext: "INTEGER", Pk: false}},
+		Indexes: []dbops.Index{{Name: "items_state", Cols: []string{"state"}},
+			{Name: "items_code_n", Cols: []string{"code", "n"}, Unique: true},
+			{Name: "items_active_code", Cols: []string{"code"}, Unique: true, Where: active}}}}
+
+	_, err = dbops.CreateSrc(filepath.Join(t.TempDir(), "bad.db"), []dbops.Table{{Name: "bad", Cols: tts[0].Cols, Indexes: []dbops.Index{{Name: "bad_i", Cols: []string{"nope"}}}}})
+	if err != dbops.ErrInvalidTable {
+		t.Fatalf("expected ErrInvalidTable for an index on a missing column, got %v", err)
+	}
+
+	src, err := dbops.CreateSrc(path, tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tbl := src.GetRtable("items")
+
+	//unique, and unique only where the partial index applies
+	err = tbl.InsertData(dbops.Conf_abort, []any{1, "a", "off", 1, 2, "a", "off", 2, 3, "b", "it's on", 1})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.InsertData(dbops.Conf_abort, []any{4, "a", "off", 1})
+	if err == nil {
+		t.Fatalf("composite unique index was not created")
+	}
+	err = tbl.InsertData(dbops.Conf_abort, []any{4, "b", "it's on", 2.5})
+	if err == nil {
+		t.Fatalf("partial unique index was not created")
+	}
+	err = src.Disconnect()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//discovered on connecting
+	src, err = dbops.ConnectSrc(path, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+	err = checkTables(src, tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//kept (and renamed) by Edit, unless a column is gone
+	tbl = src.GetRtable("items")
+	err = src.CreateMem()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.Edit([]dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true}, {Name: "code", Ext: "TEXT", Pk: false}, {Name: "status", Ext: "TEXT", Pk: false}},
+		map[string]string{"id": "id", "code": "code", "state": "status"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	edited := []dbops.Table{{Name: "items", Dd: true, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true},
+		{Name: "code", Ext: "TEXT", Pk: false}, {Name: "status", Ext: "TEXT", Pk: false}},
+		Indexes: []dbops.Index{{Name: "items_state", Cols: []string{"status"}}}}}
+	err = checkTables(src, edited)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//added and deleted on an existing table, in memory as well
+	err = tbl.AddIndex(dbops.Index{Name: "items_code", Cols: []string{"code"}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.AddIndex(dbops.Index{Name: "items_code", Cols: []string{"id"}})
+	if err != dbops.ErrIsDuplicate {
+		t.Fatalf("expected ErrIsDuplicate, got %v", err)
+	}
+	_, mem := src.Release()
+	var n int
+	err = mem.Get(&n, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'items_code';")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n != 1 {
+		t.Fatalf("index was not added in memory")
+	}
+	err = src.Reclaim(true, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.DelIndex("items_state")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.DelIndex("items_state")
+	if err != dbops.ErrIsNotPresent {
+		t.Fatalf("expected ErrIsNotPresent, got %v", err)
+	}
+
+	edited[0].Indexes = []dbops.Index{{Name: "items_code", Cols: []string{"code"}}}
+	err = checkTables(src, edited)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+}
@@ -0,0 +1,269 @@
+package dbops
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// -------------------- JOINS --------------------
+
+/*
+a query over several Rtables of one DataSrc, built by Rtable.Join, then JoinQuery.Join and JoinQuery.Select
+  - the rows are made of the columns of every table, in the order they were joined (or of the columns chosen by Select)
+  - Conditions and Orders passed to it name the table of their column by Tname
+  - "deleted" rows of any table are left out, as if they were not in it (see DeleteData)
+  - an error made while building it is returned once it is run
+*/
+type JoinQuery struct {
+	tables []*Rtable
+	joins  []string //the join clause of each table after the first
+	cols   []JoinCol
+	err    error
+}
+
+// a column of a table in a JoinQuery
+type JoinCol struct {
+	Tname string
+	Cname string
+}
+
+// a pair of columns which must be equal for rows of two tables to be joined
+type JoinOn struct {
+	Tname string //name of a table which already is in the query
+	Cname string //name of its column
+	With  string //name of the column of the joined table
+}
+
+type join_kind string //constants begin with "Join_"; how rows without a match in the joined table are treated
+const (
+	Join_inner join_kind = "INNER JOIN" //they are left out
+	Join_left  join_kind = "LEFT JOIN"  //they are kept, the joined table's columns being NULL
+)
+
+/*
+returns a JoinQuery of <rt> joined with <other> (which must be of the same DataSrc) on the columns <on>
+  - see JoinQuery.Join
+*/
+func (rt *Rtable) Join(other *Rtable, kind join_kind, on []JoinOn) *JoinQuery {
+	q := &JoinQuery{}
+	if !rt.valid() {
+		q.err = ErrInvalidTable
+		return q
+	}
+	q.tables = []*Rtable{rt}
+	return q.Join(other, kind, on)
+}
+
+/*
+adds <other> (which must be of the same DataSrc) to <q>, joined with the tables already in it on the columns <on>, and returns <q>
+  - a table can only be in a query once -> ErrIsDuplicate
+  - a column of <on> which its table does not have -> ErrIsNotPresent, no <on> or an invalid <kind> -> ErrBadData
+*/
+func (q *JoinQuery) Join(other *Rtable, kind join_kind, on []JoinOn) *JoinQuery {
+	if q.err != nil {
+		return q
+	}
+	if !other.valid() || (other.parent != q.tables[0].parent) {
+		q.err = ErrInvalidTable
+		return q
+	}
+	if q.table(other.name) != nil {
+		q.err = ErrIsDuplicate
+		return q
+	}
+	if ((kind != Join_inner) && (kind != Join_left)) || (len(on) == 0) {
+		q.err = ErrBadData
+		return q
+	}
+
+	pairs := make([]string, 0, len(on)+1)
+	for _, o := range on {
+		rt := q.table(o.Tname)
+		if (rt == nil) || !rt.hasCol(o.Cname) || !other.hasCol(o.With) {
+			q.err = ErrIsNotPresent
+			return q
+		}
+		pairs = append(pairs, "("+qualName(rt.name, o.Cname)+" == "+qualName(other.name, o.With)+")")
+	}
+	if other.dd {
+		pairs = append(pairs, "("+qualName(other.name, orgDdCol.name)+" == 0)")
+	} //a "deleted" row matches nothing, so it is not there even for a left join
+
+	q.tables = append(q.tables, other)
+	q.joins = append(q.joins, " "+string(kind)+" \""+other.name+"\" ON "+strings.Join(pairs, " AND "))
+	return q
+}
+
+/*
+chooses the columns returned by <q>, in order, and returns <q>
+  - a column which is not in the query -> ErrIsNotPresent (once it is run)
+*/
+func (q *JoinQuery) Select(cols []JoinCol) *JoinQuery {
+	if q.err != nil {
+		return q
+	}
+	for _, c := range cols {
+		rt := q.table(c.Tname)
+		if (rt == nil) || !rt.hasCol(c.Cname) {
+			q.err = ErrIsNotPresent
+			return q
+		}
+	}
+	q.cols = cols
+	return q
+}
+
+/*
+tries to return a slice of slices, which represent rows of <q> (on-disk)
+  - negative <index> indexes from the end of the rows, instead of the beginning (-1 -> last item)
+  - negative <count> means how many rows to leave out of the selection (-1 -> leave out 0 rows)
+  - <condarr> specifies conditions which must be true for a row to be retrieved
+  - <ordarr> specifies the order of retrieval
+*/
+func (q *JoinQuery) Get(index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	return q.GetContext(context.Background(), index, count, condarr, ordarr)
+}
+
+// same as Get, but gives up once <ctx> is done (-> ctx.Err())
+func (q *JoinQuery) GetContext(ctx context.Context, index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	if err = q.check(); err != nil {
+		return [][]any{}, err
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	src := q.tables[0].parent
+	_, err = src.lock(ctx, true, false)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer src.unlock(true, false)
+
+	return q.get(ctx, src.db, index, count, condarr, ordarr)
+}
+
+// same as Get, but on the in-memory versions of the tables of <q>
+func (q *JoinQuery) GetMem(index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	return q.GetMemContext(context.Background(), index, count, condarr, ordarr)
+}
+
+// same as GetMem, but gives up once <ctx> is done (-> ctx.Err())
+func (q *JoinQuery) GetMemContext(ctx context.Context, index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	if err = q.check(); err != nil {
+		return [][]any{}, err
+	}
+	src := q.tables[0].parent
+	if src.mem == nil {
+		return [][]any{}, ErrNoMem
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = src.lock(ctx, false, true)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer src.unlock(false, true)
+
+	return q.get(ctx, src.mem, index, count, condarr, ordarr)
+}
+
+// returns the error made while building <q>, or ErrInvalidTable if one of its tables is no longer valid
+func (q *JoinQuery) check() error {
+	if q == nil {
+		return ErrInvalidTable
+	}
+	if q.err != nil {
+		return q.err
+	}
+	for _, rt := range q.tables {
+		if !rt.valid() {
+			return ErrInvalidTable
+		}
+	}
+	return nil
+}
+
+// returns the table of <q> named <name> (none -> nil)
+func (q *JoinQuery) table(name string) *Rtable {
+	for _, rt := range q.tables {
+		if rt.name == name {
+			return rt
+		}
+	}
+	return nil
+}
+
+// returns whether <rt> has a column (other than the dd col) named <cname>
+func (rt *Rtable) hasCol(cname string) bool {
+	for _, c := range rt.cols[rt.ddint:] {
+		if c.name == cname {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the result columns of a SELECT statement for <q>, as one string
+func (q *JoinQuery) selCols() string {
+	selcols := make([]string, 0, len(q.cols))
+	for _, c := range q.cols {
+		selcols = append(selcols, qualName(c.Tname, c.Cname))
+	}
+	if len(q.cols) == 0 {
+		for _, rt := range q.tables {
+			for _, c := range rt.cols[rt.ddint:] {
+				selcols = append(selcols, qualName(rt.name, c.name))
+			}
+		}
+	}
+	return strings.Join(selcols, ", ")
+}
+
+// tries to return what follows FROM in a SELECT statement for <q> (up to and including the where clause of <condarr>), and the values to substitute into it (<qual> -> the first table as "main"."<name>")
+func (q *JoinQuery) from(condarr []Condition, qual bool) (from string, subs []any, err error) {
+	first := q.tables[0]
+	if first.dd {
+		condarr = append(condarr[:len(condarr):len(condarr)], Condition{Ljoin: true, Lrel: true, Tname: first.name, Cname: orgDdCol.name, Op: Op_eq, Val: 0})
+	} //do not include "deleted" rows (of the joined tables, see Join)
+	where, subs, err := clausify_condition_array(condarr)
+	if err != nil {
+		return "", nil, err
+	}
+	from = "\"" + first.name + "\""
+	if qual {
+		from = "\"main\"." + from
+	}
+	return from + strings.Join(q.joins, "") + where, subs, nil
+}
+
+// without locking, tries to return rows of <q> on <db> as selected by Get
+func (q *JoinQuery) get(ctx context.Context, db sqlx.QueryerContext, index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	from, subs, err := q.from(condarr, true)
+	if err != nil {
+		return [][]any{}, err
+	}
+	limit, offset, err := window(ctx, db, from, subs, index, count)
+	if err != nil {
+		return [][]any{}, err
+	}
+	statement := "SELECT " + q.selCols() + " FROM " + from + clausify_order_array(ordarr) + " LIMIT " + strconv.Itoa(limit) + " OFFSET " + strconv.Itoa(offset) + ";"
+
+	rows, err := db.QueryxContext(ctx, statement, subs...)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row_vals, err := rows.SliceScan()
+		if err != nil {
+			return data, err
+		}
+		data = append(data, row_vals)
+	}
+	return data, rows.Err()
+}
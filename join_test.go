@@ -0,0 +1,101 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests inner and left joins with qualified conditions and orders, leaving out "deleted" rows of every table, on disk and in memory
+func TestJoin(t *testing.T) {
+
+	//init
+	var tts = []dbops.Table{{Name: "authors", Dd: true, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true}, {Name: "name", Ext: "TEXT", Pk: false}}},
+		{Name: "books", Dd: true, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true}, {Name: "author", Ext: "INTEGER", Pk: false}, {Name: "title", Ext: "TEXT", Pk: false}}},
+		{Name: "reviews", Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true}, {Name: "book", Ext: "INTEGER", Pk: false}, {Name: "stars", Ext: "INTEGER", Pk: false}}}}
+
+	src, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "join.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+	authors, books, reviews := src.GetRtable("authors"), src.GetRtable("books"), src.GetRtable("reviews")
+
+	err = authors.InsertData(dbops.Conf_abort, []any{1, "ann", 2, "bob", 3, "cid", 4, "dan"})
+	if err == nil {
+		err = books.InsertData(dbops.Conf_abort, []any{1, 1, "a", 2, 1, "b", 3, 2, "c", 4, 4, "d"})
+	}
+	if err == nil {
+		err = reviews.InsertData(dbops.Conf_abort, []any{1, 1, 5, 2, 1, 3, 3, 3, 4})
+	}
+	if err == nil {
+		err = authors.DeleteData([]dbops.Condition{{Cname: "id", Op: dbops.Op_eq, Val: 4}})
+	}
+	if err == nil {
+		err = books.DeleteData([]dbops.Condition{{Cname: "id", Op: dbops.Op_eq, Val: 2}})
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	expect := func(data [][]any, err error, expected [][]any) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if !reflect.DeepEqual(data, expected) {
+			t.Fatalf("expected %v, got %v", expected, data)
+		}
+	}
+
+	//inner join, every column
+	q := authors.Join(books, dbops.Join_inner, []dbops.JoinOn{{Tname: "authors", Cname: "id", With: "author"}})
+	data, err := q.Get(0, -1, []dbops.Condition{}, []dbops.Order{{Tname: "books", Cname: "id", Dir: true}})
+	expect(data, err, [][]any{{int64(1), "ann", int64(1), int64(1), "a"}, {int64(2), "bob", int64(3), int64(2), "c"}})
+
+	//left join, chosen columns, qualified conditions and orders
+	q = authors.Join(books, dbops.Join_left, []dbops.JoinOn{{Tname: "authors", Cname: "id", With: "author"}}).
+		Join(reviews, dbops.Join_left, []dbops.JoinOn{{Tname: "books", Cname: "id", With: "book"}}).
+		Select([]dbops.JoinCol{{Tname: "authors", Cname: "name"}, {Tname: "books", Cname: "title"}, {Tname: "reviews", Cname: "stars"}})
+	data, err = q.Get(0, -1, []dbops.Condition{{Tname: "authors", Cname: "id", Op: dbops.Op_neq, Val: 2}},
+		[]dbops.Order{{Tname: "authors", Cname: "id", Dir: true}, {Tname: "reviews", Cname: "stars", Dir: false}})
+	expect(data, err, [][]any{{"ann", "a", int64(5)}, {"ann", "a", int64(3)}, {"cid", nil, nil}})
+
+	//windows are taken of the joined rows
+	data, err = q.Get(-3, 1, []dbops.Condition{}, []dbops.Order{{Tname: "authors", Cname: "id", Dir: true}, {Tname: "reviews", Cname: "stars", Dir: false}})
+	expect(data, err, [][]any{{"bob", "c", int64(4)}})
+
+	//invalid
+	invalid := map[*dbops.JoinQuery]error{
+		authors.Join(books, dbops.Join_inner, []dbops.JoinOn{{Tname: "books", Cname: "id", With: "author"}}): dbops.ErrIsNotPresent,
+		authors.Join(books, dbops.Join_inner, []dbops.JoinOn{{Tname: "authors", Cname: "id", With: "nope"}}): dbops.ErrIsNotPresent,
+		authors.Join(books, "CROSS JOIN", []dbops.JoinOn{{Tname: "authors", Cname: "id", With: "author"}}):   dbops.ErrBadData,
+		authors.Join(books, dbops.Join_inner, nil):                                                           dbops.ErrBadData,
+		authors.Join(authors, dbops.Join_inner, []dbops.JoinOn{{Tname: "authors", Cname: "id", With: "id"}}): dbops.ErrIsDuplicate,
+		q.Select([]dbops.JoinCol{{Tname: "authors", Cname: "title"}}):                                        dbops.ErrIsNotPresent,
+	}
+	for iq, expected := range invalid {
+		_, err = iq.Get(0, -1, []dbops.Condition{}, []dbops.Order{})
+		if err != expected {
+			t.Fatalf("expected %v, got %v", expected, err)
+		}
+	}
+
+	//in memory
+	err = src.CreateMem()
+	if err == nil {
+		err = authors.LoadIntoMem(0, -1, dbops.Conf_abort, []dbops.Condition{})
+	}
+	if err == nil {
+		err = books.LoadIntoMem(0, -1, dbops.Conf_abort, []dbops.Condition{})
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	q = books.Join(authors, dbops.Join_inner, []dbops.JoinOn{{Tname: "books", Cname: "author", With: "id"}}).
+		Select([]dbops.JoinCol{{Tname: "books", Cname: "title"}, {Tname: "authors", Cname: "name"}})
+	data, err = q.GetMem(0, -1, []dbops.Condition{}, []dbops.Order{{Tname: "books", Cname: "title", Dir: false}})
+	expect(data, err, [][]any{{"c", "bob"}, {"a", "ann"}})
+}
@@ -0,0 +1,296 @@
+package dbops
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// -------------------- DELETION LOG --------------------
+
+/*
+name of the reserved table every DeleteData, UndoDelete and ConfirmDelete on a Dd table is recorded in (on-disk only)
+  - created once first needed, hidden from GetTables/GetTableNames if the data source was connected with seekOwn (or created)
+  - no Table can be given this name
+*/
+const LogTableName = "dbops_log"
+
+type log_action string //constants begin with "Log_"; what a LogEntry records
+const (
+	Log_delete  log_action = "DELETE"  //rows were marked as deleted (DeleteData)
+	Log_undo    log_action = "UNDO"    //a deletion was undone (UndoDelete)
+	Log_confirm log_action = "CONFIRM" //a deletion was confirmed (ConfirmDelete)
+)
+
+// a record of an operation on the deletions of a Dd table, as returned by Rtable.DeleteLog
+type LogEntry struct {
+	Table  string
+	Action log_action
+
+	Ver     int  //the version which currently addresses the deletion this entry is about (as in UndoDelete, may not be valid anymore if !Pending)
+	Pending bool //whether the deletion this entry is about was neither undone nor confirmed yet
+
+	Condition string //the where clause DeleteData was called with, with "?" for values (only for Log_delete)
+	Args      []any  //values substituted into Condition, as decoded from json (only for Log_delete)
+
+	Rows int //number of rows affected (on-disk)
+	Time time.Time
+}
+
+var logCols = []rcol{{name: "seq", ext: "INTEGER NOT NULL", pk: false}, //number of the deletion this entry is about (counted per table, starting at 1)
+	{name: "table", ext: "TEXT NOT NULL", pk: false},
+	{name: "action", ext: "TEXT NOT NULL", pk: false},
+	{name: "condition", ext: "TEXT", pk: false},
+	{name: "args", ext: "TEXT", pk: false},
+	{name: "rows", ext: "INTEGER NOT NULL", pk: false},
+	{name: "time", ext: "DATETIME NOT NULL", pk: false}}
+
+// without locking, tries to create the log table on <db> (if it does not exist yet)
+func ensureLog(ctx context.Context, db sqlx.ExecerContext) error {
+	logt := Rtable{name: LogTableName, cols: logCols}
+	statement := logt.crStatement()
+
+	_, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS"+statement[len("CREATE TABLE"):])
+	return err
+}
+
+// without locking, tries to return the number of the last deletion of <rt> recorded on <db> (0 if none)
+func (rt *Rtable) lastSeq(ctx context.Context, db sqlx.QueryerContext) (int, error) {
+	var maxseq sql.NullInt64
+	err := sqlx.GetContext(ctx, db, &maxseq, "SELECT MAX(\"seq\") FROM \"main\".\""+LogTableName+"\" WHERE \"table\" = ? AND \"action\" = ?;", rt.name, Log_delete)
+	if err != nil {
+		return 0, err
+	}
+	return int(maxseq.Int64), nil
+}
+
+/*
+without locking, tries to record <action> on <rt> in the log table on <db>
+  - <ver> is the (absolute) version the action addressed, ignored for Log_delete
+  - <condarr> is the condition of the deletion, ignored unless Log_delete
+  - undoing or confirming a version which addresses no recorded deletion is not recorded
+*/
+func (rt *Rtable) logAction(ctx context.Context, db sqlx.ExtContext, action log_action, ver int, condarr []Condition, rows int64) error {
+	err := ensureLog(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	seq, err := rt.lastSeq(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	var cond, args sql.NullString
+	if action == Log_delete {
+		seq++
+
+		where, subs, err := clausify_condition_array(condarr)
+		if err != nil {
+			return err
+		}
+		if where != "" {
+			b, err := json.Marshal(subs)
+			if err != nil {
+				return err
+			}
+			cond = sql.NullString{String: where[len(" WHERE "):], Valid: true}
+			args = sql.NullString{String: string(b), Valid: true}
+		}
+	} else {
+		seq = seq - ver + 1 //ver 1 is the last deletion
+		if (ver < 1) || (seq < 1) {
+			return nil
+		}
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO \"main\".\""+LogTableName+"\" (\"seq\", \"table\", \"action\", \"condition\", \"args\", \"rows\", \"time\") VALUES (?, ?, ?, ?, ?, ?, ?);",
+		seq, rt.name, action, cond, args, rows, time.Now().UTC())
+	return err
+}
+
+// without locking, tries to run <f> in a transaction on <db>, committing it if <f> succeeds
+func inTx(ctx context.Context, db *sqlx.DB, f func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = f(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// without locking, does what delete does, then records it in the log (if rt.dd)
+func (rt *Rtable) loggedDelete(ctx context.Context, db sqlx.ExtContext, condarr []Condition) error {
+	n, err := rt.delete(ctx, db, condarr)
+	if (err != nil) || !rt.dd {
+		return err
+	}
+	return rt.logAction(ctx, db, Log_delete, 0, condarr, n)
+}
+
+// without locking, does what undelete does, then records it in the log
+func (rt *Rtable) loggedUndelete(ctx context.Context, db sqlx.ExtContext, ver int) error {
+	n, err := rt.undelete(ctx, db, ver)
+	if err != nil {
+		return err
+	}
+	return rt.logAction(ctx, db, Log_undo, ver, nil, n)
+}
+
+// without locking, does what remove does, then records it in the log
+func (rt *Rtable) loggedRemove(ctx context.Context, db sqlx.ExtContext, ver int) error {
+	n, err := rt.remove(ctx, db, ver)
+	if err != nil {
+		return err
+	}
+	return rt.logAction(ctx, db, Log_confirm, ver, nil, n)
+}
+
+// tries to return every recorded DeleteData, UndoDelete and ConfirmDelete on <rt> (oldest first)
+func (rt *Rtable) DeleteLog() ([]LogEntry, error) {
+	return rt.DeleteLogContext(context.Background())
+}
+
+// same as DeleteLog, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) DeleteLogContext(ctx context.Context) (entries []LogEntry, err error) {
+	if !rt.valid() {
+		return []LogEntry{}, ErrInvalidTable
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, true, false)
+	if err != nil {
+		return []LogEntry{}, err
+	}
+	defer rt.parent.unlock(true, false)
+
+	return rt.deleteLog(ctx, rt.parent.db)
+}
+
+/*
+tries to return the deletions of <rt> which were neither undone nor confirmed yet (the last deletion, ver 1, first)
+  - use LogEntry.Ver to address them in UndoDelete or ConfirmDelete
+*/
+func (rt *Rtable) Deletions() ([]LogEntry, error) {
+	return rt.DeletionsContext(context.Background())
+}
+
+// same as Deletions, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) DeletionsContext(ctx context.Context) (deletions []LogEntry, err error) {
+	entries, err := rt.DeleteLogContext(ctx)
+	if err != nil {
+		return []LogEntry{}, err
+	}
+
+	deletions = []LogEntry{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if (entries[i].Action == Log_delete) && entries[i].Pending {
+			deletions = append(deletions, entries[i])
+		}
+	}
+	return deletions, nil
+}
+
+// tries to return the recorded deletion of <rt> which <ver> addresses (as in UndoDelete), none -> ErrIsNotPresent
+func (rt *Rtable) Deletion(ver int) (LogEntry, error) {
+	return rt.DeletionContext(context.Background(), ver)
+}
+
+// same as Deletion, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) DeletionContext(ctx context.Context, ver int) (deletion LogEntry, err error) {
+	if !rt.valid() {
+		return deletion, ErrInvalidTable
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, true, false)
+	if err != nil {
+		return deletion, err
+	}
+	defer rt.parent.unlock(true, false)
+
+	if rt.dd {
+		ver, err = rt.absVer(ctx, rt.parent.db, ver)
+		if err != nil {
+			return deletion, err
+		}
+	}
+
+	entries, err := rt.deleteLog(ctx, rt.parent.db)
+	if err != nil {
+		return deletion, err
+	}
+	for _, e := range entries {
+		if (e.Action == Log_delete) && (e.Ver == ver) {
+			return e, nil
+		}
+	}
+	return deletion, ErrIsNotPresent
+}
+
+// without locking, tries to return every entry of the log table on <db> about <rt> (oldest first), no log table -> no entries
+func (rt *Rtable) deleteLog(ctx context.Context, db sqlx.QueryerContext) (entries []LogEntry, err error) {
+	var exists int
+	err = sqlx.GetContext(ctx, db, &exists, "SELECT COUNT(*) FROM \"main\".sqlite_master WHERE type = 'table' AND name = ?;", LogTableName)
+	if (err != nil) || (exists == 0) {
+		return []LogEntry{}, err
+	}
+
+	lastseq, err := rt.lastSeq(ctx, db)
+	if err != nil {
+		return []LogEntry{}, err
+	}
+
+	rows, err := db.QueryxContext(ctx, "SELECT \"seq\", \"action\", \"condition\", \"args\", \"rows\", \"time\" FROM \"main\".\""+LogTableName+"\" WHERE \"table\" = ? ORDER BY rowid;", rt.name)
+	if err != nil {
+		return []LogEntry{}, err
+	}
+	defer rows.Close()
+
+	entries = []LogEntry{}
+	seqs := []int{}
+	ended := make(map[int]bool) //seq -> whether the deletion was undone or confirmed
+	for rows.Next() {
+		var seq int
+		var cond, args sql.NullString
+		e := LogEntry{Table: rt.name}
+
+		err = rows.Scan(&seq, &e.Action, &cond, &args, &e.Rows, &e.Time)
+		if err != nil {
+			return []LogEntry{}, err
+		}
+
+		e.Ver = lastseq - seq + 1
+		e.Condition = cond.String
+		if args.Valid {
+			err = json.Unmarshal([]byte(args.String), &e.Args)
+			if err != nil {
+				return []LogEntry{}, err
+			}
+		}
+		if e.Action != Log_delete {
+			ended[seq] = true
+		}
+
+		entries = append(entries, e)
+		seqs = append(seqs, seq)
+	}
+	if err = rows.Err(); err != nil {
+		return []LogEntry{}, err
+	}
+
+	for i := range entries {
+		entries[i].Pending = !ended[seqs[i]]
+	}
+	return entries, nil
+}
@@ -0,0 +1,120 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that deletions are recorded in the log table, which stays hidden from the tables of the source
+func TestLog(t *testing.T) {
+
+	//init
+	var db_path = filepath.Join(t.TempDir(), "log.db")
+	var tts = []dbops.Table{{Name: "log", Dd: true, Cols: []dbops.Col{{Name: "a a", Ext: "INTEGER", Pk: true}}}}
+
+	src, err := dbops.CreateSrc(db_path, tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	tbl := src.GetRtable(tts[0].Name)
+	err = tbl.InsertData(dbops.Conf_abort, []any{1, 2, 3})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//nothing was deleted yet
+	dels, err := tbl.Deletions()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(dels) != 0 {
+		t.Fatalf("unexpected deletions %v", dels)
+	}
+
+	err = tbl.DeleteData([]dbops.Condition{{Cname: "a a", Op: dbops.Op_eq, Val: 1}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.DeleteData([]dbops.Condition{{Cname: "a a", Op: dbops.Op_in, Val: []int{2, 3}}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//the last deletion is listed first, as ver 1
+	dels, err = tbl.Deletions()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if (len(dels) != 2) || (dels[0].Ver != 1) || (dels[1].Ver != 2) || (dels[0].Rows != 2) || (dels[1].Rows != 1) {
+		t.Fatalf("unexpected deletions %v", dels)
+	}
+	if !slices.Equal(dels[0].Args, []any{2.0, 3.0}) || (dels[0].Condition == "") || dels[0].Time.IsZero() {
+		t.Fatalf("unexpected deletion details %v", dels[0])
+	}
+
+	del, err := tbl.Deletion(2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !slices.Equal(del.Args, []any{1.0}) {
+		t.Fatalf("unexpected deletion %v", del)
+	}
+	_, err = tbl.Deletion(3)
+	if err != dbops.ErrIsNotPresent {
+		t.Fatalf("expected ErrIsNotPresent, got %v", err)
+	}
+
+	//confirming is recorded too, and ends the deletion
+	err = tbl.ConfirmDelete(2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	dels, err = tbl.Deletions()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if (len(dels) != 1) || (dels[0].Ver != 1) {
+		t.Fatalf("unexpected deletions after confirming %v", dels)
+	}
+
+	entries, err := tbl.DeleteLog()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if (len(entries) != 3) || (entries[2].Action != dbops.Log_confirm) || (entries[2].Ver != 2) || entries[0].Pending {
+		t.Fatalf("unexpected log %v", entries)
+	}
+
+	//the log table is only visible when not seeking own tables
+	err = src.Disconnect()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	src, err = dbops.ConnectSrc(db_path, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !slices.Equal(src.GetTableNames(), []string{tts[0].Name}) {
+		t.Fatalf("log table is not hidden %v", src.GetTableNames())
+	}
+	src.Disconnect()
+
+	src, err = dbops.ConnectSrc(db_path, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+	if !src.HasTableOfName(dbops.LogTableName) {
+		t.Fatalf("log table was not created")
+	}
+
+	//its name is reserved
+	err = src.AddTable(dbops.Table{Name: dbops.LogTableName, Cols: []dbops.Col{{Name: "x"}}})
+	if err != dbops.ErrInvalidTable {
+		t.Fatalf("expected ErrInvalidTable, got %v", err)
+	}
+}
@@ -0,0 +1,375 @@
+package dbops
+
+import (
+	"context"
+	"slices"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// -------------------- MIGRATIONS --------------------
+
+/*
+a numbered change of a database's schema, applied by DataSrc.Migrate if the database is at a lower version
+  - the version a database is at is stored in it (PRAGMA user_version), a new database is at version 0
+  - every migration is applied in its own transaction, together with raising the version, so a failing one leaves the database at the previous version
+  - foreign keys are not enforced while applying a migration, but it fails (-> ErrForeignKey) if a row references a row which does not exist afterwards
+*/
+type Migration struct {
+	Version int    //version of the schema once this migration is applied (> 0, ascending within a []Migration)
+	Desc    string //what this migration does (for listing pending migrations)
+
+	Steps []MigStep //applied in order
+}
+
+type mig_action string //constants begin with "Mig_"; what a MigStep does
+const (
+	Mig_addTable mig_action = "ADD TABLE"  //as AddTable
+	Mig_delTable mig_action = "DROP TABLE" //as DelTable
+	Mig_edit     mig_action = "EDIT TABLE" //as Rtable.Edit
+	Mig_sql      mig_action = "SQL"        //a raw sql statement
+)
+
+// a step of a Migration, create with StepAddTable, StepDelTable, StepEdit or StepSQL
+type MigStep struct {
+	Action mig_action
+	Table  string //name of the table the step operates on (not for Mig_sql)
+
+	table Table             //the table to add (Mig_addTable), or the new columns (Mig_edit)
+	remap map[string]string //(Mig_edit)
+	whole bool              //whether table.Dd, table.Indexes and table.ForeignKeys replace the table's, instead of keeping them (Mig_edit)
+
+	statement string //(Mig_sql)
+	args      []any  //(Mig_sql)
+}
+
+// returns a step which creates <t>
+func StepAddTable(t Table) MigStep {
+	return MigStep{Action: Mig_addTable, Table: t.Name, table: t}
+}
+
+// returns a step which deletes the table named <name>
+func StepDelTable(name string) MigStep {
+	return MigStep{Action: Mig_delTable, Table: name}
+}
+
+// returns a step which recreates the table named <name> with only <newcols>, copying data as in Rtable.Edit
+func StepEdit(name string, newcols []Col, remap map[string]string) MigStep {
+	return MigStep{Action: Mig_edit, Table: name, table: Table{Name: name, Cols: newcols}, remap: remap}
+}
+
+// returns a step which executes <statement> with <args> substituted into it (the schema is reread afterwards)
+func StepSQL(statement string, args ...any) MigStep {
+	return MigStep{Action: Mig_sql, statement: statement, args: args}
+}
+
+// returns a description of <step>, e.g. `ADD TABLE "name"`
+func (step MigStep) String() string {
+	if step.Action == Mig_sql {
+		return string(step.Action) + " " + step.statement
+	}
+	return string(step.Action) + " \"" + step.Table + "\""
+}
+
+// tries to return the version of <src>'s schema (see Migration)
+func (src *DataSrc) SchemaVersion() (int, error) {
+	return src.SchemaVersionContext(context.Background())
+}
+
+// same as SchemaVersion, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) SchemaVersionContext(ctx context.Context) (version int, err error) {
+	if src == nil {
+		return 0, ErrNilSource
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = src.lock(ctx, true, false)
+	if err != nil {
+		return 0, err
+	}
+	defer src.unlock(true, false)
+
+	err = sqlx.GetContext(ctx, src.db, &version, "PRAGMA user_version;")
+	return version, err
+}
+
+// tries to return the migrations of <migs> which are not applied to <src> yet (in order), without applying them; <migs> not ascending -> ErrBadData
+func (src *DataSrc) PendingMigrations(migs []Migration) ([]Migration, error) {
+	return src.PendingMigrationsContext(context.Background(), migs)
+}
+
+// same as PendingMigrations, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) PendingMigrationsContext(ctx context.Context, migs []Migration) ([]Migration, error) {
+	version, err := src.SchemaVersionContext(ctx)
+	if err != nil {
+		return []Migration{}, err
+	}
+
+	return pendingMigrations(migs, version)
+}
+
+// tries to return the migrations of <migs> above <version>, <migs> not ascending -> ErrBadData
+func pendingMigrations(migs []Migration, version int) ([]Migration, error) {
+	pending := []Migration{}
+	last := 0
+	for _, m := range migs {
+		if m.Version <= last {
+			return []Migration{}, ErrBadData
+		}
+		last = m.Version
+
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+/*
+tries to apply every migration of <migs> which is not applied to <src> yet, in order (see Migration)
+  - operates on-disk only, so <src> must not have an in-memory database (-> ErrBadData)
+  - if <seekOwn>, the schema reread after raw sql steps will seek Dd columns (see ConnectSrc)
+  - a step deleting a table read by a view, or editing away a column one names -> ErrViewDepends (as in DelTable and Rtable.Edit)
+*/
+func (src *DataSrc) Migrate(migs []Migration, seekOwn bool) (err error) {
+	return src.MigrateContext(context.Background(), migs, seekOwn)
+}
+
+// same as Migrate, but gives up once <ctx> is done (-> ctx.Err(), the running migration is rolled back)
+func (src *DataSrc) MigrateContext(ctx context.Context, migs []Migration, seekOwn bool) (err error) {
+	if src == nil {
+		return ErrNilSource
+	}
+	if src.mem != nil {
+		return ErrBadData
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = src.lock(ctx, true, false)
+	if err != nil {
+		return err
+	}
+	defer src.unlock(true, false)
+
+	var version int
+	err = sqlx.GetContext(ctx, src.db, &version, "PRAGMA user_version;")
+	if err != nil {
+		return err
+	}
+
+	pending, err := pendingMigrations(migs, version)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range pending {
+		rtables, rviews := src.migCopies() //so a failing migration leaves <src> alone
+
+		err = fkOffTx(ctx, src.db, true, func(tx *sqlx.Tx) error { //so recreating a table does not touch the rows referencing it
+			for _, step := range m.Steps {
+				rtables, rviews, err = src.migStep(ctx, tx, rtables, rviews, step, seekOwn)
+				if err != nil {
+					return err
+				}
+			}
+
+			_, err := tx.ExecContext(ctx, "PRAGMA user_version = "+strconv.Itoa(m.Version)+";")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		src.migCommit(rtables, rviews)
+	}
+	return nil
+}
+
+// returns copies of the tables and views of <src>, for migStep to work on
+func (src *DataSrc) migCopies() ([]*Rtable, []*Rview) {
+	rtables := make([]*Rtable, len(src.rtables))
+	for i, rt := range src.rtables {
+		rtcopy := *rt
+		rtcopy.cols = slices.Clone(rt.cols)
+		rtables[i] = &rtcopy
+	}
+	rviews := make([]*Rview, len(src.rviews))
+	for i, rv := range src.rviews {
+		rvcopy := *rv
+		rvcopy.cols = slices.Clone(rv.cols)
+		rviews[i] = &rvcopy
+	}
+	return rtables, rviews
+}
+
+/*
+makes <rtables> and <rviews> (what migStep made of the copies of migCopies) the tables and views of <src>
+  - handles to tables (and views) which are still there (by name) are updated in place, so they stay valid, those to ones which are gone are invalidated
+*/
+func (src *DataSrc) migCommit(rtables []*Rtable, rviews []*Rview) {
+	for i, nrt := range rtables {
+		oidx := slices.IndexFunc(src.rtables, func(rt *Rtable) bool { return rt.name == nrt.name })
+		if oidx != -1 {
+			*src.rtables[oidx] = *nrt
+			rtables[i] = src.rtables[oidx]
+		}
+	}
+	for _, rt := range src.rtables {
+		if !slices.Contains(rtables, rt) {
+			rt.parent = nil
+		}
+	}
+	src.rtables = rtables
+
+	for i, nrv := range rviews {
+		oidx := slices.IndexFunc(src.rviews, func(rv *Rview) bool { return rv.name == nrv.name })
+		if oidx != -1 {
+			*src.rviews[oidx] = *nrv
+			rviews[i] = src.rviews[oidx]
+		}
+	}
+	for _, rv := range src.rviews {
+		if !slices.Contains(rviews, rv) {
+			rv.parent = nil
+		}
+	}
+	src.rviews = rviews
+}
+
+/*
+without locking, tries to apply <step> on <tx> (on-disk), returning what <rtables> and <rviews> (the tables and views of <src> before it) become
+  - a step breaking a view, as DelTable or Rtable.Edit would -> ErrViewDepends
+*/
+func (src *DataSrc) migStep(ctx context.Context, tx *sqlx.Tx, rtables []*Rtable, rviews []*Rview, step MigStep, seekOwn bool) ([]*Rtable, []*Rview, error) {
+	if step.Action == Mig_sql {
+		_, err := tx.ExecContext(ctx, step.statement, step.args...)
+		if err != nil {
+			return rtables, rviews, err
+		}
+		rtables, err = src.readTables(tx, seekOwn)
+		if err != nil {
+			return rtables, rviews, err
+		}
+		rviews, err = src.readViews(tx)
+		return rtables, rviews, err
+	}
+
+	tidx := slices.IndexFunc(rtables, func(rt *Rtable) bool { return rt.name == step.Table })
+
+	switch step.Action {
+	case Mig_addTable:
+		if !step.table.valid() {
+			return rtables, rviews, ErrInvalidTable
+		}
+		if tidx != -1 {
+			return rtables, rviews, ErrIsDuplicate
+		}
+
+		rt := step.table.rtable(src)
+		for _, statement := range rt.crStatements() {
+			_, err := tx.ExecContext(ctx, statement)
+			if err != nil {
+				return rtables, rviews, err
+			}
+		}
+		return append(rtables, rt), rviews, nil
+
+	case Mig_delTable:
+		if tidx == -1 {
+			return rtables, rviews, ErrIsNotPresent
+		}
+		rt := rtables[tidx]
+		if len(dependentViews(rviews, rt.name)) != 0 {
+			return rtables, rviews, ErrViewDepends
+		}
+
+		_, err := tx.ExecContext(ctx, "DROP TABLE \"main\".\""+rt.name+"\";")
+		if (err == nil) && rt.fts {
+			_, err = tx.ExecContext(ctx, rt.ftsDrop())
+		}
+		if err != nil {
+			return rtables, rviews, err
+		}
+		if rt.dd { //forget its deletions, as DelTable does
+			err = ensureLog(ctx, tx)
+			if err == nil {
+				_, err = tx.ExecContext(ctx, "DELETE FROM \"main\".\""+LogTableName+"\" WHERE \"table\" = ?;", rt.name)
+			}
+			if err != nil {
+				return rtables, rviews, err
+			}
+		}
+		return slices.Delete(rtables, tidx, tidx+1), rviews, nil
+
+	case Mig_edit:
+		if tidx == -1 {
+			return rtables, rviews, ErrIsNotPresent
+		}
+		rt := rtables[tidx]
+		views := dependentViews(rviews, rt.name)
+		if !rt.viewsKept(views, step.remap) {
+			return rtables, rviews, ErrViewDepends
+		}
+
+		if step.whole && (step.table.Dd != rt.dd) { //plan as if the dd column was there already (it is not copied either way)
+			if step.table.Dd {
+				rt.dd, rt.ddint = true, 1
+				rt.cols = append([]rcol{orgDdCol}, rt.cols...)
+			} else {
+				rt.dd, rt.ddint = false, 0
+				rt.cols = rt.cols[1:]
+
+				err := ensureLog(ctx, tx) //forget its deletions, as DelTable does
+				if err == nil {
+					_, err = tx.ExecContext(ctx, "DELETE FROM \"main\".\""+LogTableName+"\" WHERE \"table\" = ?;", rt.name)
+				}
+				if err != nil {
+					return rtables, rviews, err
+				}
+			}
+		}
+
+		nindexes, nfkeys, nfts := rt.remapIndexes(step.remap), rt.remapFkeys(step.remap), rt.fts
+		if step.whole {
+			nrt := step.table.rtable(src)
+			nindexes, nfkeys, nfts = nrt.indexes, nrt.fkeys, nrt.fts
+		}
+		ncols, statements, err := rt.editPlan(step.table.Cols, step.remap, nindexes, nfkeys, nfts)
+		if err != nil {
+			return rtables, rviews, err
+		}
+		if !refsKept(rtables, rt.name, ncols) {
+			return rtables, rviews, ErrForeignKey
+		}
+		for _, statement := range statements {
+			_, err = tx.ExecContext(ctx, statement)
+			if err != nil {
+				return rtables, rviews, err
+			}
+		}
+		rt.cols, rt.indexes, rt.fkeys, rt.fts = ncols, nindexes, nfkeys, nfts
+		for _, rv := range views { //as in Rtable.Edit
+			rv.cols, _ = viewCols(tx, rv.name)
+		}
+		return rtables, rviews, nil
+	}
+	return rtables, rviews, ErrBadData
+}
+
+// tries to return a handle to the database at <path>, like ConnectSrc, after applying every migration of <migs> which is not applied to it yet (see Migrate)
+func ConnectSrcMigrate(path string, seekOwn bool, migs []Migration) (*DataSrc, error) {
+	src, err := ConnectSrc(path, seekOwn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = src.Migrate(migs, seekOwn)
+	if err != nil {
+		src.Disconnect()
+		return nil, err
+	}
+	return src, nil
+}
@@ -0,0 +1,142 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that migrations are applied once, in order, each in its own transaction, and that pending ones can be listed
+func TestMigrate(t *testing.T) {
+
+	//init
+	path := filepath.Join(t.TempDir(), "mig.db")
+	var tts = []dbops.Table{{Name: "users", Dd: true, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true},
+		{Name: "name", Ext: "TEXT", Pk: false}}}}
+
+	src, err := dbops.CreateSrc(path, tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = src.GetRtable("users").InsertData(dbops.Conf_abort, []any{1, "ann", 2, "bob"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = src.Disconnect()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	migs := []dbops.Migration{{Version: 1, Desc: "add tags", Steps: []dbops.MigStep{
+		dbops.StepAddTable(dbops.Table{Name: "tags", Cols: []dbops.Col{{Name: "tag", Ext: "TEXT", Pk: true}}}),
+		dbops.StepSQL("INSERT INTO \"tags\" VALUES (?), (?);", "a", "b")}},
+		{Version: 3, Desc: "rename name, add mail", Steps: []dbops.MigStep{
+			dbops.StepEdit("users", []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true}, {Name: "full name", Ext: "TEXT", Pk: false},
+				{Name: "mail", Ext: "TEXT DEFAULT '' NOT NULL", Pk: false}}, map[string]string{"id": "id", "name": "full name"})}},
+		{Version: 4, Desc: "drop tags", Steps: []dbops.MigStep{dbops.StepDelTable("tags")}}}
+
+	//dry-run
+	src, err = dbops.ConnectSrc(path, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	pending, err := src.PendingMigrations(migs)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if (len(pending) != 3) || (pending[1].Steps[0].String() != "EDIT TABLE \"users\"") {
+		t.Fatalf("unexpected pending migrations %v", pending)
+	}
+	if src.HasTableOfName("tags") {
+		t.Fatalf("dry-run applied a migration")
+	}
+
+	_, err = src.PendingMigrations([]dbops.Migration{{Version: 2}, {Version: 1}})
+	if err != dbops.ErrBadData {
+		t.Fatalf("expected ErrBadData for unordered migrations, got %v", err)
+	}
+
+	//a failing migration is rolled back, earlier ones stay
+	broken := append(migs[:2:2], dbops.Migration{Version: 4, Steps: []dbops.MigStep{dbops.StepDelTable("tags"), dbops.StepSQL("NOT SQL;")}})
+	err = src.Migrate(broken, true)
+	if err == nil {
+		t.Fatalf("expected an error from a broken migration")
+	}
+	version, err := src.SchemaVersion()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if (version != 3) || !src.HasTableOfName("tags") {
+		t.Fatalf("broken migration was not rolled back, version %d, tables %v", version, src.GetTableNames())
+	}
+	err = src.Disconnect()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//on connecting, only the rest is applied
+	src, err = dbops.ConnectSrcMigrate(path, true, migs)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+
+	version, err = src.SchemaVersion()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if version != 4 {
+		t.Fatalf("expected version 4, got %d", version)
+	}
+
+	expected := []dbops.Table{{Name: "users", Dd: true, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true},
+		{Name: "full name", Ext: "TEXT", Pk: false}, {Name: "mail", Ext: "TEXT DEFAULT '' NOT NULL", Pk: false}}}}
+	err = checkTables(src, expected)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	users := src.GetRtable("users")
+	err = checkData(users, "id", [][]any{{int64(1), "ann", ""}, {int64(2), "bob", ""}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = users.InsertData(dbops.Conf_abort, []any{1, "dup", ""})
+	if err == nil {
+		t.Fatalf("the primary key did not survive the edit")
+	}
+
+	//applying again does nothing
+	err = src.Migrate(migs, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//handles stay valid across migrations, those of dropped tables do not
+	migs = append(migs, dbops.Migration{Version: 5, Desc: "add age, add tmp", Steps: []dbops.MigStep{
+		dbops.StepEdit("users", append(expected[0].Cols, dbops.Col{Name: "age", Ext: "INTEGER", Pk: false}), map[string]string{"id": "id", "full name": "full name", "mail": "mail"}),
+		dbops.StepAddTable(dbops.Table{Name: "tmp", Cols: []dbops.Col{{Name: "a a", Ext: "INTEGER", Pk: true}}})}})
+	err = src.Migrate(migs, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = users.InsertData(dbops.Conf_abort, []any{3, "cid", "", 30})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if users != src.GetRtable("users") {
+		t.Fatalf("the handle of an edited table was replaced")
+	}
+
+	tmp := src.GetRtable("tmp")
+	migs = append(migs, dbops.Migration{Version: 6, Desc: "drop tmp", Steps: []dbops.MigStep{dbops.StepDelTable("tmp")}})
+	err = src.Migrate(migs, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tmp.InsertData(dbops.Conf_abort, []any{1})
+	if err != dbops.ErrInvalidTable {
+		t.Fatalf("expected ErrInvalidTable for the handle of a dropped table, got %v", err)
+	}
+}
@@ -0,0 +1,313 @@
+package dbops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrNoReadThrough error = errors.New("ErrNoReadThrough (dbops) - cannot get cached data without read-through mode enabled")
+
+// -------------------- READ-THROUGH MODE --------------------
+
+/*
+In read-through mode, Rtable.GetCachedData reads from the in-memory database, loading the rows it selects from disk first if they are not cached yet.
+  - queries are cached by their table and conditions (not by index, count or order), so the same conditions never load twice
+  - once the in-memory database holds more rows than the cap, the least recently used queries are evicted (see UnloadFromMem), until it does not
+  - evicting a query also evicts every cached query of the same table sharing rows with it, as those would be incomplete without them
+  - rows already in memory are never overwritten by loading, and changes to disk after loading are not seen until their query is evicted (or forgotten, as by committing a Tx changing its table)
+*/
+
+// state of read-through mode of a DataSrc
+type readCache struct {
+	maxRows int        //cap of the number of rows in the in-memory database (<= 0 -> none)
+	queries []*rcQuery //least recently used first
+}
+
+// a query cached by read-through mode
+type rcQuery struct {
+	table   string //name of the table
+	key     string //conditions, as clausified
+	condarr []Condition
+}
+
+// returns the key of the query for <condarr>
+func rcKey(condarr []Condition) (string, error) {
+	where, subs, err := clausify_condition_array(condarr)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%q %#v", where, subs), nil
+}
+
+// returns the index of the cached query of <table> with <key> (none -> -1)
+func (rc *readCache) find(table string, key string) int {
+	for i, q := range rc.queries {
+		if (q.table == table) && (q.key == key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// forgets every cached query of <table> (their rows stay in memory)
+func (rc *readCache) drop(table string) {
+	kept := rc.queries[:0]
+	for _, q := range rc.queries {
+		if q.table != table {
+			kept = append(kept, q)
+		}
+	}
+	rc.queries = kept
+}
+
+// without locking, tries to return whether a row of <q>'s table in <src>'s in-memory database matches both <q> and <condarr>
+func (src *DataSrc) rcOverlaps(ctx context.Context, q *rcQuery, condarr []Condition) (bool, error) {
+	both := []Condition{{Sub: q.condarr}, {Ljoin: true, Lrel: true, Sub: condarr}}
+	if len(q.condarr) == 0 {
+		both = both[1:]
+	}
+	if len(condarr) == 0 {
+		both = both[:len(both)-1]
+	}
+
+	where, subs, err := clausify_condition_array(both)
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	err = sqlx.GetContext(ctx, src.mem, &exists, "SELECT EXISTS (SELECT 1 FROM \"main\".\""+q.table+"\""+where+");", subs...)
+	return exists, err
+}
+
+// without locking, tries to forget every cached query of <rt> sharing rows with <condarr> (their rows stay in memory)
+func (src *DataSrc) rcForget(ctx context.Context, rt *Rtable, condarr []Condition) error {
+	kept := make([]*rcQuery, 0, len(src.rc.queries))
+	for _, q := range src.rc.queries {
+		if q.table == rt.name {
+			overlaps, err := src.rcOverlaps(ctx, q, condarr)
+			if err != nil {
+				return err
+			}
+			if overlaps {
+				continue
+			}
+		}
+		kept = append(kept, q)
+	}
+
+	src.rc.queries = kept
+	return nil
+}
+
+// without locking, tries to return the number of rows in all tables of <src>'s in-memory database
+func (src *DataSrc) memRows(ctx context.Context) (total int, err error) {
+	for _, rt := range src.rtables {
+		var n int
+		err = sqlx.GetContext(ctx, src.mem, &n, "SELECT COUNT(*) FROM \"main\".\""+rt.name+"\";")
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// without locking, tries to evict the least recently used queries of <src> until its in-memory database holds at most rc.maxRows rows (or nothing is cached)
+func (src *DataSrc) rcEvict(ctx context.Context) error {
+	if src.rc.maxRows <= 0 {
+		return nil
+	}
+
+	for len(src.rc.queries) != 0 {
+		total, err := src.memRows(ctx)
+		if (err != nil) || (total <= src.rc.maxRows) {
+			return err
+		}
+
+		//the victim, and whatever would be incomplete without its rows
+		victims := []*rcQuery{src.rc.queries[0]}
+		rest := src.rc.queries[1:]
+		for grown := true; grown; {
+			grown = false
+			kept := make([]*rcQuery, 0, len(rest))
+			for _, q := range rest {
+				overlaps := false
+				for _, v := range victims {
+					if v.table != q.table {
+						continue
+					}
+					overlaps, err = src.rcOverlaps(ctx, v, q.condarr)
+					if err != nil {
+						return err
+					}
+					if overlaps {
+						break
+					}
+				}
+
+				if overlaps {
+					victims = append(victims, q)
+					grown = true
+				} else {
+					kept = append(kept, q)
+				}
+			}
+			rest = kept
+		}
+
+		for _, v := range victims {
+			for _, rt := range src.rtables {
+				if rt.name != v.table {
+					continue
+				}
+				err = rt.unload(ctx, v.condarr)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		src.rc.queries = rest
+	}
+	return nil
+}
+
+/*
+tries to enable read-through mode on <src> (see above), with a cap of <maxRows> rows in its in-memory database (<= 0 -> no cap)
+  - rows which were not loaded by GetCachedData count towards the cap, but are only evicted if a cached query selects them
+  - already enabled -> ErrIsDuplicate
+*/
+func (src *DataSrc) EnableReadThrough(maxRows int) (err error) {
+	return src.EnableReadThroughContext(context.Background(), maxRows)
+}
+
+// same as EnableReadThrough, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) EnableReadThroughContext(ctx context.Context, maxRows int) (err error) {
+	if src == nil {
+		return ErrNilSource
+	}
+	if src.mem == nil {
+		return ErrNoMem
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := src.lock(ctx, false, true)
+	if err != nil {
+		return err
+	}
+	defer src.unlock(false, memheld)
+
+	if src.rc != nil {
+		return ErrIsDuplicate
+	}
+	src.rc = &readCache{maxRows: maxRows}
+	return nil
+}
+
+// tries to disable read-through mode on <src> (unload -> also unload the rows of every cached query), not in read-through mode -> ErrNoReadThrough
+func (src *DataSrc) DisableReadThrough(unload bool) (err error) {
+	return src.DisableReadThroughContext(context.Background(), unload)
+}
+
+// same as DisableReadThrough, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) DisableReadThroughContext(ctx context.Context, unload bool) (err error) {
+	if src == nil {
+		return ErrNilSource
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := src.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer src.unlock(true, memheld)
+
+	if src.rc == nil {
+		return ErrNoReadThrough
+	}
+
+	if unload {
+		for _, q := range src.rc.queries {
+			for _, rt := range src.rtables {
+				if rt.name != q.table {
+					continue
+				}
+				err = rt.unload(ctx, q.condarr)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	src.rc = nil
+	return nil
+}
+
+/*
+tries to return rows of <rt>'s in-memory version, selected the same way as in GetMemData, first loading every row where <condarr> is true from disk, unless cached already
+  - evicts the least recently used queries afterwards, if the cap is exceeded
+  - not in read-through mode -> ErrNoReadThrough
+*/
+func (rt *Rtable) GetCachedData(index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	return rt.GetCachedDataContext(context.Background(), index, count, condarr, ordarr)
+}
+
+// same as GetCachedData, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) GetCachedDataContext(ctx context.Context, index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	if !rt.valid() {
+		return [][]any{}, ErrInvalidTable
+	}
+	if rt.parent.mem == nil {
+		return [][]any{}, ErrNoMem
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := rt.parent.lock(ctx, true, true)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer rt.parent.unlock(true, memheld)
+	if !memheld { //memory was deleted in the meantime
+		return [][]any{}, ErrNoMem
+	}
+
+	rc := rt.parent.rc
+	if rc == nil {
+		return [][]any{}, ErrNoReadThrough
+	}
+
+	key, err := rcKey(condarr)
+	if err != nil {
+		return [][]any{}, err
+	}
+
+	q := &rcQuery{table: rt.name, key: key, condarr: append([]Condition{}, condarr...)}
+	if i := rc.find(rt.name, key); i != -1 { //hit, make it the most recently used
+		q = rc.queries[i]
+		rc.queries = append(rc.queries[:i], rc.queries[i+1:]...)
+	} else {
+		err = rt.load(ctx, 0, -1, Conf_ignore, condarr)
+		if err != nil {
+			return [][]any{}, err
+		}
+	}
+	rc.queries = append(rc.queries, q)
+
+	data, err = rt.get(ctx, rt.parent.mem, index, count, condarr, ordarr, false)
+	if err != nil {
+		return [][]any{}, err
+	}
+
+	err = rt.parent.rcEvict(ctx)
+	if err != nil {
+		return [][]any{}, err
+	}
+	return data, nil
+}
@@ -0,0 +1,118 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that cached gets load missing rows once, and that the least recently used queries are evicted past the cap
+func TestReadThrough(t *testing.T) {
+
+	//init
+	var tts = []dbops.Table{{Name: "rt", Dd: true, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true},
+		{Name: "grp", Ext: "TEXT", Pk: false}}}}
+
+	src, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "rt.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+
+	tbl := src.GetRtable(tts[0].Name)
+	err = tbl.InsertData(dbops.Conf_abort, []any{1, "a", 2, "a", 3, "b", 4, "b", 5, "c"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = src.CreateMem()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	grp := func(g string) []dbops.Condition { return []dbops.Condition{{Cname: "grp", Op: dbops.Op_eq, Val: g}} }
+	byId := []dbops.Order{{Cname: "id", Dir: true}}
+
+	_, err = tbl.GetCachedData(0, -1, grp("a"), byId)
+	if err != dbops.ErrNoReadThrough {
+		t.Fatalf("expected ErrNoReadThrough, got %v", err)
+	}
+
+	err = src.EnableReadThrough(4)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//a miss loads
+	data, err := tbl.GetCachedData(0, -1, grp("a"), byId)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !reflect.DeepEqual(data, [][]any{{int64(1), "a"}, {int64(2), "a"}}) {
+		t.Fatalf("unexpected cached data %v", data)
+	}
+	if n := tbl.CountMem(); n != 2 {
+		t.Fatalf("expected 2 rows in memory, got %d", n)
+	}
+
+	//a hit does not load again, so rows added to disk afterwards are not seen
+	err = tbl.InsertData(dbops.Conf_abort, []any{6, "a"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	data, err = tbl.GetCachedData(0, 1, grp("a"), byId)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !reflect.DeepEqual(data, [][]any{{int64(1), "a"}}) {
+		t.Fatalf("unexpected cached data %v", data)
+	}
+
+	//"b" fits in the cap, "c" does not, so "a" (the least recently used) is evicted
+	_, err = tbl.GetCachedData(0, -1, grp("b"), byId)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, err = tbl.GetCachedData(0, -1, grp("c"), byId)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	mem, err := tbl.GetMemData(0, -1, []dbops.Condition{}, byId)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !reflect.DeepEqual(mem, [][]any{{int64(3), "b"}, {int64(4), "b"}, {int64(5), "c"}}) {
+		t.Fatalf("unexpected rows in memory after eviction %v", mem)
+	}
+
+	//evicted queries load again, now seeing the new row
+	data, err = tbl.GetCachedData(0, -1, grp("a"), byId)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !reflect.DeepEqual(data, [][]any{{int64(1), "a"}, {int64(2), "a"}, {int64(6), "a"}}) {
+		t.Fatalf("unexpected cached data %v", data)
+	}
+
+	//unloading makes queries sharing its rows miss again
+	err = tbl.UnloadFromMem([]dbops.Condition{{Cname: "id", Op: dbops.Op_eq, Val: 2}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	data, err = tbl.GetCachedData(0, -1, grp("a"), byId)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(data) != 3 {
+		t.Fatalf("expected 3 rows after reloading, got %v", data)
+	}
+
+	err = src.DisableReadThrough(true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := tbl.CountMem(); n != 0 {
+		t.Fatalf("expected an empty memory, got %d rows", n)
+	}
+}
@@ -0,0 +1,177 @@
+package dbops
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// -------------------- SELECTIONS --------------------
+
+// what GetSelected returns of each row: some columns (and/or values computed from them), in the given order
+type Selection struct {
+	Cols     []SelCol //what to return, in order (empty -> every column, as GetData)
+	Distinct bool     //whether rows with the same returned values are returned only once
+}
+
+// a result column of a Selection, either a column of the Rtable, or an sql expression
+type SelCol struct {
+	Cname string //column name ("" -> Expr)
+	Expr  string //sql expression computed for each row, e.g. `"price" * "qty"` or `length("body")` (only without Cname)
+
+	As string //name of the result, by which ordarr can refer to it ("" -> Cname, or Expr as written), should differ from every other column name
+}
+
+// returns <sc> as a result column of a SELECT statement, e.g. `("a" + 1) AS "sum"`
+func (sc SelCol) selCol() string {
+	if sc.Cname != "" {
+		if sc.As == "" {
+			return "\"" + sc.Cname + "\""
+		}
+		return "\"" + sc.Cname + "\" AS \"" + sc.As + "\""
+	}
+
+	as := sc.As
+	if as == "" {
+		as = sc.Expr
+	}
+	return "(" + sc.Expr + ") AS \"" + strings.ReplaceAll(as, "\"", "\"\"") + "\""
+}
+
+/*
+tries to return a slice of slices, which represent rows of <rt> (on-disk) as chosen by <sel>, otherwise as in GetData
+  - each row holds the values of <sel>.Cols, in the same order
+  - with <sel>.Distinct, the window of <index> and <count> is taken after leaving out rows which are the same
+  - a column of <sel> which <rt> does not have -> ErrIsNotPresent, a SelCol with both or neither of Cname and Expr (or an Expr which is not one expression) -> ErrBadData
+*/
+func (rt *Rtable) GetSelected(sel Selection, index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	return rt.GetSelectedContext(context.Background(), sel, index, count, condarr, ordarr)
+}
+
+// same as GetSelected, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) GetSelectedContext(ctx context.Context, sel Selection, index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	if !rt.valid() {
+		return [][]any{}, ErrInvalidTable
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, true, false)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer rt.parent.unlock(true, false)
+
+	return rt.getSelected(ctx, rt.parent.db, sel, index, count, condarr, ordarr)
+}
+
+// same as GetSelected, but on <rt>'s in-memory version (as in GetMemData)
+func (rt *Rtable) GetMemSelected(sel Selection, index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	return rt.GetMemSelectedContext(context.Background(), sel, index, count, condarr, ordarr)
+}
+
+// same as GetMemSelected, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) GetMemSelectedContext(ctx context.Context, sel Selection, index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	if !rt.valid() {
+		return [][]any{}, ErrInvalidTable
+	}
+	if rt.parent.mem == nil {
+		return [][]any{}, ErrNoMem
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, false, true)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer rt.parent.unlock(false, true)
+
+	return rt.getSelected(ctx, rt.parent.mem, sel, index, count, condarr, ordarr)
+}
+
+// tries to return the result columns of a SELECT statement for <sel> on <rt>, as one string
+func (rt *Rtable) selCols(sel Selection) (selcols string, err error) {
+	cnames := make(stringset, len(rt.cols))
+	for _, c := range rt.cols[rt.ddint:] {
+		cnames[c.name] = empty{}
+	}
+
+	cols := make([]string, 0, len(rt.cols))
+	if len(sel.Cols) == 0 {
+		for _, c := range rt.cols[rt.ddint:] {
+			cols = append(cols, "\""+c.name+"\"")
+		}
+	}
+	for _, sc := range sel.Cols {
+		switch {
+		case (sc.Cname == "") == (sc.Expr == ""):
+			return "", ErrBadData
+		case sc.Cname != "":
+			if !cnames.has(sc.Cname) {
+				return "", ErrIsNotPresent
+			}
+		case !oneExpr(sc.Expr):
+			return "", ErrBadData
+		}
+		cols = append(cols, sc.selCol())
+	}
+
+	selcols = strings.Join(cols, ", ")
+	if sel.Distinct {
+		selcols = "DISTINCT " + selcols
+	}
+	return selcols, nil
+}
+
+// returns whether <expr> is one piece of sql, which stays within its brackets and does not end the statement it is put into
+func oneExpr(expr string) bool {
+	toks, ok := sqlTokens(expr)
+	if !ok || (len(toks) == 0) {
+		return false
+	}
+
+	depth := 0
+	for _, tok := range toks {
+		switch tok.text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		case ";":
+			return false
+		}
+		if depth < 0 {
+			return false
+		}
+	}
+	return depth == 0
+}
+
+// without locking, tries to return rows of <rt> on <db> as selected by GetSelected
+func (rt *Rtable) getSelected(ctx context.Context, db sqlx.QueryerContext, sel Selection, index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	selcols, err := rt.selCols(sel)
+	if err != nil {
+		return [][]any{}, err
+	}
+	statement, subs, err := rt.selStatement(ctx, db, selcols, index, count, condarr, ordarr, false)
+	if err != nil {
+		return [][]any{}, err
+	}
+
+	rows, err := db.QueryxContext(ctx, statement, subs...)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row_vals, err := rows.SliceScan()
+		if err != nil {
+			return data, err
+		}
+		data = append(data, row_vals)
+	}
+	return data, rows.Err()
+}
@@ -0,0 +1,78 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that selections return the chosen columns and expressions in order, once per distinct row if asked, on disk and in memory
+func TestGetSelected(t *testing.T) {
+
+	//init
+	var tts = []dbops.Table{{Name: "items", Dd: true, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true},
+		{Name: "kind", Ext: "TEXT", Pk: false}, {Name: "price", Ext: "INTEGER", Pk: false}, {Name: "qty", Ext: "INTEGER", Pk: false}, {Name: "body", Ext: "BLOB", Pk: false}}}}
+
+	src, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "sel.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+
+	tbl := src.GetRtable("items")
+	err = tbl.InsertData(dbops.Conf_abort, []any{1, "a", 2, 3, []byte("xx"), 2, "b", 5, 1, []byte("yyy"), 3, "a", 2, 3, nil, 4, "c", 1, 1, nil})
+	if err == nil {
+		err = tbl.DeleteData([]dbops.Condition{{Cname: "id", Op: dbops.Op_eq, Val: 4}})
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	expect := func(data [][]any, err error, expected [][]any) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if !reflect.DeepEqual(data, expected) {
+			t.Fatalf("expected %v, got %v", expected, data)
+		}
+	}
+
+	//columns in the requested order, and computed values ordered by their names
+	sel := dbops.Selection{Cols: []dbops.SelCol{{Cname: "kind"}, {Cname: "id", As: "n"}, {Expr: "\"price\" * \"qty\"", As: "total"}, {Expr: "length(\"body\")"}}}
+	data, err := tbl.GetSelected(sel, 0, -1, []dbops.Condition{}, []dbops.Order{{Cname: "total", Dir: false}, {Cname: "n", Dir: true}})
+	expect(data, err, [][]any{{"a", int64(1), int64(6), int64(2)}, {"a", int64(3), int64(6), nil}, {"b", int64(2), int64(5), int64(3)}})
+
+	//distinct
+	sel = dbops.Selection{Cols: []dbops.SelCol{{Cname: "kind"}, {Cname: "price"}}, Distinct: true}
+	data, err = tbl.GetSelected(sel, 0, -1, []dbops.Condition{}, []dbops.Order{{Cname: "kind", Dir: true}})
+	expect(data, err, [][]any{{"a", int64(2)}, {"b", int64(5)}})
+
+	//no columns -> every column
+	data, err = tbl.GetSelected(dbops.Selection{}, 0, 1, []dbops.Condition{{Cname: "kind", Op: dbops.Op_eq, Val: "b"}}, []dbops.Order{})
+	expect(data, err, [][]any{{int64(2), "b", int64(5), int64(1), []byte("yyy")}})
+
+	//invalid
+	bad := map[dbops.SelCol]error{{Cname: "nope"}: dbops.ErrIsNotPresent, {}: dbops.ErrBadData, {Cname: "id", Expr: "1"}: dbops.ErrBadData,
+		{Expr: "1); DROP TABLE items; --"}: dbops.ErrBadData, {Expr: "(1"}: dbops.ErrBadData}
+	for sc, expected := range bad {
+		_, err = tbl.GetSelected(dbops.Selection{Cols: []dbops.SelCol{sc}}, 0, -1, []dbops.Condition{}, []dbops.Order{})
+		if err != expected {
+			t.Fatalf("%#v: expected %v, got %v", sc, expected, err)
+		}
+	}
+
+	//in memory
+	err = src.CreateMem()
+	if err == nil {
+		err = tbl.LoadIntoMem(0, -1, dbops.Conf_abort, []dbops.Condition{})
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	sel = dbops.Selection{Cols: []dbops.SelCol{{Expr: "upper(kind)", As: "k"}}, Distinct: true}
+	data, err = tbl.GetMemSelected(sel, 0, -1, []dbops.Condition{}, []dbops.Order{{Cname: "k", Dir: false}})
+	expect(data, err, [][]any{{"B"}, {"A"}})
+}
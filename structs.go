@@ -0,0 +1,343 @@
+package dbops
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// -------------------- STRUCT MAPPING --------------------
+
+/*
+Structs are mapped to rows through their exported fields, using the "dbops" struct tag:
+
+	type Row struct {
+		ID   int64   `dbops:"id,pk"`                 //column "id", part of the primary key
+		Name *string `dbops:"full name,ext=TEXT"`    //column "full name", with Col.Ext "TEXT" (ext= has to be the last option)
+		Seen time.Time                               //column "Seen" (no tag -> field name)
+		Tmp  int     `dbops:"-"`                     //not mapped
+	}
+
+  - embedded structs without a tag are flattened into their parent
+  - NULL can only be read into pointers (nil) or types implementing sql.Scanner
+*/
+
+// a field of a struct mapped to a column
+type sfield struct {
+	index []int  //field index (reflect.Value.FieldByIndex)
+	col   string //column name
+	pk    bool   //whether the column is a part of the primary key (only used by TableFromStruct)
+	ext   string //Col.Ext of the column (only used by TableFromStruct)
+}
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+var timeType = reflect.TypeOf(time.Time{})
+
+// tries to return the mapped fields of struct type <t>
+func structFields(t reflect.Type) ([]sfield, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, ErrBadData
+	}
+
+	var fields []sfield
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, tagged := f.Tag.Lookup("dbops")
+		if tag == "-" {
+			continue
+		}
+
+		if f.Anonymous && !tagged && (f.Type.Kind() == reflect.Struct) { //flatten embedded structs
+			sub, err := structFields(f.Type)
+			if err != nil {
+				return nil, err
+			}
+			for _, sf := range sub {
+				sf.index = append([]int{i}, sf.index...)
+				fields = append(fields, sf)
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		sf := sfield{index: []int{i}, col: f.Name}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name != "" {
+			sf.col = name
+		}
+		for opts != "" {
+			var opt string
+			if strings.HasPrefix(opts, "ext=") { //ext takes the rest of the tag, it may contain commas
+				sf.ext, opts = opts[len("ext="):], ""
+				continue
+			}
+			opt, opts, _ = strings.Cut(opts, ",")
+			switch opt {
+			case "pk":
+				sf.pk = true
+			default:
+				return nil, ErrBadData
+			}
+		}
+		if sf.ext == "" {
+			sf.ext = extOfType(f.Type)
+		}
+
+		fields = append(fields, sf)
+	}
+	return fields, nil
+}
+
+// returns a Col.Ext matching the go type <t> ("" -> no type, such a column will accept anything)
+func extOfType(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return "DATETIME"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "INTEGER"
+	case reflect.Float32, reflect.Float64:
+		return "REAL"
+	case reflect.String:
+		return "TEXT"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "BLOB"
+		}
+	}
+	return ""
+}
+
+// tries to return the columns of <rt> which the fields of <fields> map to (in the same order), any field not mapping to a column -> ErrIsNotPresent
+func (rt *Rtable) structCols(fields []sfield) ([]rcol, error) {
+	colmap := make(map[string]rcol, len(rt.cols))
+	for _, c := range rt.cols[rt.ddint:] {
+		colmap[c.name] = c
+	}
+
+	cols := make([]rcol, len(fields))
+	for i, sf := range fields {
+		c, ok := colmap[sf.col]
+		if !ok {
+			return nil, ErrIsNotPresent
+		}
+		cols[i] = c
+	}
+	return cols, nil
+}
+
+/*
+tries to return a Table named <name> whose columns are the mapped fields of T (in field order)
+  - Col.Ext is taken from the "ext=" tag option, or derived from the field's type
+  - Col.Pk is set by the "pk" tag option
+*/
+func TableFromStruct[T any](name string, dd bool) (Table, error) {
+	fields, err := structFields(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return Table{}, err
+	}
+
+	t := Table{Name: name, Dd: dd, Cols: make([]Col, len(fields))}
+	for i, sf := range fields {
+		t.Cols[i] = Col{Name: sf.col, Ext: sf.ext, Pk: sf.pk}
+	}
+
+	if !t.valid() {
+		return Table{}, ErrInvalidTable
+	}
+	return t, nil
+}
+
+// tries to flatten <rows> into values of the columns their fields map to
+func structValues[T any](fields []sfield, rows []T) []any {
+	data := make([]any, 0, len(rows)*len(fields))
+	for i := range rows {
+		v := reflect.ValueOf(&rows[i]).Elem()
+		for _, sf := range fields {
+			fv := v.FieldByIndex(sf.index)
+			if (fv.Kind() == reflect.Pointer) && !fv.Type().Implements(scannerType) {
+				if fv.IsNil() {
+					data = append(data, nil)
+					continue
+				}
+				fv = fv.Elem()
+			}
+			data = append(data, fv.Interface())
+		}
+	}
+	return data
+}
+
+// tries to insert (or <cbh>) <rows> into <rt> (on-disk), every mapped field of T has to have a column in <rt>, columns without a field get their default
+func InsertStructs[T any](rt *Rtable, cbh conflict_behaviour, rows []T) error {
+	return InsertStructsContext(context.Background(), rt, cbh, rows)
+}
+
+// same as InsertStructs, but gives up once <ctx> is done (-> ctx.Err())
+func InsertStructsContext[T any](ctx context.Context, rt *Rtable, cbh conflict_behaviour, rows []T) (err error) {
+	if !rt.valid() {
+		return ErrInvalidTable
+	}
+
+	fields, err := structFields(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return err
+	}
+	cols, err := rt.structCols(fields)
+	if err != nil {
+		return err
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, true, false)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.unlock(true, false)
+
+	return rt.insert(ctx, rt.parent.db, cbh, cols, structValues(fields, rows))
+}
+
+// tries to insert (or <cbh>) <rows> into <rt>'s in-memory version, every mapped field of T has to have a column in <rt>
+func InsertMemStructs[T any](rt *Rtable, cbh conflict_behaviour, rows []T) error {
+	return InsertMemStructsContext(context.Background(), rt, cbh, rows)
+}
+
+// same as InsertMemStructs, but gives up once <ctx> is done (-> ctx.Err())
+func InsertMemStructsContext[T any](ctx context.Context, rt *Rtable, cbh conflict_behaviour, rows []T) (err error) {
+	if !rt.valid() {
+		return ErrInvalidTable
+	}
+	if rt.parent.mem == nil {
+		return ErrNoMem
+	}
+
+	fields, err := structFields(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return err
+	}
+	cols, err := rt.structCols(fields)
+	if err != nil {
+		return err
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, false, true)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.unlock(false, true)
+
+	return rt.insert(ctx, rt.parent.mem, cbh, cols, structValues(fields, rows))
+}
+
+/*
+tries to return rows of <rt> (on-disk) as a slice of T, selected the same way as in GetData
+  - every mapped field of T has to have a column in <rt>, columns without a field are not retrieved
+*/
+func GetStructs[T any](rt *Rtable, index int, count int, condarr []Condition, ordarr []Order) ([]T, error) {
+	return GetStructsContext[T](context.Background(), rt, index, count, condarr, ordarr)
+}
+
+// same as GetStructs, but gives up once <ctx> is done (-> ctx.Err())
+func GetStructsContext[T any](ctx context.Context, rt *Rtable, index int, count int, condarr []Condition, ordarr []Order) (data []T, err error) {
+	if !rt.valid() {
+		return []T{}, ErrInvalidTable
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, true, false)
+	if err != nil {
+		return []T{}, err
+	}
+	defer rt.parent.unlock(true, false)
+
+	return getStructs[T](ctx, rt, false, index, count, condarr, ordarr)
+}
+
+// tries to return rows of <rt>'s in-memory version as a slice of T, selected the same way as in GetMemData
+func GetMemStructs[T any](rt *Rtable, index int, count int, condarr []Condition, ordarr []Order) ([]T, error) {
+	return GetMemStructsContext[T](context.Background(), rt, index, count, condarr, ordarr)
+}
+
+// same as GetMemStructs, but gives up once <ctx> is done (-> ctx.Err())
+func GetMemStructsContext[T any](ctx context.Context, rt *Rtable, index int, count int, condarr []Condition, ordarr []Order) (data []T, err error) {
+	if !rt.valid() {
+		return []T{}, ErrInvalidTable
+	}
+	if rt.parent.mem == nil {
+		return []T{}, ErrNoMem
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, false, true)
+	if err != nil {
+		return []T{}, err
+	}
+	defer rt.parent.unlock(false, true)
+
+	return getStructs[T](ctx, rt, true, index, count, condarr, ordarr)
+}
+
+// without locking, does what GetStructs (disk_or_mem false) or GetMemStructs (true) does
+func getStructs[T any](ctx context.Context, rt *Rtable, disk_or_mem bool, index int, count int, condarr []Condition, ordarr []Order) (data []T, err error) {
+	fields, err := structFields(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return []T{}, err
+	}
+	cols, err := rt.structCols(fields)
+	if err != nil {
+		return []T{}, err
+	}
+
+	db := rt.parent.db
+	if disk_or_mem {
+		db = rt.parent.mem
+	}
+
+	selcols := make([]string, len(cols))
+	for i, c := range cols {
+		selcols[i] = "\"" + c.name + "\""
+	}
+	statement, subs, err := rt.selStatement(ctx, db, strings.Join(selcols, ", "), index, count, condarr, ordarr, false)
+	if err != nil {
+		return []T{}, err
+	}
+
+	rows, err := db.QueryxContext(ctx, statement, subs...)
+	if err != nil {
+		return []T{}, err
+	}
+	defer rows.Close()
+
+	data = []T{}
+	dests := make([]any, len(fields))
+	for rows.Next() {
+		var row T
+		v := reflect.ValueOf(&row).Elem()
+		for i, sf := range fields {
+			dests[i] = v.FieldByIndex(sf.index).Addr().Interface()
+		}
+
+		err = rows.Scan(dests...)
+		if err != nil {
+			return data, err
+		}
+		data = append(data, row)
+	}
+
+	return data, rows.Err()
+}
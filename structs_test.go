@@ -0,0 +1,88 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+type structBase struct {
+	ID int64 `dbops:"id,pk"`
+}
+
+type structRow struct {
+	structBase
+	Name  *string `dbops:"full name"`
+	Score float64
+	Tmp   int `dbops:"-"`
+}
+
+// tests that structs round trip through both disk and memory, and that TableFromStruct derives the expected Table
+func TestStructs(t *testing.T) {
+
+	//init
+	tt, err := dbops.TableFromStruct[structRow]("structs", true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := dbops.Table{Name: "structs", Dd: true, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true},
+		{Name: "full name", Ext: "TEXT", Pk: false},
+		{Name: "Score", Ext: "REAL", Pk: false}}}
+	if !reflect.DeepEqual(tt, expected) {
+		t.Fatalf("unexpected table %v", tt)
+	}
+
+	src, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "structs.db"), []dbops.Table{tt})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+	tbl := src.GetRtable(tt.Name)
+
+	name := "x"
+	rows := []structRow{{structBase{1}, &name, 1.5, 7}, {structBase{2}, nil, 2.5, 7}}
+	err = dbops.InsertStructs(tbl, dbops.Conf_abort, rows)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//Tmp is not mapped, so it comes back empty
+	for i := range rows {
+		rows[i].Tmp = 0
+	}
+	got, err := dbops.GetStructs[structRow](tbl, 0, -1, []dbops.Condition{}, []dbops.Order{{Cname: "id", Dir: true}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !reflect.DeepEqual(got, rows) {
+		t.Fatalf("unexpected rows %v", got)
+	}
+
+	//memory works the same way
+	err = src.CreateMem()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = dbops.InsertMemStructs(tbl, dbops.Conf_abort, rows[1:])
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	got, err = dbops.GetMemStructs[structRow](tbl, 0, -1, []dbops.Condition{}, []dbops.Order{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !reflect.DeepEqual(got, rows[1:]) {
+		t.Fatalf("unexpected in-memory rows %v", got)
+	}
+
+	//fields without a column are rejected
+	type other struct {
+		Missing int
+	}
+	_, err = dbops.GetStructs[other](tbl, 0, -1, []dbops.Condition{}, []dbops.Order{})
+	if err != dbops.ErrIsNotPresent {
+		t.Fatalf("expected ErrIsNotPresent, got %v", err)
+	}
+}
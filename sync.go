@@ -0,0 +1,321 @@
+package dbops
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrDestructive error = errors.New("ErrDestructive (dbops) - Refused to apply a schema change which loses data without it being allowed")
+
+// -------------------- SCHEMA SYNC --------------------
+
+/*
+the steps making the schema of a database match a []Table, as returned by DataSrc.PlanSync
+  - tables are matched by name, columns by name (so a renamed column is removed and added, use a Migration to keep its data)
+  - print it (String), check it (Destructive), then apply it (DataSrc.ApplySync)
+*/
+type SyncPlan struct {
+	Steps []SyncStep
+
+	tables []Table //the tables the plan was made for
+}
+
+// a step of a SyncPlan
+type SyncStep struct {
+	MigStep
+
+	Destructive bool   //whether the step loses data (dropping a table, removing a column, retyping a column or no longer using Dd)
+	Detail      string //what is changed, e.g. `+ "col" TEXT` per line
+}
+
+// returns whether any step of <plan> loses data
+func (plan SyncPlan) Destructive() bool {
+	return slices.ContainsFunc(plan.Steps, func(step SyncStep) bool { return step.Destructive })
+}
+
+// returns a description of <plan>, one step per line ("!" marks destructive steps), followed by its details
+func (plan SyncPlan) String() string {
+	var b strings.Builder
+	for _, step := range plan.Steps {
+		if step.Destructive {
+			b.WriteString("! ")
+		} else {
+			b.WriteString("  ")
+		}
+		b.WriteString(step.MigStep.String() + "\n")
+
+		for _, line := range strings.Split(step.Detail, "\n") {
+			if line != "" {
+				b.WriteString("    " + line + "\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// returns a description of <idx>, e.g. `UNIQUE INDEX "name"("a", "b") WHERE ...`
+func (idx Index) describe() string {
+	return strings.TrimSuffix(strings.Replace(idx.rindex().crStatement("")[len("CREATE "):], " ON \"\"", "", 1), ";")
+}
+
+// returns whether <idx> and <idx2> are equal
+func (idx Index) equal(idx2 Index) bool {
+	return pubPriIdxEqual(idx, idx2.rindex())
+}
+
+// returns a description of <fk>, e.g. `FOREIGN KEY("a") REFERENCES "t"("b") ON DELETE CASCADE`
+func (fk ForeignKey) describe() string {
+	return fk.rfkey().clause()
+}
+
+// returns whether <fk> and <fk2> are equal
+func (fk ForeignKey) equal(fk2 ForeignKey) bool {
+	return pubPriFkEqual(fk, fk2.rfkey())
+}
+
+// returns a description of <c>, e.g. `"col" TEXT (pk)`
+func (c Col) describe() string {
+	s := "\"" + c.Name + "\" " + c.Ext
+	if c.Pk {
+		s += " (pk)"
+	}
+	return s
+}
+
+// without locking, returns a step (ok) which makes <rt> look like <t> (of the same name), none if they are equal already
+func (rt *Rtable) syncStep(t Table) (step SyncStep, ok bool) {
+	cur := rt.ToTable()
+	if (cur.Dd == t.Dd) && (cur.Fts == t.Fts) && slices.EqualFunc(cur.Cols, t.Cols, Col.equal) && slices.EqualFunc(cur.Indexes, t.Indexes, Index.equal) && slices.EqualFunc(cur.ForeignKeys, t.ForeignKeys, ForeignKey.equal) {
+		return step, false
+	}
+
+	var detail []string
+	destructive := false
+	if cur.Dd != t.Dd {
+		if t.Dd {
+			detail = append(detail, "+ Dd")
+		} else {
+			detail = append(detail, "- Dd (rows marked as deleted become visible)")
+			destructive = true
+		}
+	}
+	if cur.Fts != t.Fts {
+		if t.Fts {
+			detail = append(detail, "+ Fts")
+		} else {
+			detail = append(detail, "- Fts")
+		}
+	}
+
+	curcols := make(map[string]Col, len(cur.Cols))
+	for _, c := range cur.Cols {
+		curcols[c.Name] = c
+	}
+	newnames := make(stringset, len(t.Cols))
+	remap := make(map[string]string, len(t.Cols))
+	for _, c := range t.Cols {
+		newnames[c.Name] = empty{}
+
+		old, exists := curcols[c.Name]
+		switch {
+		case !exists:
+			detail = append(detail, "+ "+c.describe())
+			continue
+		case !old.equal(c):
+			detail = append(detail, "~ "+old.describe()+" -> "+c.describe())
+			destructive = true
+		}
+		remap[c.Name] = c.Name
+	}
+	for _, c := range cur.Cols {
+		if !newnames.has(c.Name) {
+			detail = append(detail, "- "+c.describe())
+			destructive = true
+		}
+	}
+
+	for _, idx := range cur.Indexes {
+		if !slices.ContainsFunc(t.Indexes, idx.equal) {
+			detail = append(detail, "- "+idx.describe())
+		}
+	}
+	for _, idx := range t.Indexes {
+		if !slices.ContainsFunc(cur.Indexes, idx.equal) {
+			detail = append(detail, "+ "+idx.describe())
+		}
+	}
+	for _, fk := range cur.ForeignKeys {
+		if !slices.ContainsFunc(t.ForeignKeys, fk.equal) {
+			detail = append(detail, "- "+fk.describe())
+		}
+	}
+	for _, fk := range t.ForeignKeys {
+		if !slices.ContainsFunc(cur.ForeignKeys, fk.equal) {
+			detail = append(detail, "+ "+fk.describe())
+		}
+	}
+	if len(detail) == 0 {
+		detail = append(detail, "(reordered columns)")
+	}
+
+	step = SyncStep{MigStep: StepEdit(t.Name, t.Cols, remap), Destructive: destructive, Detail: strings.Join(detail, "\n")}
+	step.table.Dd, step.table.Indexes, step.table.ForeignKeys, step.table.Fts = t.Dd, t.Indexes, t.ForeignKeys, t.Fts
+	step.whole = true
+	return step, true
+}
+
+// without locking, tries to return a plan making <rtables> match <tables>
+func syncPlan(rtables []*Rtable, tables []Table) (plan SyncPlan, err error) {
+	plan = SyncPlan{Steps: []SyncStep{}, tables: tables}
+
+	wanted := make(stringset, len(tables))
+	for _, t := range tables {
+		if !t.valid() {
+			return SyncPlan{}, ErrInvalidTable
+		}
+		if wanted.has(t.Name) {
+			return SyncPlan{}, ErrIsDuplicate
+		}
+		wanted[t.Name] = empty{}
+
+		tidx := slices.IndexFunc(rtables, func(rt *Rtable) bool { return rt.name == t.Name })
+		if tidx == -1 {
+			detail := make([]string, 0, len(t.Cols)+len(t.Indexes)+len(t.ForeignKeys))
+			for _, c := range t.Cols {
+				detail = append(detail, "+ "+c.describe())
+			}
+			for _, idx := range t.Indexes {
+				detail = append(detail, "+ "+idx.describe())
+			}
+			for _, fk := range t.ForeignKeys {
+				detail = append(detail, "+ "+fk.describe())
+			}
+			if t.Fts {
+				detail = append(detail, "+ Fts")
+			}
+			plan.Steps = append(plan.Steps, SyncStep{MigStep: StepAddTable(t), Detail: strings.Join(detail, "\n")})
+			continue
+		}
+
+		step, ok := rtables[tidx].syncStep(t)
+		if ok {
+			plan.Steps = append(plan.Steps, step)
+		}
+	}
+
+	for _, rt := range rtables {
+		if !wanted.has(rt.name) && (rt.name != LogTableName) { //the log table is seen as a table without seekOwn, but it is kept by dbops
+			plan.Steps = append(plan.Steps, SyncStep{MigStep: StepDelTable(rt.name), Destructive: true})
+		}
+	}
+	return plan, nil
+}
+
+// tries to return a plan making the schema of <src> (on-disk) match <tables> (in their order), without applying it
+func (src *DataSrc) PlanSync(tables []Table) (SyncPlan, error) {
+	return src.PlanSyncContext(context.Background(), tables)
+}
+
+// same as PlanSync, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) PlanSyncContext(ctx context.Context, tables []Table) (plan SyncPlan, err error) {
+	if src == nil {
+		return SyncPlan{}, ErrNilSource
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = src.lock(ctx, true, false)
+	if err != nil {
+		return SyncPlan{}, err
+	}
+	defer src.unlock(true, false)
+
+	return syncPlan(src.rtables, tables)
+}
+
+/*
+tries to apply <plan> to <src> (in one transaction), as returned by PlanSync
+  - a destructive plan is refused (-> ErrDestructive), unless <allowDestructive>
+  - if the schema changed since planning, so that <plan> is no longer the plan, it is refused (-> ErrDiffStructure)
+  - operates on-disk only, so <src> must not have an in-memory database (-> ErrBadData)
+  - a step breaking a view -> ErrViewDepends (see Migrate)
+*/
+func (src *DataSrc) ApplySync(plan SyncPlan, allowDestructive bool) (err error) {
+	return src.ApplySyncContext(context.Background(), plan, allowDestructive)
+}
+
+// same as ApplySync, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) ApplySyncContext(ctx context.Context, plan SyncPlan, allowDestructive bool) (err error) {
+	if src == nil {
+		return ErrNilSource
+	}
+	if src.mem != nil {
+		return ErrBadData
+	}
+	if plan.Destructive() && !allowDestructive {
+		return ErrDestructive
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = src.lock(ctx, true, false)
+	if err != nil {
+		return err
+	}
+	defer src.unlock(true, false)
+
+	current, err := syncPlan(src.rtables, plan.tables)
+	if err != nil {
+		return err
+	}
+	if current.String() != plan.String() {
+		return ErrDiffStructure
+	}
+
+	rtables, rviews := src.migCopies() //so a failing plan leaves <src> alone
+
+	err = fkOffTx(ctx, src.db, true, func(tx *sqlx.Tx) error { //as in Migrate
+		for _, step := range plan.Steps {
+			rtables, rviews, err = src.migStep(ctx, tx, rtables, rviews, step.MigStep, true)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	//the order of <tables>
+	slices.SortStableFunc(rtables, func(a *Rtable, b *Rtable) int {
+		return slices.IndexFunc(plan.tables, func(t Table) bool { return t.Name == a.name }) - slices.IndexFunc(plan.tables, func(t Table) bool { return t.Name == b.name })
+	})
+	src.migCommit(rtables, rviews)
+	return nil
+}
+
+/*
+tries to return a handle to the database at <path>, like ConnectSrc (seekOwn), after making its schema match <tables> (see PlanSync)
+  - also returns the applied plan, or the refused one (with ErrDestructive) to be printed and approved
+*/
+func ConnectSrcSync(path string, tables []Table, allowDestructive bool) (*DataSrc, SyncPlan, error) {
+	src, err := ConnectSrc(path, true)
+	if err != nil {
+		return nil, SyncPlan{}, err
+	}
+
+	plan, err := src.PlanSync(tables)
+	if err == nil {
+		err = src.ApplySync(plan, allowDestructive)
+	}
+	if err != nil {
+		src.Disconnect()
+		return nil, plan, err
+	}
+	return src, plan, nil
+}
@@ -0,0 +1,134 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that schema sync plans adds, edits and drops, refusing destructive plans unless allowed
+func TestSync(t *testing.T) {
+
+	//init
+	path := filepath.Join(t.TempDir(), "sync.db")
+	var tts = []dbops.Table{{Name: "keep", Dd: false, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true},
+		{Name: "old", Ext: "TEXT", Pk: false}}},
+		{Name: "gone", Dd: false, Cols: []dbops.Col{{Name: "x", Ext: "TEXT", Pk: false}}}}
+
+	src, err := dbops.CreateSrc(path, tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = src.GetRtable("keep").InsertData(dbops.Conf_abort, []any{1, "a", 2, "b"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//matching already -> nothing to do
+	plan, err := src.PlanSync(tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(plan.Steps) != 0 {
+		t.Fatalf("expected an empty plan, got\n%s", plan)
+	}
+
+	//adding only
+	grown := []dbops.Table{{Name: "keep", Dd: true, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true},
+		{Name: "old", Ext: "TEXT", Pk: false}, {Name: "new", Ext: "INTEGER DEFAULT 7", Pk: false}}},
+		tts[1],
+		{Name: "added", Dd: false, Cols: []dbops.Col{{Name: "y", Ext: "TEXT", Pk: false}}}}
+	plan, err = src.PlanSync(grown)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if plan.Destructive() || (len(plan.Steps) != 2) || !strings.Contains(plan.String(), "+ \"new\" INTEGER DEFAULT 7") {
+		t.Fatalf("unexpected plan\n%s", plan)
+	}
+	keep := src.GetRtable("keep")
+	err = src.ApplySync(plan, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = checkTables(src, grown)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if (keep != src.GetRtable("keep")) || !reflect.DeepEqual(keep.ToTable(), grown[0]) {
+		t.Fatalf("the handle of a synced table went stale, got %v", keep.ToTable())
+	}
+	err = checkData(src.GetRtable("keep"), "id", [][]any{{int64(1), "a", int64(7)}, {int64(2), "b", int64(7)}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//an outdated plan is refused
+	err = src.ApplySync(plan, false)
+	if err != dbops.ErrDiffStructure {
+		t.Fatalf("expected ErrDiffStructure, got %v", err)
+	}
+	err = src.Disconnect()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//removing a column and a table is destructive
+	shrunk := []dbops.Table{{Name: "keep", Dd: true, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true},
+		{Name: "new", Ext: "INTEGER DEFAULT 7", Pk: false}}}, grown[2]}
+	_, plan, err = dbops.ConnectSrcSync(path, shrunk, false)
+	if err != dbops.ErrDestructive {
+		t.Fatalf("expected ErrDestructive, got %v", err)
+	}
+	if !strings.Contains(plan.String(), "! DROP TABLE \"gone\"") || !strings.Contains(plan.String(), "- \"old\" TEXT") {
+		t.Fatalf("unexpected plan\n%s", plan)
+	}
+
+	src, _, err = dbops.ConnectSrcSync(path, shrunk, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+	err = checkTables(src, shrunk)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = checkData(src.GetRtable("keep"), "id", [][]any{{int64(1), int64(7)}, {int64(2), int64(7)}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//handles of dropped tables are invalidated
+	added := src.GetRtable("added")
+	plan, err = src.PlanSync(shrunk[:1])
+	if err == nil {
+		err = src.ApplySync(plan, true)
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = added.InsertData(dbops.Conf_abort, []any{"y"})
+	if err != dbops.ErrInvalidTable {
+		t.Fatalf("expected ErrInvalidTable for the handle of a dropped table, got %v", err)
+	}
+
+	//the log table is not dropped, though it is seen without seekOwn
+	err = src.GetRtable("keep").DeleteData([]dbops.Condition{{Cname: "id", Op: dbops.Op_eq, Val: 1}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	foreign, err := dbops.ConnectSrc(path, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer foreign.Disconnect()
+	plan, err = foreign.PlanSync(shrunk[:1])
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if strings.Contains(plan.String(), dbops.LogTableName) {
+		t.Fatalf("the log table would be dropped by\n%s", plan)
+	}
+}
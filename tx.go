@@ -0,0 +1,284 @@
+package dbops
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrTxDone error = errors.New("ErrTxDone (dbops) - Attempted to use a transaction which has already been committed or rolled back")
+var ErrTxWriteBack error = errors.New("ErrTxWriteBack (dbops) - cannot begin a transaction in write-back mode, as its changes would bypass the tracked ones")
+
+// -------------------- TRANSACTIONS --------------------
+
+/*
+a set of operations on the tables of one data source, which are committed or rolled back as a unit
+  - holds the locks of its data source until committed or rolled back, so other methods of it will block in the meantime
+  - only touches the in-memory database if it was begun withMem
+  - cannot be begun in write-back mode, and makes read-through mode forget the cached queries of the tables it changed on disk once committed
+*/
+type Tx struct {
+	src *DataSrc
+	ctx context.Context
+
+	disk *sqlx.Tx
+	mem  *sqlx.Tx //nil if not begun withMem
+
+	changed stringset //names of the tables changed on disk
+	done    bool
+}
+
+// tries to begin a transaction on <src>'s disk (withMem -> and its in-memory database), in write-back mode -> ErrTxWriteBack
+func (src *DataSrc) Begin(withMem bool) (*Tx, error) {
+	return src.BeginContext(context.Background(), withMem)
+}
+
+// same as Begin, but gives up waiting once <ctx> is done (-> ctx.Err()), and rolls back if <ctx> is done before committing
+func (src *DataSrc) BeginContext(ctx context.Context, withMem bool) (tx *Tx, err error) {
+	if src == nil {
+		return nil, ErrNilSource
+	}
+	if withMem && (src.mem == nil) {
+		return nil, ErrNoMem
+	}
+
+	memheld, err := src.lock(ctx, true, true)
+	if err != nil {
+		return nil, err
+	}
+	if src.wb != nil {
+		src.unlock(true, memheld)
+		return nil, ErrTxWriteBack
+	}
+	if memheld && !withMem {
+		src.unlock(false, true)
+		memheld = false
+	}
+
+	tx = &Tx{src: src, ctx: ctx, changed: stringset{}}
+
+	tx.disk, err = src.db.BeginTxx(ctx, nil)
+	if err != nil {
+		src.unlock(true, memheld)
+		return nil, ctxErr(ctx, err)
+	}
+
+	if memheld {
+		tx.mem, err = src.mem.BeginTxx(ctx, nil)
+		if err != nil {
+			tx.disk.Rollback()
+			src.unlock(true, memheld)
+			return nil, ctxErr(ctx, err)
+		}
+	}
+
+	return tx, nil
+}
+
+// checks whether <tx> can still be used on <rt>
+func (tx *Tx) check(rt *Rtable) error {
+	if (tx == nil) || tx.done {
+		return ErrTxDone
+	}
+	if !rt.valid() {
+		return ErrInvalidTable
+	}
+	if rt.parent != tx.src {
+		return ErrIsNotPresent
+	}
+	return nil
+}
+
+// same as check, also noting that <tx> changes <rt> on disk
+func (tx *Tx) checkChange(rt *Rtable) error {
+	err := tx.check(rt)
+	if err == nil {
+		tx.changed[rt.name] = empty{}
+	}
+	return err
+}
+
+// ends <tx>, giving back the locks of its data source
+func (tx *Tx) finish() {
+	tx.done = true
+	tx.src.unlock(true, tx.mem != nil)
+}
+
+/*
+tries to commit all changes made in <tx> (on any error, everything that can still be rolled back will be)
+  - disk is committed before memory, so if committing memory fails, disk stays committed
+*/
+func (tx *Tx) Commit() (err error) {
+	if (tx == nil) || tx.done {
+		return ErrTxDone
+	}
+	defer tx.finish()
+
+	err = tx.disk.Commit()
+	if err != nil {
+		if tx.mem != nil {
+			tx.mem.Rollback()
+		}
+		return ctxErr(tx.ctx, err)
+	}
+
+	if len(tx.changed) != 0 { //cached queries of changed tables may miss rows now
+		memheld, _ := tx.src.lock(context.Background(), false, tx.mem == nil)
+		if tx.src.rc != nil {
+			for name := range tx.changed {
+				tx.src.rc.drop(name)
+			}
+		}
+		tx.src.unlock(false, memheld)
+	}
+
+	if tx.mem != nil {
+		err = tx.mem.Commit()
+		if err != nil {
+			return ctxErr(tx.ctx, err)
+		}
+	}
+	return nil
+}
+
+// tries to discard all changes made in <tx>
+func (tx *Tx) Rollback() (err error) {
+	if (tx == nil) || tx.done {
+		return ErrTxDone
+	}
+	defer tx.finish()
+
+	err = tx.disk.Rollback()
+	if tx.mem != nil {
+		merr := tx.mem.Rollback()
+		if err == nil {
+			err = merr
+		}
+	}
+	return err
+}
+
+// same as Rtable.InsertData, but as a part of <tx>
+func (tx *Tx) InsertData(rt *Rtable, cbh conflict_behaviour, data []any) (err error) {
+	if err = tx.checkChange(rt); err != nil {
+		return err
+	}
+
+	return ctxErr(tx.ctx, rt.insert(tx.ctx, tx.disk, cbh, rt.cols[rt.ddint:], data))
+}
+
+// same as Rtable.InsertMemData, but as a part of <tx>
+func (tx *Tx) InsertMemData(rt *Rtable, cbh conflict_behaviour, data []any) (err error) {
+	if err = tx.check(rt); err != nil {
+		return err
+	}
+	if tx.mem == nil {
+		return ErrNoMem
+	}
+
+	return ctxErr(tx.ctx, rt.insert(tx.ctx, tx.mem, cbh, rt.cols[rt.ddint:], data))
+}
+
+// same as Rtable.GetData, but as a part of <tx> (sees changes made in it)
+func (tx *Tx) GetData(rt *Rtable, index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	if err = tx.check(rt); err != nil {
+		return [][]any{}, err
+	}
+
+	data, err = rt.get(tx.ctx, tx.disk, index, count, condarr, ordarr, false)
+	return data, ctxErr(tx.ctx, err)
+}
+
+// same as Rtable.GetMemData, but as a part of <tx> (sees changes made in it)
+func (tx *Tx) GetMemData(rt *Rtable, index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	if err = tx.check(rt); err != nil {
+		return [][]any{}, err
+	}
+	if tx.mem == nil {
+		return [][]any{}, ErrNoMem
+	}
+
+	data, err = rt.get(tx.ctx, tx.mem, index, count, condarr, ordarr, false)
+	return data, ctxErr(tx.ctx, err)
+}
+
+// same as Rtable.DeleteData, but as a part of <tx>
+func (tx *Tx) DeleteData(rt *Rtable, condarr []Condition) (err error) {
+	if err = tx.checkChange(rt); err != nil {
+		return err
+	}
+
+	err = rt.loggedDelete(tx.ctx, tx.disk, condarr)
+	if (err == nil) && (tx.mem != nil) {
+		_, err = rt.delete(tx.ctx, tx.mem, condarr)
+	}
+	return ctxErr(tx.ctx, err)
+}
+
+// same as Rtable.UpdateData, but as a part of <tx>
+func (tx *Tx) UpdateData(rt *Rtable, set map[string]any, condarr []Condition) (affected int, err error) {
+	if err = tx.checkChange(rt); err != nil {
+		return 0, err
+	}
+
+	statement, subs, err := rt.updStatement(set, condarr)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.disk.ExecContext(tx.ctx, statement, subs...)
+	if err != nil {
+		return 0, ctxErr(tx.ctx, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if tx.mem != nil {
+		_, err = tx.mem.ExecContext(tx.ctx, statement, subs...)
+		if err != nil {
+			return 0, ctxErr(tx.ctx, err)
+		}
+	}
+	return int(n), nil
+}
+
+// same as Rtable.UndoDelete, but as a part of <tx>
+func (tx *Tx) UndoDelete(rt *Rtable, ver int) (err error) {
+	if err = tx.checkChange(rt); err != nil {
+		return err
+	}
+	if !rt.dd {
+		return nil
+	}
+
+	ver, err = rt.absVer(tx.ctx, tx.disk, ver)
+	if err == nil {
+		err = rt.loggedUndelete(tx.ctx, tx.disk, ver)
+	}
+	if (err == nil) && (tx.mem != nil) {
+		_, err = rt.undelete(tx.ctx, tx.mem, ver)
+	}
+	return ctxErr(tx.ctx, err)
+}
+
+// same as Rtable.ConfirmDelete, but as a part of <tx>
+func (tx *Tx) ConfirmDelete(rt *Rtable, ver int) (err error) {
+	if err = tx.checkChange(rt); err != nil {
+		return err
+	}
+	if !rt.dd {
+		return nil
+	}
+
+	ver, err = rt.absVer(tx.ctx, tx.disk, ver)
+	if err == nil {
+		err = rt.loggedRemove(tx.ctx, tx.disk, ver)
+	}
+	if (err == nil) && (tx.mem != nil) {
+		_, err = rt.remove(tx.ctx, tx.mem, ver)
+	}
+	return ctxErr(tx.ctx, err)
+}
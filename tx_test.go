@@ -0,0 +1,141 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that changes made in a transaction spanning two tables (and memory) are applied or discarded together
+func TestTx(t *testing.T) {
+
+	//init
+	var tts = []dbops.Table{{Name: "tx a", Dd: true, Cols: []dbops.Col{{Name: "a a", Ext: "INTEGER", Pk: true}}},
+		{Name: "tx b", Dd: false, Cols: []dbops.Col{{Name: "a a", Ext: "INTEGER", Pk: true}}}}
+
+	src, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "tx.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+
+	err = src.CreateMem()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	ta, tb := src.GetRtable(tts[0].Name), src.GetRtable(tts[1].Name)
+
+	//rolled back changes must not show up anywhere
+	tx, err := src.Begin(true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tx.InsertData(ta, dbops.Conf_abort, []any{1, 2})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tx.InsertMemData(tb, dbops.Conf_abort, []any{1})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	data, err := tx.GetData(ta, 0, -1, []dbops.Condition{}, []dbops.Order{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(data) != 2 {
+		t.Fatalf("transaction does not see its own changes")
+	}
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if (ta.Count() != 0) || (tb.CountMem() != 0) {
+		t.Fatalf("rolled back rows are present")
+	}
+
+	//committed changes must show up on both tables, disk and memory
+	tx, err = src.Begin(true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tx.InsertData(ta, dbops.Conf_abort, []any{1, 2})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tx.InsertData(tb, dbops.Conf_abort, []any{1})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tx.InsertMemData(ta, dbops.Conf_abort, []any{1, 2})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tx.DeleteData(ta, []dbops.Condition{{Cname: "a a", Op: dbops.Op_eq, Val: 2}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	err = checkData(ta, "a a", [][]any{{int64(1)}}, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = checkData(tb, "a a", [][]any{{int64(1)}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	mdata, err := ta.GetMemData(0, -1, []dbops.Condition{}, []dbops.Order{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if (len(mdata) != 1) || (mdata[0][0] != int64(1)) {
+		t.Fatalf("unexpected in-memory data %v", mdata)
+	}
+
+	//a finished transaction cannot be reused
+	err = tx.InsertData(tb, dbops.Conf_abort, []any{2})
+	if err != dbops.ErrTxDone {
+		t.Fatalf("expected ErrTxDone, got %v", err)
+	}
+
+	//read-through mode sees rows committed on disk by a transaction
+	err = src.EnableReadThrough(0)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	data, err = tb.GetCachedData(0, -1, []dbops.Condition{}, []dbops.Order{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tx, err = src.Begin(false)
+	if err == nil {
+		err = tx.InsertData(tb, dbops.Conf_abort, []any{2})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	data, err = tb.GetCachedData(0, -1, []dbops.Condition{}, []dbops.Order{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(data) != 2 {
+		t.Fatalf("a query cached before a transaction misses the rows it committed, got %v", data)
+	}
+
+	//write-back mode refuses transactions
+	err = src.EnableWriteBack(0, nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, err = src.Begin(false)
+	if err != dbops.ErrTxWriteBack {
+		t.Fatalf("expected ErrTxWriteBack, got %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+package dbops
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// -------------------- UPSERT --------------------
+
+/*
+how to resolve an insert which conflicts with an existing row, by updating that row instead (INSERT ... ON CONFLICT DO UPDATE)
+  - rows which are "deleted" (see DeleteData) are left alone, the conflicting insert is skipped
+*/
+type Upsert struct {
+	Constraint string //name of the unique index whose columns are the conflict target ("" -> the primary key)
+
+	Cols []UpsCol //columns to update on conflict (nil -> all inserted columns outside the conflict target, taking the new value; empty -> none, the insert is skipped)
+}
+
+// a column updated by an Upsert
+type UpsCol struct {
+	Name  string          //column name
+	Merge merge_behaviour //how to merge the old and new value ("" -> Merge_set)
+}
+
+type merge_behaviour string //constants begin with "Merge_"; sql expressions in which "{old}" stands for the existing value and "{new}" for the inserted one
+const (
+	Merge_set      merge_behaviour = "{new}"                  //take the new value
+	Merge_coalesce merge_behaviour = "COALESCE({new}, {old})" //take the new value, unless it is NULL
+	Merge_max      merge_behaviour = "MAX({old}, {new})"      //keep the greater value (NULL if either is NULL)
+	Merge_min      merge_behaviour = "MIN({old}, {new})"      //keep the lesser value (NULL if either is NULL)
+	Merge_add      merge_behaviour = "{old} + {new}"          //add the new value to the old one (NULL if either is NULL)
+)
+
+// without locking, tries to return the columns of the unique index named <name> of <rt> on <db>, none -> ErrIsNotPresent
+func (rt *Rtable) uniqueCols(ctx context.Context, db sqlx.QueryerContext, name string) (cnames []string, err error) {
+	var unique bool
+	err = sqlx.GetContext(ctx, db, &unique, "SELECT \"unique\" FROM pragma_index_list(?) WHERE \"name\" = ?;", rt.name, name)
+	if err != nil {
+		return nil, ErrIsNotPresent
+	}
+	if !unique {
+		return nil, ErrBadData
+	}
+
+	err = sqlx.SelectContext(ctx, db, &cnames, "SELECT \"name\" FROM pragma_index_info(?) ORDER BY \"seqno\";", name)
+	if err != nil {
+		return nil, err
+	}
+	return cnames, nil
+}
+
+/*
+without locking, tries to return an upsert clause (" ON CONFLICT ...") for inserting <cols> into <rt>, as specified by <u>
+  - <db> is only used to look up u.Constraint
+*/
+func (rt *Rtable) upsClause(ctx context.Context, db sqlx.QueryerContext, u Upsert, cols []rcol) (clause string, err error) {
+	var target []string
+	if u.Constraint == "" {
+		for _, c := range rt.cols {
+			if c.pk {
+				target = append(target, c.name)
+			}
+		}
+		if len(target) == 0 {
+			return "", ErrBadData
+		}
+	} else {
+		target, err = rt.uniqueCols(ctx, db, u.Constraint)
+		if err != nil {
+			return "", err
+		}
+	}
+	targetset := make(stringset, len(target))
+	for _, cname := range target {
+		targetset[cname] = empty{}
+	}
+
+	inserted := make(stringset, len(cols))
+	for _, c := range cols {
+		if c.name != orgDdCol.name {
+			inserted[c.name] = empty{}
+		}
+	}
+
+	upcols := u.Cols
+	if upcols == nil {
+		for _, c := range cols {
+			if inserted.has(c.name) && !targetset.has(c.name) {
+				upcols = append(upcols, UpsCol{Name: c.name})
+			}
+		}
+	}
+
+	quotedTarget := make([]string, len(target))
+	for i, cname := range target {
+		quotedTarget[i] = "\"" + cname + "\""
+	}
+	clause = " ON CONFLICT(" + strings.Join(quotedTarget, ", ") + ")"
+
+	if len(upcols) == 0 {
+		return clause + " DO NOTHING", nil
+	}
+
+	upset := make(stringset, len(upcols))
+	setdefs := make([]string, len(upcols))
+	for i, uc := range upcols {
+		if !inserted.has(uc.Name) {
+			return "", ErrIsNotPresent
+		}
+		if targetset.has(uc.Name) || upset.has(uc.Name) {
+			return "", ErrBadData
+		}
+		upset[uc.Name] = empty{}
+
+		merge := uc.Merge
+		if merge == "" {
+			merge = Merge_set
+		}
+		expr := strings.NewReplacer("{old}", "\""+rt.name+"\".\""+uc.Name+"\"", "{new}", "excluded.\""+uc.Name+"\"").Replace(string(merge))
+		setdefs[i] = "\"" + uc.Name + "\" = " + expr
+	}
+
+	clause += " DO UPDATE SET " + strings.Join(setdefs, ", ")
+	if rt.dd {
+		clause += " WHERE \"" + rt.name + "\".\"" + orgDdCol.name + "\" = 0"
+	} //do not update "deleted" rows
+	return clause, nil
+}
+
+// without locking, does what insert does, but resolves conflicts as specified by <u>
+func (rt *Rtable) upsert(ctx context.Context, db sqlx.ExtContext, u Upsert, cols []rcol, data []any) (err error) {
+	clause, err := rt.upsClause(ctx, db, u, cols)
+	if err != nil {
+		return err
+	}
+
+	return rt.insertRows(ctx, db, "INSERT", clause, cols, data, nil)
+}
+
+/*
+tries to interpret <data> as {x} rows of all columns of <rt>, then insert it into <rt> (on-disk), updating conflicting rows as specified by <u>
+  - e.g. Upsert{Cols: []UpsCol{{Name: "count", Merge: Merge_add}}} adds the inserted "count" to the existing one
+*/
+func (rt *Rtable) UpsertData(u Upsert, data []any) (err error) {
+	return rt.UpsertDataContext(context.Background(), u, data)
+}
+
+// same as UpsertData, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) UpsertDataContext(ctx context.Context, u Upsert, data []any) (err error) {
+	if !rt.valid() {
+		return ErrInvalidTable
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, true, false)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.unlock(true, false)
+
+	return rt.upsert(ctx, rt.parent.db, u, rt.cols[rt.ddint:], data)
+}
+
+// same as UpsertData, but for <rt>'s in-memory version
+func (rt *Rtable) UpsertMemData(u Upsert, data []any) (err error) {
+	return rt.UpsertMemDataContext(context.Background(), u, data)
+}
+
+// same as UpsertMemData, but gives up once <ctx> is done (-> ctx.Err())
+func (rt *Rtable) UpsertMemDataContext(ctx context.Context, u Upsert, data []any) (err error) {
+	if !rt.valid() {
+		return ErrInvalidTable
+	}
+	if rt.parent.mem == nil {
+		return ErrNoMem
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rt.parent.lock(ctx, false, true)
+	if err != nil {
+		return err
+	}
+	defer rt.parent.unlock(false, true)
+
+	return rt.upsert(ctx, rt.parent.mem, u, rt.cols[rt.ddint:], data)
+}
+
+/*
+tries to insert all rows of <src>'s in-memory database into disk, like SaveMem
+  - tables named in <ups> update conflicting rows as specified by their Upsert (the dd column is never updated), all others insert (or <cbh>)
+  - rows are inserted in one transaction, which fails (-> ErrForeignKey) if a row on disk references a row which does not exist afterwards
+*/
+func (src *DataSrc) SaveMemUpsert(ups map[string]Upsert, cbh conflict_behaviour) (err error) {
+	return src.SaveMemUpsertContext(context.Background(), ups, cbh)
+}
+
+// same as SaveMemUpsert, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) SaveMemUpsertContext(ctx context.Context, ups map[string]Upsert, cbh conflict_behaviour) (err error) {
+	if src == nil {
+		return ErrNilSource
+	}
+	if src.mem == nil {
+		return ErrNoMem
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = src.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer src.unlock(true, true)
+
+	names := make(stringset, len(src.rtables))
+	for _, t := range src.rtables {
+		names[t.name] = empty{}
+	}
+	for name := range ups {
+		if !names.has(name) {
+			return ErrIsNotPresent
+		}
+	}
+
+	statements := make([]string, len(src.rtables))
+	for i, t := range src.rtables {
+		statements[i] = "INSERT OR " + string(cbh) + " INTO \"disk\".\"" + t.name + "\" SELECT * FROM \"main\".\"" + t.name + "\";"
+
+		u, ok := ups[t.name]
+		if !ok {
+			continue
+		}
+
+		clause, err := t.upsClause(ctx, src.db, u, t.cols)
+		if err != nil {
+			return err
+		}
+		statements[i] = "INSERT INTO \"disk\".\"" + t.name + "\" SELECT * FROM \"main\".\"" + t.name + "\" WHERE true" + clause + ";" //"WHERE true" keeps ON CONFLICT from being parsed as a join constraint
+	}
+
+	err = src.memFks(ctx, false) //replacing a row would delete the rows referencing it, and memory may not hold the rows referenced
+	if err != nil {
+		return err
+	}
+	defer src.memFks(context.Background(), true)
+
+	return src.attached(ctx, func(tx *sqlx.Tx) error {
+		for _, statement := range statements {
+			_, err := tx.ExecContext(ctx, statement)
+			if err != nil {
+				return err
+			}
+		}
+
+		names := make([]string, len(src.rtables))
+		for i, t := range src.rtables {
+			names[i] = t.name
+		}
+		return fkCheck(ctx, tx, "disk", names)
+	})
+}
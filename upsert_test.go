@@ -0,0 +1,100 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that upserts update only the chosen columns, with the chosen merges, on disk, memory and when saving memory
+func TestUpsert(t *testing.T) {
+
+	//init
+	var tts = []dbops.Table{{Name: "ups", Dd: true, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true},
+		{Name: "code", Ext: "TEXT UNIQUE", Pk: false},
+		{Name: "n", Ext: "INTEGER", Pk: false},
+		{Name: "hi", Ext: "INTEGER", Pk: false},
+		{Name: "note", Ext: "TEXT", Pk: false}}}}
+
+	src, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "ups.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+
+	tbl := src.GetRtable(tts[0].Name)
+	err = tbl.InsertData(dbops.Conf_abort, []any{1, "a", 1, 5, "old", 2, "b", 1, 5, "old"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//on the primary key, add n, keep the max of hi, leave note alone
+	u := dbops.Upsert{Cols: []dbops.UpsCol{{Name: "n", Merge: dbops.Merge_add}, {Name: "hi", Merge: dbops.Merge_max}}}
+	err = tbl.UpsertData(u, []any{1, "a", 2, 3, "new", 3, "c", 1, 1, "new"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = checkData(tbl, "id", [][]any{{int64(1), "a", int64(3), int64(5), "old"}, {int64(2), "b", int64(1), int64(5), "old"}, {int64(3), "c", int64(1), int64(1), "new"}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//on a unique index, with all other columns taking the new value
+	err = tbl.UpsertData(dbops.Upsert{Constraint: "sqlite_autoindex_ups_1", Cols: []dbops.UpsCol{{Name: "n"}, {Name: "hi"}, {Name: "note"}}}, []any{2, "b", 9, 9, "new"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = checkData(tbl, "id", [][]any{{int64(1), "a", int64(3), int64(5), "old"}, {int64(2), "b", int64(9), int64(9), "new"}, {int64(3), "c", int64(1), int64(1), "new"}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//"deleted" rows are not updated
+	err = tbl.DeleteData([]dbops.Condition{{Cname: "id", Op: dbops.Op_eq, Val: 3}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.UpsertData(dbops.Upsert{}, []any{3, "c", 7, 7, "newer"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.UndoDelete(1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = checkData(tbl, "id", [][]any{{int64(1), "a", int64(3), int64(5), "old"}, {int64(2), "b", int64(9), int64(9), "new"}, {int64(3), "c", int64(1), int64(1), "new"}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//memory, then saving it with an upsert
+	err = src.CreateMem()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.UpsertMemData(dbops.Upsert{Cols: []dbops.UpsCol{{Name: "n"}}}, []any{1, "a", 100, 0, "mem", 1, "a", 1, 0, "mem"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = src.SaveMemUpsert(map[string]dbops.Upsert{tts[0].Name: {Cols: []dbops.UpsCol{{Name: "n", Merge: dbops.Merge_add}}}}, dbops.Conf_abort)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = checkData(tbl, "id", [][]any{{int64(1), "a", int64(4), int64(5), "old"}, {int64(2), "b", int64(9), int64(9), "new"}, {int64(3), "c", int64(1), int64(1), "new"}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//bad upserts are rejected
+	for _, u := range []dbops.Upsert{{Cols: []dbops.UpsCol{{Name: "id"}}}, {Cols: []dbops.UpsCol{{Name: "nope"}}}, {Cols: []dbops.UpsCol{{Name: "n"}, {Name: "n"}}}} {
+		err = tbl.UpsertData(u, []any{1, "a", 1, 1, ""})
+		if (err != dbops.ErrBadData) && (err != dbops.ErrIsNotPresent) {
+			t.Fatalf("expected the upsert to be rejected, got %v", err)
+		}
+	}
+	err = tbl.UpsertData(dbops.Upsert{Constraint: "nope"}, []any{1, "a", 1, 1, ""})
+	if err != dbops.ErrIsNotPresent {
+		t.Fatalf("expected ErrIsNotPresent, got %v", err)
+	}
+}
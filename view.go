@@ -0,0 +1,435 @@
+package dbops
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrViewDepends error = errors.New("ErrViewDepends (dbops) - The operation would break a view depending on what it changes, delete (or change) the view first")
+
+// -------------------- VIEWS --------------------
+
+// a view of a DataSrc, a stored query which can be read like a table (kept on disk and in memory)
+type View struct {
+	Name   string   //Name (must differ from the names of all tables and views, must not begin with "sqlite_")
+	Select string   //the query, a SELECT statement (without ";"); build it with Rtable.SelectView, Rtable.AggregateView or JoinQuery.SelectView
+	Cols   []string //names of the columns of the view, in order (ignored by AddView)
+}
+
+type Rview struct {
+	name   string
+	query  string
+	cols   []string //nil if it cannot be read
+	parent *DataSrc
+}
+
+func (rv *Rview) valid() bool {
+	return (rv != nil) && (rv.parent != nil)
+}
+
+func (rv *Rview) ToView() View {
+	if !rv.valid() {
+		return View{}
+	}
+	return View{Name: rv.name, Select: rv.query, Cols: append([]string(nil), rv.cols...)}
+}
+
+// returns whether the query of <rv> names <name> (in quotes or not), e.g. as the table or view it reads, or one of its columns
+func (rv *Rview) mentions(name string) bool {
+	toks, _ := sqlTokens(rv.query)
+	for _, tok := range toks {
+		if (isWord(tok.text) || strings.ContainsRune("\"`[", rune(tok.text[0]))) && strings.EqualFold(unquoteName(tok.text), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the views of <src> reading the table or view named <name>, directly or through other views
+func (src *DataSrc) dependentViews(name string) []*Rview {
+	return dependentViews(src.rviews, name)
+}
+
+// returns the views of <rviews> reading the table or view named <name>, directly or through other views of <rviews>
+func dependentViews(rviews []*Rview, name string) (views []*Rview) {
+	names := stringset{strings.ToLower(name): empty{}}
+	for found := true; found; {
+		found = false
+		for _, rv := range rviews {
+			if names.has(strings.ToLower(rv.name)) {
+				continue
+			}
+			for n := range names {
+				if rv.mentions(n) {
+					names[strings.ToLower(rv.name)] = empty{}
+					views = append(views, rv)
+					found = true
+					break
+				}
+			}
+		}
+	}
+	return views
+}
+
+// returns whether none of <views> (the views reading <rt>) names a column of <rt> which is not copied under the same name by <remap> (as in Rtable.Edit)
+func (rt *Rtable) viewsKept(views []*Rview, remap map[string]string) bool {
+	for _, c := range rt.cols[rt.ddint:] {
+		if (remap[c.name] != c.name) && slices.ContainsFunc(views, func(rv *Rview) bool { return rv.mentions(c.name) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// without locking, tries to return the views of the database <db> (the main schema of a database of <src>), in the order they were created
+func (src *DataSrc) readViews(db sqlx.Queryer) (views []*Rview, err error) {
+	type master struct {
+		Name      string `db:"name"`
+		Statement string `db:"sql"`
+	}
+	var view_list []master
+	err = sqlx.Select(db, &view_list, "SELECT name, sql FROM \"main\".sqlite_master WHERE type = 'view' ORDER BY rowid;")
+	if err != nil {
+		return views, err
+	}
+
+	for _, mview := range view_list {
+		rv := &Rview{name: mview.Name, query: viewQuery(mview.Statement), parent: src}
+		rv.cols, _ = viewCols(db, rv.name) //a view can be broken by changes made to what it reads, it is still a view
+		views = append(views, rv)
+	}
+	return views, nil
+}
+
+// returns the SELECT statement of <statement> (a CREATE VIEW statement), after the name of the view and its optional list of columns (which may hold "AS" too)
+func viewQuery(statement string) string {
+	toks, _ := sqlTokens(statement)
+	i := slices.IndexFunc(toks, func(tok sqlToken) bool { return strings.EqualFold(tok.text, "VIEW") })
+	if i == -1 {
+		return ""
+	}
+	i++
+	if (i+2 < len(toks)) && strings.EqualFold(toks[i].text, "IF") && strings.EqualFold(toks[i+1].text, "NOT") && strings.EqualFold(toks[i+2].text, "EXISTS") {
+		i += 3
+	}
+	i++ //past the name
+
+	if (i < len(toks)) && (toks[i].text == ".") { //that was the name of the schema
+		i += 2
+	}
+	if (i < len(toks)) && (toks[i].text == "(") {
+		i = closingBracket(toks, i)
+		if i == -1 {
+			return ""
+		}
+		i++
+	}
+
+	if (i < len(toks)) && strings.EqualFold(toks[i].text, "AS") {
+		return strings.TrimSpace(statement[toks[i].end:])
+	}
+	return ""
+}
+
+// tries to return the names of the columns of the view named <name> on <db>
+func viewCols(db sqlx.Queryer, name string) (cols []string, err error) {
+	rows, err := db.Queryx("SELECT * FROM \"main\".\"" + name + "\" LIMIT 0;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return rows.Columns()
+}
+
+/*
+tries to create <v> in <src> (both disk and memory)
+  - a table or view of the same name -> ErrIsDuplicate, an empty Name or Select (or a Select which is not one statement) -> ErrBadData
+  - a Select which cannot be read (e.g. of a missing table) -> its error, nothing is created
+*/
+func (src *DataSrc) AddView(v View) (err error) {
+	return src.AddViewContext(context.Background(), v)
+}
+
+// same as AddView, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) AddViewContext(ctx context.Context, v View) (err error) {
+	if src == nil {
+		return ErrNilSource
+	}
+	if (v.Name == "") || strings.HasPrefix(strings.ToLower(v.Name), "sqlite_") || !oneExpr(v.Select) {
+		return ErrBadData
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := src.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer src.unlock(true, memheld)
+
+	for _, rt := range src.rtables {
+		if strings.EqualFold(rt.name, v.Name) {
+			return ErrIsDuplicate
+		}
+	}
+	for _, rv := range src.rviews {
+		if strings.EqualFold(rv.name, v.Name) {
+			return ErrIsDuplicate
+		}
+	}
+
+	new_rv := &Rview{name: v.Name, query: strings.TrimSpace(v.Select), parent: src}
+	statement := "CREATE VIEW \"" + new_rv.name + "\" AS " + new_rv.query + ";"
+
+	err = inTx(ctx, src.db, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, statement)
+		if err != nil {
+			return err
+		}
+
+		new_rv.cols, err = viewCols(tx, new_rv.name) //sqlite only checks a view once it is read
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if src.mem != nil { //after disk, so a failure on either leaves neither with the view
+		_, err = src.mem.ExecContext(ctx, statement)
+		if err != nil {
+			src.db.ExecContext(context.Background(), "DROP VIEW IF EXISTS \"main\".\""+new_rv.name+"\";")
+			return err
+		}
+	}
+
+	src.rviews = append(src.rviews, new_rv)
+	return nil
+}
+
+/*
+tries to delete <rv> in <src> (both disk and memory)
+  - other views reading <rv> -> ErrViewDepends
+*/
+func (src *DataSrc) DelView(rv *Rview) (err error) {
+	return src.DelViewContext(context.Background(), rv)
+}
+
+// same as DelView, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) DelViewContext(ctx context.Context, rv *Rview) (err error) {
+	if src == nil {
+		return ErrNilSource
+	}
+	if !rv.valid() {
+		return ErrInvalidTable
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := src.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer src.unlock(true, memheld)
+
+	vidx := -1
+	for i, srcv := range src.rviews {
+		if rv == srcv {
+			vidx = i
+			break
+		}
+	}
+	if vidx == -1 {
+		return ErrIsNotPresent
+	}
+	if len(src.dependentViews(rv.name)) != 0 {
+		return ErrViewDepends
+	}
+
+	_, err = src.db.ExecContext(ctx, "DROP VIEW IF EXISTS \"main\".\""+rv.name+"\";")
+	if err != nil {
+		return err
+	}
+
+	if src.mem != nil { //after disk, so a failure on either leaves both with the view
+		_, err = src.mem.ExecContext(ctx, "DROP VIEW IF EXISTS \"main\".\""+rv.name+"\";")
+		if err != nil {
+			src.db.ExecContext(context.Background(), "CREATE VIEW \""+rv.name+"\" AS "+rv.query+";")
+			return err
+		}
+	}
+
+	src.rviews = append(src.rviews[:vidx], src.rviews[vidx+1:]...)
+	return nil
+}
+
+// returns all views of src, in the order they were created
+func (src *DataSrc) GetViews() []View {
+	if src == nil {
+		return []View{}
+	}
+
+	<-src.dlock
+	defer func() { src.dlock <- true }()
+
+	views := make([]View, len(src.rviews))
+	for i, rv := range src.rviews {
+		views[i] = rv.ToView()
+	}
+	return views
+}
+
+// returns a handle to the view <viewname>, whose case does not matter (as to SQLite) (not found -> nil)
+func (src *DataSrc) GetRview(viewname string) *Rview {
+	if src == nil {
+		return nil
+	}
+
+	<-src.dlock
+	defer func() { src.dlock <- true }()
+
+	for _, rv := range src.rviews {
+		if strings.EqualFold(viewname, rv.name) {
+			return rv
+		}
+	}
+	return nil
+}
+
+/*
+tries to return a slice of slices, which represent rows of <rv> (on-disk)
+  - negative <index> indexes from the end of <rv>, instead of the beginning (-1 -> last item)
+  - negative <count> means how many rows of <rv> to leave out of the selection (-1 -> leave out 0 rows)
+  - <condarr> specifies conditions which must be true for a row to be retrieved
+  - <ordarr> specifies the order of retrieval
+*/
+func (rv *Rview) GetData(index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	return rv.GetDataContext(context.Background(), index, count, condarr, ordarr)
+}
+
+// same as GetData, but gives up once <ctx> is done (-> ctx.Err())
+func (rv *Rview) GetDataContext(ctx context.Context, index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	if !rv.valid() {
+		return [][]any{}, ErrInvalidTable
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rv.parent.lock(ctx, true, false)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer rv.parent.unlock(true, false)
+
+	return rv.get(ctx, rv.parent.db, index, count, condarr, ordarr)
+}
+
+// same as GetData, but reads <rv> from the in-memory database (so only the rows loaded into memory are seen)
+func (rv *Rview) GetMemData(index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	return rv.GetMemDataContext(context.Background(), index, count, condarr, ordarr)
+}
+
+// same as GetMemData, but gives up once <ctx> is done (-> ctx.Err())
+func (rv *Rview) GetMemDataContext(ctx context.Context, index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	if !rv.valid() {
+		return [][]any{}, ErrInvalidTable
+	}
+	if rv.parent.mem == nil {
+		return [][]any{}, ErrNoMem
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	_, err = rv.parent.lock(ctx, false, true)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer rv.parent.unlock(false, true)
+
+	return rv.get(ctx, rv.parent.mem, index, count, condarr, ordarr)
+}
+
+// without locking, tries to return rows of <rv> on <db> as selected by GetData
+func (rv *Rview) get(ctx context.Context, db sqlx.QueryerContext, index int, count int, condarr []Condition, ordarr []Order) (data [][]any, err error) {
+	where, subs, err := clausify_condition_array(condarr)
+	if err != nil {
+		return [][]any{}, err
+	}
+
+	from := "\"main\".\"" + rv.name + "\"" + where
+	limit, offset, err := window(ctx, db, from, subs, index, count)
+	if err != nil {
+		return [][]any{}, err
+	}
+	statement := "SELECT * FROM " + from + clausify_order_array(ordarr) + " LIMIT " + strconv.Itoa(limit) + " OFFSET " + strconv.Itoa(offset) + ";"
+
+	rows, err := db.QueryxContext(ctx, statement, subs...)
+	if err != nil {
+		return [][]any{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row_vals, err := rows.SliceScan()
+		if err != nil {
+			return data, err
+		}
+		data = append(data, row_vals)
+	}
+	return data, rows.Err()
+}
+
+/*
+tries to return a query for View.Select, of the rows of <rt> for which <condarr> is true (never "deleted" rows), made of the columns of <sel> (see GetSelected)
+  - values of <condarr> are written into it, as a view cannot have parameters (see IndexWhere)
+  - tables are named without their schema, as a view can only read its own
+*/
+func (rt *Rtable) SelectView(sel Selection, condarr []Condition) (string, error) {
+	if !rt.valid() {
+		return "", ErrInvalidTable
+	}
+
+	selcols, err := rt.selCols(sel)
+	if err != nil {
+		return "", err
+	}
+	if rt.dd {
+		condarr = append(condarr[:len(condarr):len(condarr)], orgDdColIs0)
+	} //do not include "deleted" rows
+	where, subs, err := clausify_condition_array(condarr)
+	if err != nil {
+		return "", err
+	}
+	return inline("SELECT "+selcols+" FROM \""+rt.name+"\""+where, subs)
+}
+
+// tries to return a query for View.Select, of the groups of rows of <rt> as returned by Aggregate (values are written into it, as in SelectView)
+func (rt *Rtable) AggregateView(aggs []Aggregate, groupBy []string, condarr []Condition, having []Condition) (string, error) {
+	if !rt.valid() {
+		return "", ErrInvalidTable
+	}
+
+	statement, subs, err := rt.aggStatement(false, aggs, groupBy, condarr, having, nil)
+	if err != nil {
+		return "", err
+	}
+	return inline(strings.TrimSuffix(statement, ";"), subs)
+}
+
+// tries to return a query for View.Select, of the rows of <q> for which <condarr> is true, as returned by Get (values are written into it, as in Rtable.SelectView)
+func (q *JoinQuery) SelectView(condarr []Condition) (string, error) {
+	if err := q.check(); err != nil {
+		return "", err
+	}
+
+	from, subs, err := q.from(condarr, false)
+	if err != nil {
+		return "", err
+	}
+	return inline("SELECT "+q.selCols()+" FROM "+from, subs)
+}
@@ -0,0 +1,199 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that views are made from the query API, listed apart from tables, read on disk and in memory, discovered on connecting, and kept by DelTable and Edit
+func TestViews(t *testing.T) {
+
+	//init
+	path := filepath.Join(t.TempDir(), "view.db")
+	var tts = []dbops.Table{{Name: "authors", Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true}, {Name: "name", Ext: "TEXT", Pk: false}}},
+		{Name: "books", Dd: true, Cols: []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true}, {Name: "author", Ext: "INTEGER", Pk: false}, {Name: "pages", Ext: "INTEGER", Pk: false}}}}
+
+	src, err := dbops.CreateSrc(path, tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	authors, books := src.GetRtable("authors"), src.GetRtable("books")
+
+	err = authors.InsertData(dbops.Conf_abort, []any{1, "ann", 2, "bob"})
+	if err == nil {
+		err = books.InsertData(dbops.Conf_abort, []any{1, 1, 100, 2, 1, 300, 3, 2, 50, 4, 2, 150})
+	}
+	if err == nil {
+		err = books.DeleteData([]dbops.Condition{{Cname: "id", Op: dbops.Op_eq, Val: 4}})
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	expect := func(data [][]any, err error, expected [][]any) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if !reflect.DeepEqual(data, expected) {
+			t.Fatalf("expected %v, got %v", expected, data)
+		}
+	}
+
+	//made from the query API
+	long, err := books.SelectView(dbops.Selection{Cols: []dbops.SelCol{{Cname: "id"}, {Cname: "pages"}}}, []dbops.Condition{{Cname: "pages", Op: dbops.Op_more, Val: 75}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	totals, err := books.AggregateView([]dbops.Aggregate{{Func: dbops.Agg_sum, Cname: "pages", As: "total"}}, []string{"author"}, nil, nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	named, err := authors.Join(books, dbops.Join_inner, []dbops.JoinOn{{Tname: "authors", Cname: "id", With: "author"}}).
+		Select([]dbops.JoinCol{{Tname: "books", Cname: "id"}, {Tname: "authors", Cname: "name"}}).SelectView(nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	views := []dbops.View{{Name: "long", Select: long}, {Name: "totals", Select: totals}, {Name: "named", Select: named}, {Name: "longer", Select: "SELECT \"id\" FROM \"long\" WHERE \"pages\" > 200"},
+		{Name: "as", Select: "SELECT \"name\" AS \"as\" FROM \"authors\""}}
+	for _, v := range views {
+		err = src.AddView(v)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	err = src.AddView(dbops.View{Name: "books", Select: long})
+	if err != dbops.ErrIsDuplicate {
+		t.Fatalf("expected ErrIsDuplicate for a view named as a table, got %v", err)
+	}
+	err = src.AddView(dbops.View{Name: "bad", Select: "SELECT 1; DROP TABLE books"})
+	if err != dbops.ErrBadData {
+		t.Fatalf("expected ErrBadData for two statements, got %v", err)
+	}
+	err = src.AddView(dbops.View{Name: "bad", Select: "SELECT * FROM nope"})
+	if err == nil {
+		t.Fatalf("a view of a missing table was created")
+	}
+
+	//read, "deleted" rows left out
+	data, err := src.GetRview("long").GetData(0, -1, []dbops.Condition{}, []dbops.Order{{Cname: "id", Dir: true}})
+	expect(data, err, [][]any{{int64(1), int64(100)}, {int64(2), int64(300)}})
+	data, err = src.GetRview("totals").GetData(0, -1, []dbops.Condition{{Cname: "total", Op: dbops.Op_more, Val: 100}}, []dbops.Order{})
+	expect(data, err, [][]any{{int64(1), int64(400)}})
+	data, err = src.GetRview("named").GetData(0, -1, []dbops.Condition{}, []dbops.Order{{Cname: "id", Dir: false}})
+	expect(data, err, [][]any{{int64(3), "bob"}, {int64(2), "ann"}, {int64(1), "ann"}})
+
+	//listed apart from tables, and discovered on connecting
+	err = src.Disconnect()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	src, err = dbops.ConnectSrc(path, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+	authors, books = src.GetRtable("authors"), src.GetRtable("books")
+
+	err = checkTables(src, tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	views[0].Cols, views[1].Cols, views[2].Cols, views[3].Cols, views[4].Cols = []string{"id", "pages"}, []string{"author", "total"}, []string{"id", "name"}, []string{"id"}, []string{"as"}
+	if got := src.GetViews(); !reflect.DeepEqual(got, views) {
+		t.Fatalf("expected views %v, got %v", views, got)
+	}
+
+	//in memory
+	err = src.CreateMem()
+	if err == nil {
+		err = books.LoadIntoMem(0, -1, dbops.Conf_abort, []dbops.Condition{{Cname: "author", Op: dbops.Op_eq, Val: 2}})
+	}
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	data, err = src.GetRview("totals").GetMemData(0, -1, []dbops.Condition{}, []dbops.Order{})
+	expect(data, err, [][]any{{int64(2), int64(50)}})
+
+	//tables read by views are not deleted, and views read by other views neither
+	err = src.DelTable(books)
+	if err != dbops.ErrViewDepends {
+		t.Fatalf("expected ErrViewDepends for deleting a table read by views, got %v", err)
+	}
+	err = src.DelView(src.GetRview("long"))
+	if err != dbops.ErrViewDepends {
+		t.Fatalf("expected ErrViewDepends for deleting a view read by a view, got %v", err)
+	}
+
+	//editing keeps views which still fit
+	err = books.Edit([]dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true}, {Name: "author", Ext: "INTEGER", Pk: false}, {Name: "pages", Ext: "INTEGER", Pk: false}, {Name: "year", Ext: "INTEGER", Pk: false}},
+		map[string]string{"id": "id", "author": "author", "pages": "pages"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	data, err = src.GetRview("longer").GetData(0, -1, []dbops.Condition{}, []dbops.Order{})
+	expect(data, err, [][]any{{int64(2)}})
+	err = books.Edit([]dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true}, {Name: "writer", Ext: "INTEGER", Pk: false}, {Name: "pages", Ext: "INTEGER", Pk: false}},
+		map[string]string{"id": "id", "author": "writer", "pages": "pages"})
+	if err != dbops.ErrViewDepends {
+		t.Fatalf("expected ErrViewDepends for renaming a column read by views, got %v", err)
+	}
+
+	//migrations do not break views either, and raw sql steps are seen
+	err = src.DeleteMem()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = src.Migrate([]dbops.Migration{{Version: 1, Steps: []dbops.MigStep{dbops.StepDelTable("books")}}}, true)
+	if err != dbops.ErrViewDepends {
+		t.Fatalf("expected ErrViewDepends for migrating away a table read by views, got %v", err)
+	}
+	err = src.Migrate([]dbops.Migration{{Version: 1, Steps: []dbops.MigStep{dbops.StepEdit("books", []dbops.Col{{Name: "id", Ext: "INTEGER", Pk: true},
+		{Name: "writer", Ext: "INTEGER", Pk: false}, {Name: "pages", Ext: "INTEGER", Pk: false}}, map[string]string{"id": "id", "author": "writer", "pages": "pages"})}}}, true)
+	if err != dbops.ErrViewDepends {
+		t.Fatalf("expected ErrViewDepends for migrating away a column read by views, got %v", err)
+	}
+
+	longer, longv := src.GetRview("longer"), src.GetRview("long")
+	err = src.Migrate([]dbops.Migration{{Version: 1, Steps: []dbops.MigStep{dbops.StepSQL("DROP VIEW \"longer\";"),
+		dbops.StepSQL("CREATE VIEW \"short\" AS SELECT \"id\" FROM \"books\" WHERE \"pages\" < 75;")}}}, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if longer.ToView().Name != "" || src.GetRview("longer") != nil {
+		t.Fatalf("a view dropped by a migration was kept")
+	}
+	if src.GetRview("LONG") != longv {
+		t.Fatalf("the handle of a view kept by a migration was replaced (or its name is matched with case)")
+	}
+	data, err = src.GetRview("short").GetData(0, -1, []dbops.Condition{}, []dbops.Order{})
+	expect(data, err, [][]any{{int64(3)}})
+
+	//the query of a view is found after its name and columns, even if they hold "AS"
+	err = src.Migrate([]dbops.Migration{{Version: 2, Steps: []dbops.MigStep{dbops.StepSQL("CREATE VIEW IF NOT EXISTS main.[AS view] (\"as\", [x as]) AS SELECT \"id\", \"name\" FROM \"authors\";")}}}, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if got := src.GetRview("as VIEW").ToView(); !reflect.DeepEqual(got, dbops.View{Name: "AS view", Select: "SELECT \"id\", \"name\" FROM \"authors\"", Cols: []string{"as", "x as"}}) {
+		t.Fatalf("read a view with a list of columns as %v", got)
+	}
+
+	//once the views are gone, so can the table be
+	for _, name := range []string{"short", "long", "totals", "named", "as", "as view"} {
+		err = src.DelView(src.GetRview(name))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	err = src.DelTable(books)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(src.GetViews()) != 0 {
+		t.Fatalf("views were left after deleting them")
+	}
+}
@@ -0,0 +1,369 @@
+package dbops
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrNoWriteBack error = errors.New("ErrNoWriteBack (dbops) - cannot flush changes without write-back mode enabled")
+
+// -------------------- WRITE-BACK MODE --------------------
+
+/*
+In write-back mode, changes made to the in-memory database (inserts, updates and deletes, by any method or raw sql) are tracked per row (by primary key),
+and only those are written to disk by DataSrc.Flush, or periodically by a timer.
+  - rows loaded by LoadIntoMem or removed by UnloadFromMem are not changes (UnloadFromMem flushes the table first, so no changes are lost)
+  - every table needs a primary key
+  - tracking lives in temporary tables/triggers of the in-memory database, so it never shows up among its tables
+*/
+
+// state of write-back mode of a DataSrc
+type writeBack struct {
+	cancel context.CancelFunc //stops the timer
+	done   chan struct{}      //closed once the timer has stopped
+}
+
+// name of the temporary table holding whether tracking is paused
+const wbPauseTable = "dbops_wb"
+
+// name of the column holding whether a tracked row was deleted, next to the primary key columns in the table tracking changes (so named unlike any of them)
+const wbDeletedCol = "dbops_wb_deleted"
+
+// returns the name of the temporary table tracking changes of <rt>
+func (rt *Rtable) wbTable() string {
+	return "dbops_wb_" + rt.name
+}
+
+// returns the quoted names of <rt>'s primary key columns, prefixed with <prefix> (e.g. "NEW.")
+func (rt *Rtable) pkList(prefix string) []string {
+	var pks []string
+	for _, c := range rt.cols {
+		if c.pk {
+			pks = append(pks, prefix+"\""+c.name+"\"")
+		}
+	}
+	return pks
+}
+
+// without locking, tries to start tracking changes of <rt> on <db> (the in-memory database)
+func (rt *Rtable) wbInstall(ctx context.Context, db sqlx.ExecerContext) error {
+	pks := rt.pkList("")
+	if len(pks) == 0 {
+		return ErrBadData
+	}
+	pklist := strings.Join(pks, ", ")
+	chg := "\"" + rt.wbTable() + "\""
+	record := func(row string, deleted string) string {
+		return "INSERT INTO " + chg + " (" + pklist + ", \"" + wbDeletedCol + "\") VALUES (" + strings.Join(rt.pkList(row+"."), ", ") + ", " + deleted + ") ON CONFLICT(" + pklist + ") DO UPDATE SET \"" + wbDeletedCol + "\" = excluded.\"" + wbDeletedCol + "\";"
+	} //an upsert, as "OR REPLACE" would be overridden by the triggering statement's conflict clause
+	trigger := func(suffix string, event string, body string) string {
+		return "CREATE TEMP TRIGGER \"" + rt.wbTable() + "_" + suffix + "\" AFTER " + event + " ON \"main\".\"" + rt.name + "\" WHEN (SELECT \"paused\" FROM \"" + wbPauseTable + "\") = 0 BEGIN " + body + " END;"
+	}
+
+	statements := []string{"CREATE TEMP TABLE " + chg + " (" + pklist + ", \"" + wbDeletedCol + "\" INTEGER NOT NULL, PRIMARY KEY(" + pklist + "));",
+		trigger("ins", "INSERT", record("NEW", "0")),
+		trigger("upd", "UPDATE", record("OLD", "1")+" "+record("NEW", "0")), //if the primary key changed, the old row is gone
+		trigger("del", "DELETE", record("OLD", "1"))}
+
+	for _, statement := range statements {
+		_, err := db.ExecContext(ctx, statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// without locking, tries to stop tracking changes of <rt> on <db> (the in-memory database), forgetting unflushed ones
+func (rt *Rtable) wbUninstall(ctx context.Context, db sqlx.ExecerContext) error {
+	for _, suffix := range []string{"ins", "upd", "del"} {
+		_, err := db.ExecContext(ctx, "DROP TRIGGER IF EXISTS \"temp\".\""+rt.wbTable()+"_"+suffix+"\";")
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS \"temp\".\""+rt.wbTable()+"\";")
+	return err
+}
+
+// without locking, tries to pause (or resume) tracking changes on <src>'s in-memory database, does nothing if not in write-back mode
+func (src *DataSrc) wbPause(ctx context.Context, paused bool) error {
+	if src.wb == nil {
+		return nil
+	}
+
+	_, err := src.mem.ExecContext(ctx, "UPDATE \"temp\".\""+wbPauseTable+"\" SET \"paused\" = ?;", paused)
+	return err
+}
+
+/*
+without locking, tries to write the tracked changes of <rts> from <src>'s in-memory database to disk (in one transaction), then forget them
+  - foreign keys are checked once all are written, changed rows are updated in place (replacing them would delete the rows referencing them)
+*/
+func (src *DataSrc) wbFlush(ctx context.Context, rts []*Rtable) error {
+	_, err := src.mem.ExecContext(ctx, "ATTACH DATABASE \""+src.path+"\" AS \"disk\";")
+	if err != nil {
+		return err
+	}
+	defer src.mem.Exec("DETACH DATABASE \"disk\";")
+
+	return inTx(ctx, src.mem, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "PRAGMA defer_foreign_keys = ON;") //until the end of the transaction
+		if err != nil {
+			return err
+		}
+
+		for _, rt := range rts {
+			pklist := "(" + strings.Join(rt.pkList(""), ", ") + ")"
+			changed := "SELECT " + pklist[1:len(pklist)-1] + " FROM \"temp\".\"" + rt.wbTable() + "\" WHERE \"" + wbDeletedCol + "\" = "
+
+			var sets []string
+			for _, c := range rt.cols {
+				if !c.pk {
+					sets = append(sets, "\""+c.name+"\" = excluded.\""+c.name+"\"")
+				}
+			}
+			upsert := " DO NOTHING"
+			if len(sets) != 0 {
+				upsert = " DO UPDATE SET " + strings.Join(sets, ", ")
+			}
+
+			statements := []string{"DELETE FROM \"disk\".\"" + rt.name + "\" WHERE " + pklist + " IN (" + changed + "1);",
+				"INSERT INTO \"disk\".\"" + rt.name + "\" SELECT * FROM \"main\".\"" + rt.name + "\" WHERE " + pklist + " IN (" + changed + "0) ON CONFLICT" + pklist + upsert + ";",
+				"DELETE FROM \"temp\".\"" + rt.wbTable() + "\";"}
+
+			for _, statement := range statements {
+				_, err := tx.ExecContext(ctx, statement)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+/*
+tries to enable write-back mode on <src> (see above), changes made before are not tracked
+  - if <interval> is positive, changes are also flushed every <interval>, errors doing so are passed to <onErr> (if not nil)
+  - already enabled -> ErrIsDuplicate, a table without a primary key -> ErrBadData
+*/
+func (src *DataSrc) EnableWriteBack(interval time.Duration, onErr func(error)) (err error) {
+	return src.EnableWriteBackContext(context.Background(), interval, onErr)
+}
+
+// same as EnableWriteBack, but gives up once <ctx> is done (-> ctx.Err()), <ctx> does not affect the timer
+func (src *DataSrc) EnableWriteBackContext(ctx context.Context, interval time.Duration, onErr func(error)) (err error) {
+	if src == nil {
+		return ErrNilSource
+	}
+	if src.mem == nil {
+		return ErrNoMem
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := src.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer src.unlock(true, memheld)
+
+	if src.wb != nil {
+		return ErrIsDuplicate
+	}
+	for _, rt := range src.rtables {
+		if len(rt.pkList("")) == 0 {
+			return ErrBadData
+		}
+	}
+
+	err = inTx(ctx, src.mem, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "CREATE TEMP TABLE \""+wbPauseTable+"\" (\"paused\" INTEGER NOT NULL);")
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO \"temp\".\""+wbPauseTable+"\" VALUES (0);")
+		if err != nil {
+			return err
+		}
+
+		for _, rt := range src.rtables {
+			err = rt.wbInstall(ctx, tx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	tctx, cancel := context.WithCancel(context.Background())
+	wb := &writeBack{cancel: cancel, done: make(chan struct{})}
+	src.wb = wb
+
+	if interval <= 0 {
+		close(wb.done)
+		return nil
+	}
+
+	go func() {
+		defer close(wb.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-tctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			err := src.flushTick(tctx, wb)
+			if (err != nil) && (tctx.Err() == nil) && (onErr != nil) {
+				onErr(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// tries to flush all changes of <src>, if it is still in the write-back mode <wb> (used by the timer)
+func (src *DataSrc) flushTick(ctx context.Context, wb *writeBack) error {
+	memheld, err := src.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer src.unlock(true, memheld)
+
+	if (src.wb != wb) || !memheld {
+		return nil
+	}
+	return src.wbFlush(ctx, src.rtables)
+}
+
+// tries to write all changes tracked in <src>'s in-memory database to disk (in one transaction), not in write-back mode -> ErrNoWriteBack
+func (src *DataSrc) Flush() (err error) {
+	return src.FlushContext(context.Background())
+}
+
+// same as Flush, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) FlushContext(ctx context.Context) (err error) {
+	if src == nil {
+		return ErrNilSource
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := src.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	defer src.unlock(true, memheld)
+
+	if src.wb == nil {
+		return ErrNoWriteBack
+	}
+	return src.wbFlush(ctx, src.rtables)
+}
+
+// tries to return the number of tracked, not yet flushed, changed rows of every table of <src> (by name), not in write-back mode -> ErrNoWriteBack
+func (src *DataSrc) PendingChanges() (map[string]int, error) {
+	return src.PendingChangesContext(context.Background())
+}
+
+// same as PendingChanges, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) PendingChangesContext(ctx context.Context) (pending map[string]int, err error) {
+	if src == nil {
+		return nil, ErrNilSource
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := src.lock(ctx, false, true)
+	if err != nil {
+		return nil, err
+	}
+	defer src.unlock(false, memheld)
+
+	if src.wb == nil {
+		return nil, ErrNoWriteBack
+	}
+
+	pending = make(map[string]int, len(src.rtables))
+	for _, rt := range src.rtables {
+		var n int
+		err = sqlx.GetContext(ctx, src.mem, &n, "SELECT COUNT(*) FROM \"temp\".\""+rt.wbTable()+"\";")
+		if err != nil {
+			return nil, err
+		}
+		pending[rt.name] = n
+	}
+	return pending, nil
+}
+
+// tries to disable write-back mode on <src> (flush -> after flushing all changes, otherwise they are forgotten), not in write-back mode -> ErrNoWriteBack
+func (src *DataSrc) DisableWriteBack(flush bool) (err error) {
+	return src.DisableWriteBackContext(context.Background(), flush)
+}
+
+// same as DisableWriteBack, but gives up once <ctx> is done (-> ctx.Err())
+func (src *DataSrc) DisableWriteBackContext(ctx context.Context, flush bool) (err error) {
+	if src == nil {
+		return ErrNilSource
+	}
+
+	defer func() { err = ctxErr(ctx, err) }()
+
+	memheld, err := src.lock(ctx, true, true)
+	if err != nil {
+		return err
+	}
+
+	wb := src.wb
+	if wb == nil {
+		src.unlock(true, memheld)
+		return ErrNoWriteBack
+	}
+
+	err = src.wbDisable(ctx, flush)
+	src.unlock(true, memheld)
+	if err != nil {
+		return err
+	}
+
+	<-wb.done //the timer may have been waiting for the locks
+	return nil
+}
+
+// without locking, tries to disable write-back mode on <src> (flush -> after flushing all changes), does not wait for the timer to stop
+func (src *DataSrc) wbDisable(ctx context.Context, flush bool) error {
+	if flush {
+		err := src.wbFlush(ctx, src.rtables)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rt := range src.rtables {
+		err := rt.wbUninstall(ctx, src.mem)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := src.mem.ExecContext(ctx, "DROP TABLE IF EXISTS \"temp\".\""+wbPauseTable+"\";")
+	if err != nil {
+		return err
+	}
+
+	src.wb.cancel()
+	src.wb = nil
+	return nil
+}
@@ -0,0 +1,134 @@
+package dbops_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hexani-4/go-dbops"
+)
+
+// tests that write-back mode flushes exactly the in-memory inserts, updates and deletes, on demand and on a timer
+func TestWriteBack(t *testing.T) {
+
+	//init
+	var tts = []dbops.Table{{Name: "wb", Dd: false, Cols: []dbops.Col{{Name: "a a", Ext: "INTEGER", Pk: true},
+		{Name: "b b", Ext: "TEXT", Pk: false}}},
+		{Name: "wb deleted", Dd: false, Cols: []dbops.Col{{Name: "deleted", Ext: "INTEGER", Pk: true}}}} //a key named as nothing tracking changes may use
+
+	src, err := dbops.CreateSrc(filepath.Join(t.TempDir(), "wb.db"), tts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer src.Disconnect()
+
+	tbl := src.GetRtable(tts[0].Name)
+	err = tbl.InsertData(dbops.Conf_abort, []any{1, "x", 2, "x", 3, "x"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	err = src.Flush()
+	if err != dbops.ErrNoWriteBack {
+		t.Fatalf("expected ErrNoWriteBack, got %v", err)
+	}
+
+	err = src.CreateMem()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = src.EnableWriteBack(0, nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//loading is not a change
+	err = tbl.LoadIntoMem(0, -1, dbops.Conf_abort, []dbops.Condition{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	pending, err := src.PendingChanges()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if pending[tts[0].Name] != 0 {
+		t.Fatalf("loaded rows were tracked %v", pending)
+	}
+
+	//unloading is not a delete either
+	err = tbl.UnloadFromMem([]dbops.Condition{{Cname: "a a", Op: dbops.Op_eq, Val: 1}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//insert 4, change 2, delete 3, only in memory
+	err = tbl.InsertMemData(dbops.Conf_abort, []any{4, "y"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.UpsertMemData(dbops.Upsert{}, []any{2, "y"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//raw sql is tracked as well
+	_, mem := src.Release()
+	_, err = mem.Exec("DELETE FROM \"wb\" WHERE \"a a\" = 3;")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = src.Reclaim(true, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	pending, err = src.PendingChanges()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if pending[tts[0].Name] != 3 {
+		t.Fatalf("expected 3 pending changes, got %v", pending)
+	}
+
+	//nothing reached disk yet
+	err = checkData(tbl, "a a", [][]any{{int64(1), "x"}, {int64(2), "x"}, {int64(3), "x"}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	err = src.Flush()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = checkData(tbl, "a a", [][]any{{int64(1), "x"}, {int64(2), "y"}, {int64(4), "y"}}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//on a timer
+	err = src.DisableWriteBack(true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = src.EnableWriteBack(5*time.Millisecond, func(err error) { t.Errorf("timer flush failed: %v", err) })
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = tbl.InsertMemData(dbops.Conf_abort, []any{5, "z"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for tbl.Count() != 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timer did not flush")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	err = src.DisableWriteBack(false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+}